@@ -27,6 +27,8 @@ import (
 	"io"
 	"os"
 	"time"
+
+	"github.com/spf13/afero/mem"
 )
 
 type Afero struct {
@@ -102,8 +104,8 @@ type Fs interface {
 }
 
 var (
-	ErrFileClosed        = errors.New("File is closed")
-	ErrOutOfRange        = errors.New("Out of range")
+	ErrFileClosed        = mem.ErrFileClosed
+	ErrOutOfRange        = mem.ErrOutOfRange
 	ErrTooLarge          = errors.New("Too large")
 	ErrFileNotFound      = os.ErrNotExist
 	ErrFileExists        = os.ErrExist
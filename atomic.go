@@ -0,0 +1,105 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// AtomicWriter is an optional interface in Afero. It is only implemented by
+// the filesystems saying so.
+// It is implemented by backends on which a temporary file followed by a
+// rename does not give an atomic replacement, such as object stores, or
+// which have a better way to do it. WriteReaderAtomic uses it if available.
+type AtomicWriter interface {
+	WriteReaderAtomic(name string, r io.Reader, perm os.FileMode) error
+}
+
+// ErrNotAtomic is the error that will be wrapped in an *os.PathError if a
+// file system cannot replace a file atomically.
+var ErrNotAtomic = WrapError(os.ErrInvalid, errors.New("atomic replace not supported"))
+
+// WriteFileAtomic is like WriteFile, but readers of filename see either
+// its previous content or data, never a partially written file, even if
+// the write fails or the process crashes midway.
+func (a Afero) WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomic(a.Fs, filename, data, perm)
+}
+
+func WriteFileAtomic(fs Fs, filename string, data []byte, perm os.FileMode) error {
+	return WriteReaderAtomic(fs, filename, bytes.NewReader(data), perm)
+}
+
+// WriteReaderAtomic atomically replaces the content of path with what is
+// read from r. The content is written to a temporary file next to path,
+// synced, and renamed over path. The mode of an existing file is kept,
+// otherwise perm is used as is, without applying the umask.
+// The parent directory must exist.
+func (a Afero) WriteReaderAtomic(path string, r io.Reader, perm os.FileMode) error {
+	return WriteReaderAtomic(a.Fs, path, r, perm)
+}
+
+func WriteReaderAtomic(fs Fs, path string, r io.Reader, perm os.FileMode) error {
+	if aw, ok := fs.(AtomicWriter); ok {
+		return aw.WriteReaderAtomic(path, r, perm)
+	}
+	return writeReaderAtomic(fs, path, r, perm)
+}
+
+// writeReaderAtomic implements WriteReaderAtomic with a temporary file and
+// Rename, for the filesystems with an atomic Rename.
+func writeReaderAtomic(fs Fs, path string, r io.Reader, perm os.FileMode) (err error) {
+	if fi, err := fs.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := TempFile(fs, dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, filepath.Base(f.Name()))
+	defer func() {
+		if err != nil {
+			fs.Remove(tmp)
+		}
+	}()
+
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	if err = fs.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err = fs.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDir(fs, dir)
+	return nil
+}
+
+// syncDir flushes the entries of dir to stable storage, so that a rename
+// survives a crash. Errors are ignored, as not all systems allow syncing a
+// directory.
+func syncDir(fs Fs, dir string) {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,95 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func checkAtomicWrite(t *testing.T, fs Fs, dir string) {
+	t.Helper()
+	name := filepath.Join(dir, "state.txt")
+	if err := WriteFileAtomic(fs, name, []byte("first"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chmod(name, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(fs, name, []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := WriteReaderAtomic(fs, name, io.MultiReader(strings.NewReader("partial"), failingReader{}), 0644)
+	if err == nil {
+		t.Error("expected the read error to be returned")
+	}
+
+	data, err := ReadFile(fs, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("expected the content of the last successful write, got %q", data)
+	}
+	fi, err := fs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the mode to be preserved, got %v", fi.Mode())
+	}
+	names, err := readDirNames(fs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("expected temporary files to be removed, got %v", names)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	mfs := &MemMapFs{}
+	mfs.MkdirAll("/dir", 0755)
+	checkAtomicWrite(t, mfs, "/dir")
+
+	mfs.MkdirAll("/base/dir", 0755)
+	checkAtomicWrite(t, NewBasePathFs(mfs, "/base"), "/dir")
+
+	mfs.MkdirAll("/re", 0755)
+	checkAtomicWrite(t, NewRegexpFs(mfs, regexp.MustCompile(`(^/re|\.txt)$`)), "/re")
+
+	osfs := &OsFs{}
+	dir, err := TempDir(osfs, "", "afero-atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osfs.RemoveAll(dir)
+	checkAtomicWrite(t, osfs, dir)
+}
+
+func TestWriteFileAtomicNew(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/dir", 0755)
+	if err := WriteFileAtomic(fs, "/dir/new", []byte("x"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Stat("/dir/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("expected perm to be used for a new file, got %v", fi.Mode())
+	}
+
+	err = WriteFileAtomic(NewReadOnlyFs(fs), "/dir/new", []byte("y"), 0640)
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+}
@@ -1,10 +1,14 @@
 package afero
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -18,11 +22,20 @@ var _ Lstater = (*BasePathFs)(nil)
 //
 // Note that it does not clean the error messages on return, so you may
 // reveal the real path on errors.
+//
+// Symbolic links are followed by the source filesystem, wherever they
+// point to, unless the BasePathFs is a jail, see NewJailedBasePathFs.
 type BasePathFs struct {
 	source Fs
 	path   string
+	jail   bool
 }
 
+// ErrEscapesBasePath is the error that will be wrapped in an *os.PathError
+// when a jailed BasePathFs refuses a path resolving outside of its base
+// path through symbolic links.
+var ErrEscapesBasePath = WrapError(os.ErrPermission, errors.New("path escapes base path"))
+
 type BasePathFile struct {
 	File
 	path string
@@ -33,10 +46,40 @@ func (f *BasePathFile) Name() string {
 	return strings.TrimPrefix(sourcename, filepath.Clean(f.path))
 }
 
+func (f *BasePathFile) Lock(ctx context.Context, exclusive bool) error {
+	return LockFile(ctx, f.File, exclusive)
+}
+
+func (f *BasePathFile) TryLock(exclusive bool) error {
+	return TryLockFile(f.File, exclusive)
+}
+
+func (f *BasePathFile) Unlock() error {
+	return UnlockFile(f.File)
+}
+
 func NewBasePathFs(source Fs, path string) Fs {
 	return &BasePathFs{source: source, path: path}
 }
 
+// NewJailedBasePathFs returns a BasePathFs which also resolves the paths
+// it is given component by component, and refuses with ErrEscapesBasePath
+// those escaping its base path through symbolic links: absolute ones, or
+// relative ones with too many "..". Links within the base path keep
+// working.
+//
+// Over an OsFs on Linux, paths are resolved by the kernel, with
+// openat2(2) and RESOLVE_BENEATH, and files are opened that way too, so
+// that a link swapped during an open cannot escape. Elsewhere, or with
+// kernels older than 5.6, links are read and resolved by the BasePathFs,
+// which leaves a window between the check of a path and its use.
+//
+// Links created through a jailed BasePathFs are made relative, so that
+// they resolve within the base path.
+func NewJailedBasePathFs(source Fs, path string) Fs {
+	return &BasePathFs{source: source, path: path, jail: true}
+}
+
 // on a file outside the base path it returns the given file name and an error,
 // else the given file with the base path prepended
 func (b *BasePathFs) RealPath(name string) (path string, err error) {
@@ -46,13 +89,108 @@ func (b *BasePathFs) RealPath(name string) (path string, err error) {
 
 	bpath := filepath.Clean(b.path)
 	path = filepath.Clean(filepath.Join(bpath, name))
-	if !strings.HasPrefix(path, bpath) {
+	if !isBeneath(bpath, path) {
 		return name, os.ErrNotExist
 	}
 
 	return path, nil
 }
 
+// isBeneath tells whether path is base or below it. Both must be clean.
+func isBeneath(base, path string) bool {
+	return path == base || strings.HasPrefix(path, strings.TrimSuffix(base, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// realPath is RealPath, which in a jail also checks that name does not
+// escape the base path, following the last element of name if follow.
+func (b *BasePathFs) realPath(name string, follow bool) (string, error) {
+	path, err := b.RealPath(name)
+	if err != nil || !b.jail {
+		return path, err
+	}
+	if err := b.checkBeneath(path, follow); err != nil {
+		return name, err
+	}
+	return path, nil
+}
+
+// osSource tells whether the source is the OS filesystem, whose paths the
+// kernel can resolve.
+func (b *BasePathFs) osSource() bool {
+	switch b.source.(type) {
+	case OsFs, *OsFs:
+		return true
+	}
+	return false
+}
+
+func (b *BasePathFs) checkBeneath(path string, follow bool) error {
+	bpath := filepath.Clean(b.path)
+	rel, err := filepath.Rel(bpath, path)
+	if err != nil {
+		return err
+	}
+	if b.osSource() {
+		if err := checkBeneathOs(bpath, rel, follow); err != errNoOpenat2 {
+			return err
+		}
+	}
+	return b.walkBeneath(bpath, rel, follow)
+}
+
+// walkBeneath resolves rel below base one element at a time, reading the
+// links met through the source.
+func (b *BasePathFs) walkBeneath(base, rel string, follow bool) error {
+	lstater, ok := b.source.(Lstater)
+	reader, rok := b.source.(LinkReader)
+	if !ok || !rok {
+		// No links to follow.
+		return nil
+	}
+	sep := string(filepath.Separator)
+	todo := strings.Split(rel, sep)
+	var done []string
+	for links := 0; len(todo) > 0; {
+		elem := todo[0]
+		todo = todo[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(done) == 0 {
+				return ErrEscapesBasePath
+			}
+			done = done[:len(done)-1]
+			continue
+		}
+		next := filepath.Join(base, filepath.Join(done...), elem)
+		fi, lstated, err := lstater.LstatIfPossible(next)
+		if errors.Is(err, os.ErrNotExist) {
+			// Nothing below can be a link.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !lstated || fi.Mode()&os.ModeSymlink == 0 || !follow && len(todo) == 0 {
+			done = append(done, elem)
+			continue
+		}
+		if links++; links > 40 {
+			return syscall.ELOOP
+		}
+		target, err := reader.ReadlinkIfPossible(next)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) {
+			return ErrEscapesBasePath
+		}
+		todo = append(strings.Split(target, sep), todo...)
+	}
+	return nil
+}
+
 func validateBasePathName(name string) error {
 	if runtime.GOOS != "windows" {
 		// Not much to do here;
@@ -70,21 +208,21 @@ func validateBasePathName(name string) error {
 }
 
 func (b *BasePathFs) Chtimes(name string, atime, mtime time.Time) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, true); err != nil {
 		return &os.PathError{Op: "chtimes", Path: name, Err: err}
 	}
 	return b.source.Chtimes(name, atime, mtime)
 }
 
 func (b *BasePathFs) Chmod(name string, mode os.FileMode) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, true); err != nil {
 		return &os.PathError{Op: "chmod", Path: name, Err: err}
 	}
 	return b.source.Chmod(name, mode)
 }
 
 func (b *BasePathFs) Chown(name string, uid, gid int) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, true); err != nil {
 		return &os.PathError{Op: "chown", Path: name, Err: err}
 	}
 	return b.source.Chown(name, uid, gid)
@@ -95,37 +233,71 @@ func (b *BasePathFs) Name() string {
 }
 
 func (b *BasePathFs) Stat(name string) (fi os.FileInfo, err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, true); err != nil {
 		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
 	}
 	return b.source.Stat(name)
 }
 
 func (b *BasePathFs) Rename(oldname, newname string) (err error) {
-	if oldname, err = b.RealPath(oldname); err != nil {
+	if oldname, err = b.realPath(oldname, false); err != nil {
 		return &os.PathError{Op: "rename", Path: oldname, Err: err}
 	}
-	if newname, err = b.RealPath(newname); err != nil {
+	if newname, err = b.realPath(newname, false); err != nil {
 		return &os.PathError{Op: "rename", Path: newname, Err: err}
 	}
 	return b.source.Rename(oldname, newname)
 }
 
 func (b *BasePathFs) RemoveAll(name string) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, false); err != nil {
 		return &os.PathError{Op: "remove_all", Path: name, Err: err}
 	}
 	return b.source.RemoveAll(name)
 }
 
 func (b *BasePathFs) Remove(name string) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, false); err != nil {
 		return &os.PathError{Op: "remove", Path: name, Err: err}
 	}
 	return b.source.Remove(name)
 }
 
+// openJailed opens name without escaping the base path, by the kernel when
+// possible.
+func (b *BasePathFs) openJailed(op, name string, flag int, mode os.FileMode) (File, error) {
+	path, err := b.RealPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: path, Err: err}
+	}
+	if b.osSource() {
+		bpath := filepath.Clean(b.path)
+		rel, err := filepath.Rel(bpath, path)
+		if err != nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+		f, err := openBeneath(bpath, rel, flag, mode)
+		if err != errNoOpenat2 {
+			if err != nil {
+				return nil, &os.PathError{Op: op, Path: name, Err: err}
+			}
+			return &BasePathFile{File: f, path: b.path}, nil
+		}
+	}
+	if err := b.checkBeneath(path, true); err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	sourcef, err := b.source.OpenFile(path, flag, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &BasePathFile{File: sourcef, path: b.path}, nil
+}
+
 func (b *BasePathFs) OpenFile(name string, flag int, mode os.FileMode) (f File, err error) {
+	if b.jail {
+		return b.openJailed("openfile", name, flag, mode)
+	}
 	if name, err = b.RealPath(name); err != nil {
 		return nil, &os.PathError{Op: "openfile", Path: name, Err: err}
 	}
@@ -137,6 +309,9 @@ func (b *BasePathFs) OpenFile(name string, flag int, mode os.FileMode) (f File,
 }
 
 func (b *BasePathFs) Open(name string) (f File, err error) {
+	if b.jail {
+		return b.openJailed("open", name, os.O_RDONLY, 0)
+	}
 	if name, err = b.RealPath(name); err != nil {
 		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
@@ -148,20 +323,23 @@ func (b *BasePathFs) Open(name string) (f File, err error) {
 }
 
 func (b *BasePathFs) Mkdir(name string, mode os.FileMode) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, false); err != nil {
 		return &os.PathError{Op: "mkdir", Path: name, Err: err}
 	}
 	return b.source.Mkdir(name, mode)
 }
 
 func (b *BasePathFs) MkdirAll(name string, mode os.FileMode) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, true); err != nil {
 		return &os.PathError{Op: "mkdir", Path: name, Err: err}
 	}
 	return b.source.MkdirAll(name, mode)
 }
 
 func (b *BasePathFs) Create(name string) (f File, err error) {
+	if b.jail {
+		return b.openJailed("create", name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	}
 	if name, err = b.RealPath(name); err != nil {
 		return nil, &os.PathError{Op: "create", Path: name, Err: err}
 	}
@@ -173,7 +351,7 @@ func (b *BasePathFs) Create(name string) (f File, err error) {
 }
 
 func (b *BasePathFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
-	name, err := b.RealPath(name)
+	name, err := b.realPath(name, false)
 	if err != nil {
 		return nil, false, &os.PathError{Op: "lstat", Path: name, Err: err}
 	}
@@ -189,10 +367,16 @@ func (b *BasePathFs) SymlinkIfPossible(oldname, newname string) error {
 	if err != nil {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
 	}
-	newname, err = b.RealPath(newname)
+	newname, err = b.realPath(newname, false)
 	if err != nil {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
 	}
+	if b.jail {
+		// Absolute links would escape.
+		if oldname, err = filepath.Rel(filepath.Dir(newname), oldname); err != nil {
+			return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+		}
+	}
 	if linker, ok := b.source.(Linker); ok {
 		return linker.SymlinkIfPossible(oldname, newname)
 	}
@@ -200,7 +384,7 @@ func (b *BasePathFs) SymlinkIfPossible(oldname, newname string) error {
 }
 
 func (b *BasePathFs) ReadlinkIfPossible(name string) (string, error) {
-	name, err := b.RealPath(name)
+	name, err := b.realPath(name, false)
 	if err != nil {
 		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
 	}
@@ -209,3 +393,86 @@ func (b *BasePathFs) ReadlinkIfPossible(name string) (string, error) {
 	}
 	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
 }
+
+func (b *BasePathFs) GetXattr(name, attr string) ([]byte, error) {
+	name, err := b.realPath(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	if x, ok := b.source.(Xattrer); ok {
+		return x.GetXattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (b *BasePathFs) SetXattr(name, attr string, value []byte) error {
+	name, err := b.realPath(name, true)
+	if err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	if x, ok := b.source.(Xattrer); ok {
+		return x.SetXattr(name, attr, value)
+	}
+	return &os.PathError{Op: "setxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (b *BasePathFs) ListXattr(name string) ([]string, error) {
+	name, err := b.realPath(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	if x, ok := b.source.(Xattrer); ok {
+		return x.ListXattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (b *BasePathFs) RemoveXattr(name, attr string) error {
+	name, err := b.realPath(name, true)
+	if err != nil {
+		return &os.PathError{Op: "removexattr", Path: name, Err: err}
+	}
+	if x, ok := b.source.(Xattrer); ok {
+		return x.RemoveXattr(name, attr)
+	}
+	return &os.PathError{Op: "removexattr", Path: name, Err: ErrNoXattr}
+}
+
+func (b *BasePathFs) Statfs(name string) (*FsStats, error) {
+	name, err := b.realPath(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: err}
+	}
+	return statfsIfPossible(b.source, name)
+}
+
+func (b *BasePathFs) WriteReaderAtomic(name string, r io.Reader, perm os.FileMode) error {
+	name, err := b.realPath(name, false)
+	if err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	}
+	return WriteReaderAtomic(b.source, name, r, perm)
+}
+
+func (b *BasePathFs) Watch(name string, recursive bool) (Watch, error) {
+	name, err := b.realPath(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: err}
+	}
+	watcher, ok := b.source.(Watcher)
+	if !ok {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: ErrNoWatch}
+	}
+	w, err := watcher.Watch(name, recursive)
+	if err != nil {
+		return nil, err
+	}
+	bpath := filepath.Clean(b.path)
+	return newFilteredWatch(func(ev Event) (Event, bool) {
+		ev.Name = strings.TrimPrefix(ev.Name, bpath)
+		if ev.Name == "" {
+			ev.Name = FilePathSeparator
+		}
+		return ev, true
+	}, w), nil
+}
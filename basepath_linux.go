@@ -0,0 +1,109 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// sysOpenat2 is the number of openat2, offset on mips by the first number
+// of the ABI.
+var sysOpenat2 = func() uintptr {
+	switch runtime.GOARCH {
+	case "mips", "mipsle":
+		return 4437
+	case "mips64", "mips64le":
+		return 5437
+	}
+	return 437
+}()
+
+const (
+	oPath = 0x200000
+
+	resolveNoMagiclinks = 0x02
+	resolveBeneath      = 0x08
+)
+
+// openHow is the struct open_how of openat2(2).
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+// errNoOpenat2 is returned when the kernel does not support openat2.
+var errNoOpenat2 = errors.New("openat2 not supported")
+
+// openBeneath opens rel below the directory base, refusing with
+// ErrEscapesBasePath to resolve anything outside of it.
+func openBeneath(base, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	dirfd, err := syscall.Open(base, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(dirfd)
+	p, err := syscall.BytePtrFromString(rel)
+	if err != nil {
+		return nil, err
+	}
+	how := openHow{
+		flags:   uint64(flag | syscall.O_CLOEXEC),
+		resolve: resolveBeneath | resolveNoMagiclinks,
+	}
+	if flag&os.O_CREATE != 0 {
+		how.mode = uint64(syscallMode(perm))
+	}
+	for {
+		fd, _, errno := syscall.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+		switch errno {
+		case 0:
+			return os.NewFile(fd, filepath.Join(base, rel)), nil
+		case syscall.EINTR:
+			continue
+		case syscall.ENOSYS, syscall.E2BIG:
+			return nil, errNoOpenat2
+		case syscall.EXDEV:
+			return nil, ErrEscapesBasePath
+		}
+		return nil, errno
+	}
+}
+
+// syscallMode converts the permissions of a file to open(2) mode bits.
+func syscallMode(perm os.FileMode) uint32 {
+	mode := uint32(perm.Perm())
+	if perm&os.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if perm&os.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if perm&os.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+	return mode
+}
+
+// checkBeneathOs checks that rel resolves below the directory base, or
+// where it would be created if missing.
+func checkBeneathOs(base, rel string, follow bool) error {
+	for {
+		flag := oPath
+		if !follow {
+			flag |= syscall.O_NOFOLLOW
+		}
+		f, err := openBeneath(base, rel, flag, 0)
+		if err == nil {
+			return f.Close()
+		}
+		if err != syscall.ENOENT || rel == "." {
+			return err
+		}
+		// What is missing cannot escape, but its parent might.
+		rel, follow = filepath.Dir(rel), true
+	}
+}
@@ -0,0 +1,19 @@
+// +build !linux
+
+package afero
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoOpenat2 is returned where openat2 does not exist.
+var errNoOpenat2 = errors.New("openat2 not supported")
+
+func openBeneath(base, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	return nil, errNoOpenat2
+}
+
+func checkBeneathOs(base, rel string, follow bool) error {
+	return errNoOpenat2
+}
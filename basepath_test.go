@@ -1,6 +1,7 @@
 package afero
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -21,6 +22,22 @@ func TestBasePath(t *testing.T) {
 	}
 }
 
+func TestBasePathPrefix(t *testing.T) {
+	baseFs := &MemMapFs{}
+	baseFs.MkdirAll("/data", 0777)
+	WriteFile(baseFs, "/database/secret", []byte("secret"), 0644)
+	bp := NewBasePathFs(baseFs, "/data").(*BasePathFs)
+
+	for _, name := range []string{"../database/secret", "/../database/secret", "/x/../../database"} {
+		if path, err := bp.RealPath(name); err != os.ErrNotExist {
+			t.Errorf("%s: expected a path outside of the base to be refused, got %s, %v", name, path, err)
+		}
+	}
+	if _, err := ReadFile(bp, "../database/secret"); err == nil {
+		t.Error("expected a sibling sharing the prefix of the base to be out of reach")
+	}
+}
+
 func TestBasePathRoot(t *testing.T) {
 	baseFs := &MemMapFs{}
 	baseFs.MkdirAll("/base/path/foo/baz", 0777)
@@ -188,3 +205,82 @@ func TestBasePathTempFile(t *testing.T) {
 		t.Fatalf("TempFile realpath leaked: expected %s, got %s", expected, actual)
 	}
 }
+
+func TestJailedBasePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	osFs := NewOsFs()
+	dir, err := TempDir(osFs, "", "afero-jail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osFs.RemoveAll(dir)
+	jail := filepath.Join(dir, "jail")
+	osFs.MkdirAll(filepath.Join(jail, "sub"), 0777)
+	WriteFile(osFs, filepath.Join(jail, "in"), []byte("inside"), 0644)
+	WriteFile(osFs, filepath.Join(dir, "outside"), []byte("outside"), 0644)
+	for link, target := range map[string]string{
+		"ok":      "in",
+		"sub/ok":  "../in",
+		"abs":     filepath.Join(dir, "outside"),
+		"up":      "../outside",
+		"dangles": "../created",
+		"parent":  "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(jail, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources := map[string]Fs{
+		"kernel": osFs,
+		// Not an OsFs: the links are resolved by the BasePathFs.
+		"walk": NewBasePathFs(osFs, "/"),
+	}
+	for kind, source := range sources {
+		fs := NewJailedBasePathFs(source, jail)
+		for _, name := range []string{"/in", "/ok", "/sub/ok", "/sub/../in"} {
+			if data, err := ReadFile(fs, name); err != nil || string(data) != "inside" {
+				t.Errorf("%s: %s: expected links within the jail to work, got %q, %v", kind, name, data, err)
+			}
+		}
+		for _, name := range []string{"/abs", "/up", "/parent/outside", "/parent/jail/in"} {
+			if _, err := ReadFile(fs, name); !errors.Is(err, ErrEscapesBasePath) {
+				t.Errorf("%s: %s: expected the escape to be refused, got %v", kind, name, err)
+			}
+			if _, err := fs.Stat(name); !errors.Is(err, ErrEscapesBasePath) {
+				t.Errorf("%s: %s: expected stat to be refused, got %v", kind, name, err)
+			}
+		}
+		if err := WriteFile(fs, "/dangles", []byte("x"), 0644); !errors.Is(err, ErrEscapesBasePath) {
+			t.Errorf("%s: expected creating through a link to be refused, got %v", kind, err)
+		}
+		if _, err := osFs.Stat(filepath.Join(dir, "created")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected nothing created outside, got %v", kind, err)
+		}
+		if fi, _, err := fs.(Lstater).LstatIfPossible("/abs"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s: expected links themselves to be reachable, got %v", kind, err)
+		}
+		if err := fs.Chmod("/up", 0600); !errors.Is(err, ErrEscapesBasePath) {
+			t.Errorf("%s: expected chmod through a link to be refused, got %v", kind, err)
+		}
+		if err := WriteFile(fs, "/sub/new", []byte("new"), 0644); err != nil {
+			t.Errorf("%s: expected new files to be created, got %v", kind, err)
+		}
+	}
+
+	fs := NewJailedBasePathFs(osFs, jail)
+	if err := fs.(Linker).SymlinkIfPossible("/in", "/sub/link"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(jail, "sub", "link")); err != nil || target != "../in" {
+		t.Errorf("expected a relative link, got %q, %v", target, err)
+	}
+	if data, err := ReadFile(fs, "/sub/link"); err != nil || string(data) != "inside" {
+		t.Errorf("expected the link to resolve in the jail, got %q, %v", data, err)
+	}
+	if err := fs.Remove("/abs"); err != nil {
+		t.Errorf("expected links escaping to be removable, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package afero
 
 import (
+	"errors"
 	"os"
 	"syscall"
 	"time"
@@ -151,6 +152,32 @@ func (u *CacheOnReadFs) Stat(name string) (os.FileInfo, error) {
 	}
 }
 
+// Statfs reports the capacity of the base. As writes go to both layers,
+// the free space is capped by the one of the cache layer.
+func (u *CacheOnReadFs) Statfs(name string) (*FsStats, error) {
+	st, err := statfsIfPossible(u.base, name)
+	if err != nil {
+		return nil, err
+	}
+	lst, err := statfsExisting(u.layer, name)
+	if err != nil {
+		if errors.Is(err, ErrNoStatfs) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if lst.FreeBytes < st.FreeBytes {
+		st.FreeBytes = lst.FreeBytes
+	}
+	if lst.AvailBytes < st.AvailBytes {
+		st.AvailBytes = lst.AvailBytes
+	}
+	if lst.FreeInodes < st.FreeInodes {
+		st.FreeInodes = lst.FreeInodes
+	}
+	return st, nil
+}
+
 func (u *CacheOnReadFs) Rename(oldname, newname string) error {
 	st, _, err := u.cacheStatus(oldname)
 	if err != nil {
@@ -0,0 +1,173 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var _ Lstater = (*CaseInsensitiveFs)(nil)
+
+// The CaseInsensitiveFs emulates over any source filesystem the lookups of
+// case-insensitive, case-preserving filesystems, such as those of macOS
+// and Windows by default: a path names the entries of the source equal to
+// its elements under Unicode case folding, and entries are created with
+// the case given, listings keeping it. This catches, with a MemMapFs on
+// Linux, code relying on the case of names.
+//
+// Creating a file where one differing in case only exists fails with
+// EEXIST, as does renaming onto one, as the outcome would depend on the
+// filesystem: the file is replaced on case-insensitive ones, and a second
+// one is created on others. Renaming an entry to a different case of its
+// own name changes its case.
+//
+// Where the source has entries differing in case only, the one of the
+// case given is used if any, else the first in lexical order.
+type CaseInsensitiveFs struct {
+	source Fs
+}
+
+func NewCaseInsensitiveFs(source Fs) *CaseInsensitiveFs {
+	return &CaseInsensitiveFs{source: source}
+}
+
+// resolve returns the path in the source of name, and whether it exists.
+// Of the path of a missing entry, the directories existing are resolved,
+// and the rest is kept as given.
+func (c *CaseInsensitiveFs) resolve(name string) (string, bool) {
+	name = filepath.Clean(name)
+	real := filepath.VolumeName(name)
+	rest := name[len(real):]
+	if strings.HasPrefix(rest, string(filepath.Separator)) {
+		real += string(filepath.Separator)
+	}
+	var parts []string
+	for _, part := range strings.Split(rest, string(filepath.Separator)) {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	for i, part := range parts {
+		next := filepath.Join(real, part)
+		if _, err := lstatIfPossible(c.source, next); err != nil {
+			dir := real
+			if dir == "" {
+				dir = "."
+			}
+			names, _ := readDirNames(c.source, dir)
+			found := false
+			for _, n := range names {
+				if strings.EqualFold(n, part) {
+					next, found = filepath.Join(real, n), true
+					break
+				}
+			}
+			if !found {
+				return filepath.Join(append([]string{next}, parts[i+1:]...)...), false
+			}
+		}
+		real = next
+	}
+	if real == "" {
+		real = "."
+	}
+	return real, true
+}
+
+// collides tells whether name resolved to the path real of an entry
+// differing in case.
+func collides(name, real string) bool {
+	return filepath.Base(filepath.Clean(name)) != filepath.Base(real)
+}
+
+func (c *CaseInsensitiveFs) Name() string {
+	return "CaseInsensitiveFs"
+}
+
+func (c *CaseInsensitiveFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *CaseInsensitiveFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile fails with EEXIST if the file is to be created, and one
+// differing in case only exists.
+func (c *CaseInsensitiveFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	real, exists := c.resolve(name)
+	if exists && flag&os.O_CREATE != 0 && collides(name, real) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EEXIST}
+	}
+	return c.source.OpenFile(real, flag, perm)
+}
+
+func (c *CaseInsensitiveFs) Mkdir(name string, perm os.FileMode) error {
+	real, exists := c.resolve(name)
+	if exists {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EEXIST}
+	}
+	return c.source.Mkdir(real, perm)
+}
+
+func (c *CaseInsensitiveFs) MkdirAll(path string, perm os.FileMode) error {
+	real, _ := c.resolve(path)
+	return c.source.MkdirAll(real, perm)
+}
+
+func (c *CaseInsensitiveFs) Remove(name string) error {
+	real, _ := c.resolve(name)
+	return c.source.Remove(real)
+}
+
+func (c *CaseInsensitiveFs) RemoveAll(path string) error {
+	real, _ := c.resolve(path)
+	return c.source.RemoveAll(real)
+}
+
+func (c *CaseInsensitiveFs) Rename(oldname, newname string) error {
+	oldreal, exists := c.resolve(oldname)
+	if !exists {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOENT}
+	}
+	newreal, exists := c.resolve(newname)
+	if exists && collides(newname, newreal) {
+		if newreal != oldreal {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EEXIST}
+		}
+		// A change of case.
+		newreal = filepath.Join(filepath.Dir(newreal), filepath.Base(filepath.Clean(newname)))
+	}
+	return c.source.Rename(oldreal, newreal)
+}
+
+func (c *CaseInsensitiveFs) Stat(name string) (os.FileInfo, error) {
+	real, _ := c.resolve(name)
+	return c.source.Stat(real)
+}
+
+func (c *CaseInsensitiveFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	real, _ := c.resolve(name)
+	if lstater, ok := c.source.(Lstater); ok {
+		return lstater.LstatIfPossible(real)
+	}
+	fi, err := c.source.Stat(real)
+	return fi, false, err
+}
+
+func (c *CaseInsensitiveFs) Chmod(name string, mode os.FileMode) error {
+	real, _ := c.resolve(name)
+	return c.source.Chmod(real, mode)
+}
+
+func (c *CaseInsensitiveFs) Chown(name string, uid, gid int) error {
+	real, _ := c.resolve(name)
+	return c.source.Chown(real, uid, gid)
+}
+
+func (c *CaseInsensitiveFs) Chtimes(name string, atime, mtime time.Time) error {
+	real, _ := c.resolve(name)
+	return c.source.Chtimes(real, atime, mtime)
+}
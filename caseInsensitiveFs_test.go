@@ -0,0 +1,72 @@
+package afero
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCaseInsensitiveFsLookup(t *testing.T) {
+	source := &MemMapFs{}
+	source.MkdirAll("/Docs", 0755)
+	WriteFile(source, "/Docs/Readme.md", []byte("hello"), 0644)
+	fs := NewCaseInsensitiveFs(source)
+
+	f, err := fs.Open("/docs/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(f)
+	fi, _ := f.Stat()
+	f.Close()
+	if string(data) != "hello" || fi.Name() != "Readme.md" {
+		t.Errorf("expected to open Readme.md, got %q, %q", fi.Name(), data)
+	}
+	if _, err := fs.Stat("/DOCS/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected ENOENT, got %v", err)
+	}
+
+	if _, err := fs.Create("/DOCS/readme.md"); !os.IsExist(err) {
+		t.Errorf("expected a case collision, got %v", err)
+	}
+	if err := fs.Mkdir("/docs", 0755); !os.IsExist(err) {
+		t.Errorf("expected a case collision, got %v", err)
+	}
+	if err := WriteFile(fs, "/DOCS/New.txt", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/docs/Sub/Dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	names, err := readDirNames(fs, "/docs")
+	if err != nil || !reflect.DeepEqual(names, []string{"New.txt", "Readme.md", "Sub"}) {
+		t.Errorf("expected the case to be preserved, got %v, %v", names, err)
+	}
+	if names, _ := readDirNames(source, "/"); !reflect.DeepEqual(names, []string{"Docs"}) {
+		t.Errorf("expected no second directory, got %v", names)
+	}
+}
+
+func TestCaseInsensitiveFsRename(t *testing.T) {
+	source := &MemMapFs{}
+	WriteFile(source, "/readme.md", []byte("hello"), 0644)
+	WriteFile(source, "/notes.txt", nil, 0644)
+	fs := NewCaseInsensitiveFs(source)
+
+	if err := fs.Rename("/README.md", "/ReadMe.md"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := readDirNames(source, "/"); !reflect.DeepEqual(names, []string{"ReadMe.md", "notes.txt"}) {
+		t.Errorf("expected a change of case, got %v", names)
+	}
+	if err := fs.Rename("/notes.txt", "/README.MD"); !os.IsExist(err) {
+		t.Errorf("expected a case collision, got %v", err)
+	}
+	if err := fs.Remove("/NOTES.TXT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Stat("/notes.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed, got %v", err)
+	}
+}
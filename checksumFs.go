@@ -0,0 +1,491 @@
+package afero
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Lstater = (*ChecksumFs)(nil)
+
+var (
+	// ErrCorrupted is the error that will be wrapped in an *os.PathError
+	// when the content of a file does not match its checksum.
+	ErrCorrupted = errors.New("checksum mismatch, the data is corrupted")
+
+	// ErrNoChecksum is wrapped in an *os.PathError when a file has no
+	// checksum to be verified against.
+	ErrNoChecksum = errors.New("no checksum recorded")
+)
+
+const (
+	// ChecksumSuffix is appended to the name of a file to name its
+	// sidecar, the file holding its checksum.
+	ChecksumSuffix = ".afero-sum"
+
+	// ChecksumAttr is the extended attribute holding the checksum of a
+	// file, when they are stored as attributes.
+	ChecksumAttr = "user.afero.checksum"
+)
+
+// ChecksumOptions are the options of a ChecksumFs.
+type ChecksumOptions struct {
+	// Hash computes the checksums, sha256.New if nil. HashName, "sha256"
+	// by default, is stored along the checksums: those computed with
+	// another hash count as missing.
+	Hash     func() hash.Hash
+	HashName string
+
+	// Xattr stores the checksums in the ChecksumAttr extended attribute
+	// of the files, when the source filesystem supports them, rather
+	// than in sidecars.
+	Xattr bool
+}
+
+// The ChecksumFs records a checksum of every file written through it, and
+// verifies it when the file is read back, so that silent corruption of
+// long-term archives is detected.
+//
+// A checksum is recorded when a file written is closed or synced, and
+// removed as soon as the file is modified, so that an interrupted write
+// reads as a missing checksum rather than as corruption. It is stored in a
+// sidecar, named by adding ChecksumSuffix to the name of the file and
+// hidden from directory listings, or in an extended attribute, see
+// ChecksumOptions.
+//
+// A file read sequentially to its end is verified on the fly: the read
+// reaching the end fails with ErrCorrupted on a mismatch, instead of
+// returning io.EOF. Other reads, through ReadAt or after a Seek, are not
+// verified, Verify checks a whole file, and Scrub a whole tree. Files
+// without checksum are read without verification.
+type ChecksumFs struct {
+	source   Fs
+	hash     func() hash.Hash
+	hashName string
+	xattr    bool
+}
+
+func NewChecksumFs(source Fs, opts ChecksumOptions) *ChecksumFs {
+	c := &ChecksumFs{source: source, hash: opts.Hash, hashName: opts.HashName, xattr: opts.Xattr}
+	if c.hash == nil {
+		c.hash = sha256.New
+	}
+	if c.hashName == "" {
+		c.hashName = "sha256"
+	}
+	return c
+}
+
+func isChecksumSidecar(name string) bool {
+	return strings.HasSuffix(name, ChecksumSuffix)
+}
+
+// encode formats a checksum as stored.
+func (c *ChecksumFs) encode(sum []byte) []byte {
+	return []byte(c.hashName + ":" + hex.EncodeToString(sum))
+}
+
+// checksum returns the checksum recorded for name, nil if none.
+func (c *ChecksumFs) checksum(name string) ([]byte, error) {
+	var stored []byte
+	if x, ok := c.source.(Xattrer); ok && c.xattr {
+		value, err := x.GetXattr(name, ChecksumAttr)
+		switch {
+		case err == nil:
+			stored = value
+		case !errors.Is(err, ErrNoAttr) && !errors.Is(err, ErrNoXattr):
+			return nil, err
+		}
+	}
+	if stored == nil {
+		data, err := ReadFile(c.source, name+ChecksumSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		stored = data
+	}
+	prefix := c.hashName + ":"
+	if !bytes.HasPrefix(stored, []byte(prefix)) {
+		return nil, nil
+	}
+	sum, err := hex.DecodeString(strings.TrimSpace(string(stored[len(prefix):])))
+	if err != nil {
+		return nil, nil
+	}
+	return sum, nil
+}
+
+// setChecksum records the checksum of name.
+func (c *ChecksumFs) setChecksum(name string, sum []byte) error {
+	if x, ok := c.source.(Xattrer); ok && c.xattr {
+		err := x.SetXattr(name, ChecksumAttr, c.encode(sum))
+		if err == nil || !errors.Is(err, ErrNoXattr) {
+			return err
+		}
+	}
+	return WriteFile(c.source, name+ChecksumSuffix, c.encode(sum), 0644)
+}
+
+// removeChecksum forgets the checksum of name.
+func (c *ChecksumFs) removeChecksum(name string) error {
+	if x, ok := c.source.(Xattrer); ok && c.xattr {
+		err := x.RemoveXattr(name, ChecksumAttr)
+		if err != nil && !errors.Is(err, ErrNoAttr) && !errors.Is(err, ErrNoXattr) && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := c.source.Remove(name + ChecksumSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// sum hashes the content of name in the source.
+func (c *ChecksumFs) sum(name string) ([]byte, error) {
+	f, err := c.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := c.hash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Verify hashes the whole content of name and compares it with its
+// checksum. It fails with ErrCorrupted on a mismatch, and ErrNoChecksum if
+// name has no checksum.
+func (c *ChecksumFs) Verify(name string) error {
+	want, err := c.checksum(name)
+	if err != nil {
+		return err
+	}
+	if want == nil {
+		return &os.PathError{Op: "verify", Path: name, Err: ErrNoChecksum}
+	}
+	got, err := c.sum(name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return &os.PathError{Op: "verify", Path: name, Err: ErrCorrupted}
+	}
+	return nil
+}
+
+// A ScrubProblem is a file found by Scrub which could not be verified.
+type ScrubProblem struct {
+	Path string
+	// Err wraps ErrCorrupted or ErrNoChecksum, or is the error reading
+	// the file.
+	Err error
+}
+
+// Scrub verifies every regular file below root, and returns those which
+// failed, in lexical order. The error is that of walking the tree.
+func (c *ChecksumFs) Scrub(root string) ([]ScrubProblem, error) {
+	var problems []ScrubProblem
+	err := Walk(c, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := c.Verify(path); err != nil {
+			problems = append(problems, ScrubProblem{Path: path, Err: err})
+		}
+		return nil
+	})
+	return problems, err
+}
+
+func (c *ChecksumFs) Name() string {
+	return "ChecksumFs"
+}
+
+func (c *ChecksumFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *ChecksumFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *ChecksumFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := c.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	cf := &ChecksumFile{lockingFile: lockingFile{f}, fs: c, name: name}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return cf, nil
+	}
+	if flag&os.O_TRUNC != 0 {
+		if err := cf.modify(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if fi.Size() == 0 || flag&os.O_TRUNC != 0 {
+		cf.whash, cf.wseq = c.hash(), true
+	}
+	if cf.want, err = c.checksum(name); err != nil {
+		f.Close()
+		return nil, err
+	}
+	cf.rhash, cf.rseq = c.hash(), true
+	return cf, nil
+}
+
+func (c *ChecksumFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *ChecksumFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *ChecksumFs) Remove(name string) error {
+	if err := c.source.Remove(name); err != nil {
+		return err
+	}
+	return c.removeChecksum(name)
+}
+
+func (c *ChecksumFs) RemoveAll(path string) error {
+	if err := c.source.RemoveAll(path); err != nil {
+		return err
+	}
+	return c.removeChecksum(path)
+}
+
+// Rename moves the checksum of a file with it. Those of the files of a
+// directory move with the directory. The checksum of a file replaced goes.
+func (c *ChecksumFs) Rename(oldname, newname string) error {
+	if err := c.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	err := c.source.Rename(oldname+ChecksumSuffix, newname+ChecksumSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		// Stored as an attribute, which moved with the file, or not at
+		// all: a sidecar left by the file replaced would apply to it.
+		err = c.source.Remove(newname + ChecksumSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+	return err
+}
+
+func (c *ChecksumFs) Stat(name string) (os.FileInfo, error) {
+	return c.source.Stat(name)
+}
+
+func (c *ChecksumFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lstater, ok := c.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := c.Stat(name)
+	return fi, false, err
+}
+
+func (c *ChecksumFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *ChecksumFs) Chown(name string, uid, gid int) error {
+	return c.source.Chown(name, uid, gid)
+}
+
+func (c *ChecksumFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+// ChecksumFile is a file opened through a ChecksumFs.
+type ChecksumFile struct {
+	lockingFile
+	fs   *ChecksumFs
+	name string
+
+	mu sync.Mutex
+
+	// Whether the file was modified, and the hash of what was written,
+	// as long as it was written sequentially from the start.
+	modified bool
+	whash    hash.Hash
+	wpos     int64
+	wseq     bool
+
+	// The checksum recorded when the file was opened, and the hash of
+	// what was read, as long as it was read sequentially from the start.
+	want  []byte
+	rhash hash.Hash
+	rpos  int64
+	rseq  bool
+}
+
+// modify forgets the checksum of the file, which is being modified.
+func (f *ChecksumFile) modify() error {
+	f.rseq = false
+	if f.modified {
+		return nil
+	}
+	if err := f.fs.removeChecksum(f.name); err != nil {
+		return err
+	}
+	f.modified = true
+	return nil
+}
+
+// record computes and records the checksum of a modified file.
+func (f *ChecksumFile) record() error {
+	var sum []byte
+	if f.wseq {
+		sum = f.whash.Sum(nil)
+	} else {
+		var err error
+		if sum, err = f.fs.sum(f.name); err != nil {
+			return err
+		}
+	}
+	if err := f.fs.setChecksum(f.name, sum); err != nil {
+		return err
+	}
+	f.modified = false
+	return nil
+}
+
+func (f *ChecksumFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.File.Read(p)
+	if !f.rseq {
+		return n, err
+	}
+	f.rhash.Write(p[:n])
+	f.rpos += int64(n)
+	if err == io.EOF && f.want != nil {
+		f.rseq = false
+		if !bytes.Equal(f.rhash.Sum(nil), f.want) {
+			return n, &os.PathError{Op: "read", Path: f.name, Err: ErrCorrupted}
+		}
+	}
+	return n, err
+}
+
+func (f *ChecksumFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pos, err := f.File.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos == 0 && !f.modified && f.rhash != nil {
+		// Reading from the start again, directories having no hash.
+		f.rhash.Reset()
+		f.rpos, f.rseq = 0, true
+	} else if pos != f.rpos {
+		f.rseq = false
+	}
+	if pos != f.wpos {
+		f.wseq = false
+	}
+	return pos, nil
+}
+
+func (f *ChecksumFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.modify(); err != nil {
+		return 0, err
+	}
+	n, err := f.File.Write(p)
+	if f.wseq {
+		f.whash.Write(p[:n])
+		f.wpos += int64(n)
+	}
+	return n, err
+}
+
+func (f *ChecksumFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.modify(); err != nil {
+		return 0, err
+	}
+	f.wseq = false
+	return f.File.WriteAt(p, off)
+}
+
+func (f *ChecksumFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *ChecksumFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.modify(); err != nil {
+		return err
+	}
+	if size != f.wpos {
+		f.wseq = false
+	}
+	return f.File.Truncate(size)
+}
+
+// Sync records the checksum of the file, if modified, once synced.
+func (f *ChecksumFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	if !f.modified {
+		return nil
+	}
+	return f.record()
+}
+
+// Close records the checksum of the file, if modified, once closed, as
+// some filesystems only store the content then.
+func (f *ChecksumFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if !f.modified {
+		return nil
+	}
+	return f.record()
+}
+
+// Readdir hides the sidecars.
+func (f *ChecksumFile) Readdir(count int) ([]os.FileInfo, error) {
+	return readdirFiltered(f.File, count, func(fi os.FileInfo) (os.FileInfo, bool) {
+		return fi, !isChecksumSidecar(fi.Name())
+	})
+}
+
+func (f *ChecksumFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
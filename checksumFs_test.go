@@ -0,0 +1,175 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestChecksumFsVerifyOnRead(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewChecksumFs(source, ChecksumOptions{})
+	if err := WriteFile(fs, "/archive", []byte("precious data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/archive"); err != nil || string(data) != "precious data" {
+		t.Fatalf("expected the content to verify, got %q, %v", data, err)
+	}
+	if err := fs.Verify("/archive"); err != nil {
+		t.Error(err)
+	}
+
+	// Bit-rot, behind the back of the ChecksumFs.
+	WriteFile(source, "/archive", []byte("precious dato"), 0644)
+	_, err := ReadFile(fs, "/archive")
+	var perr *os.PathError
+	if !errors.Is(err, ErrCorrupted) || !errors.As(err, &perr) || perr.Path != "/archive" {
+		t.Errorf("expected ErrCorrupted, got %v", err)
+	}
+	if err := fs.Verify("/archive"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected Verify to report the corruption, got %v", err)
+	}
+
+	// Random access is not verified.
+	f, _ := fs.Open("/archive")
+	defer f.Close()
+	p := make([]byte, 4)
+	if _, err := f.ReadAt(p, 9); err != nil || string(p) != "dato" {
+		t.Errorf("expected ReadAt to read the data as is, got %q, %v", p, err)
+	}
+}
+
+func TestChecksumFsRandomWrites(t *testing.T) {
+	fs := NewChecksumFs(&MemMapFs{}, ChecksumOptions{})
+	WriteFile(fs, "/f", []byte("hello world"), 0644)
+	f, err := fs.OpenFile("/f", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("W"), 6)
+	if err := fs.Verify("/f"); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("expected the checksum to be dropped while writing, got %v", err)
+	}
+	f.Truncate(8)
+	f.Close()
+	if err := fs.Verify("/f"); err != nil {
+		t.Errorf("expected the file to be hashed again, got %v", err)
+	}
+	if data, err := ReadFile(fs, "/f"); err != nil || string(data) != "hello Wo" {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
+
+func TestChecksumFsSidecars(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewChecksumFs(source, ChecksumOptions{})
+	fs.MkdirAll("/dir", 0755)
+	WriteFile(fs, "/dir/a", []byte("a"), 0644)
+	WriteFile(fs, "/dir/b", []byte("b"), 0644)
+	if _, err := source.Stat("/dir/a" + ChecksumSuffix); err != nil {
+		t.Errorf("expected a sidecar, got %v", err)
+	}
+
+	fis, err := ReadDir(fs, "/dir")
+	if err != nil || len(fis) != 2 || fis[0].Name() != "a" || fis[1].Name() != "b" {
+		t.Errorf("expected the sidecars to be hidden, got %v, %v", fis, err)
+	}
+	if err := fs.Rename("/dir/a", "/dir/c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Verify("/dir/c"); err != nil {
+		t.Errorf("expected the checksum to follow the rename, got %v", err)
+	}
+	fs.Remove("/dir/c")
+	if _, err := source.Stat("/dir/c" + ChecksumSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected the sidecar to be removed, got %v", err)
+	}
+
+	// The checksum of a file replaced does not apply to the one replacing
+	// it.
+	WriteFile(source, "/dir/d", []byte("d"), 0644)
+	if err := fs.Rename("/dir/d", "/dir/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Verify("/dir/b"); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("expected ErrNoChecksum, got %v", err)
+	}
+	if data, err := ReadFile(fs, "/dir/b"); err != nil || string(data) != "d" {
+		t.Errorf("expected to read the file, got %q, %v", data, err)
+	}
+}
+
+func TestChecksumFsXattr(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewChecksumFs(source, ChecksumOptions{Xattr: true})
+	WriteFile(fs, "/f", []byte("data"), 0644)
+	if _, err := source.Stat("/f" + ChecksumSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected no sidecar, got %v", err)
+	}
+	value, err := source.GetXattr("/f", ChecksumAttr)
+	if err != nil || len(value) == 0 {
+		t.Fatalf("expected the checksum in an attribute, got %q, %v", value, err)
+	}
+	WriteFile(source, "/f", []byte("date"), 0644)
+	if err := fs.Verify("/f"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted, got %v", err)
+	}
+
+	// Neither an attribute nor a sidecar of a file replaced apply to the
+	// one replacing it.
+	WriteFile(NewChecksumFs(source, ChecksumOptions{}), "/g", []byte("g"), 0644)
+	WriteFile(fs, "/h", []byte("h"), 0644)
+	WriteFile(source, "/i", []byte("i"), 0644)
+	for _, names := range [][2]string{{"/h", "/g"}, {"/i", "/g"}} {
+		if err := fs.Rename(names[0], names[1]); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ReadFile(fs, "/g"); err != nil || string(data) != names[0][1:] {
+			t.Errorf("expected to read the file renamed, got %q, %v", data, err)
+		}
+	}
+	if _, err := source.Stat("/g" + ChecksumSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected the sidecar of the file replaced to be removed, got %v", err)
+	}
+}
+
+func TestChecksumFsScrub(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewChecksumFs(source, ChecksumOptions{})
+	fs.MkdirAll("/archive/2020", 0755)
+	WriteFile(fs, "/archive/2020/ok", []byte("fine"), 0644)
+	WriteFile(fs, "/archive/2020/rotten", []byte("fine"), 0644)
+	WriteFile(source, "/archive/2020/rotten", []byte("fane"), 0644)
+	WriteFile(source, "/archive/unknown", []byte("?"), 0644)
+
+	problems, err := fs.Scrub("/archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 ||
+		problems[0].Path != "/archive/2020/rotten" || !errors.Is(problems[0].Err, ErrCorrupted) ||
+		problems[1].Path != "/archive/unknown" || !errors.Is(problems[1].Err, ErrNoChecksum) {
+		t.Errorf("expected the corrupted and the unknown files, got %v", problems)
+	}
+
+	f, _ := fs.Open("/archive/2020/ok")
+	defer f.Close()
+	if data, err := ioutil.ReadAll(f); err != nil || string(data) != "fine" {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
+
+func TestChecksumFsSeekDirectory(t *testing.T) {
+	fs := NewChecksumFs(&MemMapFs{}, ChecksumOptions{})
+	fs.MkdirAll("/d", 0755)
+	f, err := fs.Open("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Errorf("expected to rewind the directory, got %v", err)
+	}
+}
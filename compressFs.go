@@ -0,0 +1,699 @@
+package afero
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ Lstater = (*CompressFs)(nil)
+
+// A Codec compresses the chunks of the files of a CompressFs.
+type Codec interface {
+	// Name identifies the codec in the files it compressed. It is at
+	// most 8 bytes long.
+	Name() string
+	Compress(p []byte) ([]byte, error)
+	// Decompress returns the size bytes p was compressed from.
+	Decompress(p []byte, size int) ([]byte, error)
+}
+
+// GzipCodec is a Codec using gzip at the given level, the default one if
+// zero.
+type GzipCodec struct {
+	Level int
+}
+
+func (GzipCodec) Name() string {
+	return "gzip"
+}
+
+func (c GzipCodec) Compress(p []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCodec) Decompress(p []byte, size int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, err
+	}
+	if n, _ := r.Read(make([]byte, 1)); n != 0 {
+		return nil, errors.New("gzip: chunk larger than expected")
+	}
+	return out, nil
+}
+
+// ErrNotCompressed is the error that will be wrapped in an *os.PathError
+// if a file opened through a CompressFs was not written by one, or with a
+// codec it does not know.
+var ErrNotCompressed = WrapError(os.ErrInvalid, errors.New("not a compressed file"))
+
+// CompressOptions are the options of a CompressFs.
+type CompressOptions struct {
+	// Codec compresses the files written, GzipCodec if nil.
+	Codec Codec
+	// Codecs are other codecs files may have been compressed with.
+	Codecs []Codec
+	// ChunkSize is the number of bytes compressed together, 256 KiB if
+	// zero. Larger chunks compress better, smaller ones make random
+	// reads cheaper.
+	ChunkSize int
+}
+
+const (
+	compressMagic       = "AFZ1"
+	compressHeaderSize  = 32
+	compressFrameHeader = 8
+	compressDefaultSize = 256 << 10
+)
+
+// The CompressFs compresses the content of the files of a source
+// filesystem, so that for example a log archive takes less room, while
+// code reading it keeps working unchanged.
+//
+// Files are compressed in chunks, each in its own frame, followed by an
+// index of the frames written when the file is closed, which starts like
+// an empty frame so that scanning the frames stops at it. Reads, through
+// Read, ReadAt or after a Seek, only decompress the chunks they need, and
+// Stat reports the uncompressed size stored in the header of the file,
+// which costs a read of it. Files not closed properly are still readable,
+// by scanning their frames.
+//
+// Files are written sequentially: a handle opened for writing starts
+// either an empty file, or appends to an existing one, and cannot be read
+// from. Stat and directory listings report the size of the files which are
+// not compressed as is.
+type CompressFs struct {
+	source    Fs
+	codec     Codec
+	codecs    map[string]Codec
+	chunkSize int
+}
+
+func NewCompressFs(source Fs, opts CompressOptions) *CompressFs {
+	c := &CompressFs{source: source, codec: opts.Codec, chunkSize: opts.ChunkSize, codecs: make(map[string]Codec)}
+	if c.codec == nil {
+		c.codec = GzipCodec{}
+	}
+	if c.chunkSize <= 0 {
+		c.chunkSize = compressDefaultSize
+	}
+	for _, codec := range append(opts.Codecs, c.codec) {
+		c.codecs[codec.Name()] = codec
+	}
+	return c
+}
+
+// compressFrame is the position of a chunk, in the source file and in the
+// uncompressed content.
+type compressFrame struct {
+	offset int64 // of the frame header
+	plain  int64
+}
+
+// compressIndex describes a compressed file.
+type compressIndex struct {
+	codec  Codec
+	frames []compressFrame
+	end    int64 // of the last frame
+	size   int64
+}
+
+// valid tells whether the frames of an index read follow each other from
+// the header on, and end before the index.
+func (idx *compressIndex) valid() bool {
+	if idx.size < 0 || (len(idx.frames) == 0) != (idx.size == 0) {
+		return false
+	}
+	prev := compressFrame{offset: compressHeaderSize - compressFrameHeader, plain: -1}
+	for i, frame := range idx.frames {
+		if i == 0 && (frame.offset != compressHeaderSize || frame.plain != 0) ||
+			frame.offset < prev.offset+compressFrameHeader || frame.plain <= prev.plain {
+			return false
+		}
+		prev = frame
+	}
+	return len(idx.frames) == 0 || prev.offset+compressFrameHeader <= idx.end && prev.plain < idx.size
+}
+
+// readIndex reads the header of a compressed file of the given size in
+// the source, and its index, or scans its frames if it has none.
+func (c *CompressFs) readIndex(src File, srcSize int64) (*compressIndex, error) {
+	header := make([]byte, compressHeaderSize)
+	if _, err := src.ReadAt(header, 0); err != nil || string(header[:4]) != compressMagic {
+		return nil, ErrNotCompressed
+	}
+	codec := c.codecs[string(bytes.TrimRight(header[4:12], "\x00"))]
+	if codec == nil {
+		return nil, ErrNotCompressed
+	}
+	idx := &compressIndex{codec: codec, size: int64(binary.BigEndian.Uint64(header[12:20]))}
+	indexOffset := int64(binary.BigEndian.Uint64(header[20:28]))
+	if indexOffset != 0 {
+		if indexOffset < compressHeaderSize || indexOffset > srcSize-compressFrameHeader-4 {
+			return nil, ErrNotCompressed
+		}
+		head := make([]byte, compressFrameHeader+4)
+		if _, err := src.ReadAt(head, indexOffset); err != nil {
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint32(head[8:12]))
+		if binary.BigEndian.Uint32(head[0:4]) != 0 || int64(binary.BigEndian.Uint32(head[4:8])) != 4+16*n ||
+			16*n > srcSize-indexOffset-compressFrameHeader-4 {
+			return nil, ErrNotCompressed
+		}
+		entries := make([]byte, 16*n)
+		if _, err := src.ReadAt(entries, indexOffset+compressFrameHeader+4); err != nil && len(entries) > 0 {
+			return nil, err
+		}
+		for i := 0; i < len(entries); i += 16 {
+			idx.frames = append(idx.frames, compressFrame{
+				offset: int64(binary.BigEndian.Uint64(entries[i:])),
+				plain:  int64(binary.BigEndian.Uint64(entries[i+8:])),
+			})
+		}
+		idx.end = indexOffset
+		if !idx.valid() {
+			return nil, ErrNotCompressed
+		}
+		return idx, nil
+	}
+
+	// The file was not closed: rebuild the index from the frames.
+	idx.size = 0
+	frame := make([]byte, compressFrameHeader)
+	for off := int64(compressHeaderSize); off+compressFrameHeader <= srcSize; {
+		if _, err := src.ReadAt(frame, off); err != nil {
+			return nil, err
+		}
+		plainLen := int64(binary.BigEndian.Uint32(frame[0:4]))
+		if plainLen == 0 {
+			break // the index, left by a crash before the header was written
+		}
+		next := off + compressFrameHeader + int64(binary.BigEndian.Uint32(frame[4:8]))
+		if next > srcSize {
+			break // an incomplete last frame
+		}
+		idx.frames = append(idx.frames, compressFrame{offset: off, plain: idx.size})
+		idx.size += plainLen
+		off = next
+		idx.end = off
+	}
+	if idx.end == 0 {
+		idx.end = compressHeaderSize
+	}
+	return idx, nil
+}
+
+// plainSize returns the uncompressed size of the file at name in the
+// source, or its size if it is not compressed.
+func (c *CompressFs) plainSize(name string, fi os.FileInfo) int64 {
+	if !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return fi.Size()
+	}
+	src, err := c.source.Open(name)
+	if err != nil {
+		return fi.Size()
+	}
+	defer src.Close()
+	idx, err := c.readIndex(src, fi.Size())
+	if err != nil {
+		return fi.Size()
+	}
+	return idx.size
+}
+
+// compressFileInfo reports the uncompressed size of a file.
+type compressFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *compressFileInfo) Size() int64 { return fi.size }
+
+func (c *CompressFs) Name() string {
+	return "CompressFs"
+}
+
+func (c *CompressFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *CompressFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *CompressFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	srcFlag := flag &^ os.O_APPEND
+	if writable {
+		// The index of an existing file is read before appending.
+		srcFlag = srcFlag&^os.O_WRONLY | os.O_RDWR
+	}
+	src, err := c.source.OpenFile(name, srcFlag, perm)
+	if err != nil {
+		return nil, err
+	}
+	f := &CompressFile{fs: c, src: src, writable: writable}
+	if err := f.init(); err != nil {
+		src.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (c *CompressFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *CompressFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *CompressFs) Remove(name string) error {
+	return c.source.Remove(name)
+}
+
+func (c *CompressFs) RemoveAll(path string) error {
+	return c.source.RemoveAll(path)
+}
+
+func (c *CompressFs) Rename(oldname, newname string) error {
+	return c.source.Rename(oldname, newname)
+}
+
+func (c *CompressFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := c.source.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &compressFileInfo{FileInfo: fi, size: c.plainSize(name, fi)}, nil
+}
+
+func (c *CompressFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	lstater, ok := c.source.(Lstater)
+	if !ok {
+		fi, err := c.Stat(name)
+		return fi, false, err
+	}
+	fi, lstat, err := lstater.LstatIfPossible(name)
+	if err != nil {
+		return nil, lstat, err
+	}
+	return &compressFileInfo{FileInfo: fi, size: c.plainSize(name, fi)}, lstat, nil
+}
+
+func (c *CompressFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *CompressFs) Chown(name string, uid, gid int) error {
+	return c.source.Chown(name, uid, gid)
+}
+
+func (c *CompressFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+// CompressFile is a file opened through a CompressFs.
+type CompressFile struct {
+	fs       *CompressFs
+	src      File
+	writable bool
+
+	mu  sync.Mutex
+	dir bool
+	idx *compressIndex
+	off int64
+
+	// Of the last chunk read.
+	chunk      []byte
+	chunkIndex int
+
+	// Of a file written: the data not compressed yet, and whether the
+	// header still has to be marked as incomplete.
+	pending []byte
+	dirty   bool
+}
+
+func (f *CompressFile) init() error {
+	fi, err := f.src.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		f.dir = true
+		return nil
+	}
+	f.chunkIndex = -1
+	if fi.Size() == 0 {
+		f.idx = &compressIndex{codec: f.fs.codec, end: compressHeaderSize}
+		if f.writable {
+			return f.writeHeader(0)
+		}
+		return nil
+	}
+	idx, err := f.fs.readIndex(f.src, fi.Size())
+	if err != nil {
+		return err
+	}
+	if f.writable && idx.codec != f.fs.codec {
+		// Appending with a different codec is not supported.
+		return ErrNotCompressed
+	}
+	f.idx = idx
+	if f.writable {
+		f.off = idx.size
+	}
+	return nil
+}
+
+// writeHeader writes the header of the file, with the offset of its index,
+// zero while it is being written.
+func (f *CompressFile) writeHeader(indexOffset int64) error {
+	header := make([]byte, compressHeaderSize)
+	copy(header, compressMagic)
+	copy(header[4:12], f.idx.codec.Name())
+	binary.BigEndian.PutUint64(header[12:20], uint64(f.idx.size))
+	binary.BigEndian.PutUint64(header[20:28], uint64(indexOffset))
+	_, err := f.src.WriteAt(header, 0)
+	return err
+}
+
+func (f *CompressFile) error(op string, err error) error {
+	return &os.PathError{Op: op, Path: f.Name(), Err: err}
+}
+
+func (f *CompressFile) Name() string {
+	return f.src.Name()
+}
+
+// readChunk returns the uncompressed chunk i.
+func (f *CompressFile) readChunk(i int) ([]byte, error) {
+	if i == f.chunkIndex {
+		return f.chunk, nil
+	}
+	start := f.idx.frames[i].offset
+	end := f.idx.end
+	plainEnd := f.idx.size
+	if i+1 < len(f.idx.frames) {
+		end = f.idx.frames[i+1].offset
+		plainEnd = f.idx.frames[i+1].plain
+	}
+	buf := make([]byte, end-start)
+	if _, err := f.src.ReadAt(buf, start); err != nil {
+		return nil, f.error("read", err)
+	}
+	if int64(binary.BigEndian.Uint32(buf[0:4])) != plainEnd-f.idx.frames[i].plain {
+		return nil, f.error("read", ErrNotCompressed)
+	}
+	chunk, err := f.idx.codec.Decompress(buf[compressFrameHeader:], int(plainEnd-f.idx.frames[i].plain))
+	if err != nil {
+		return nil, f.error("read", err)
+	}
+	if int64(len(chunk)) != plainEnd-f.idx.frames[i].plain {
+		return nil, f.error("read", ErrNotCompressed)
+	}
+	f.chunk, f.chunkIndex = chunk, i
+	return chunk, nil
+}
+
+func (f *CompressFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *CompressFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAt(p, off)
+}
+
+func (f *CompressFile) readAt(p []byte, off int64) (int, error) {
+	if f.dir {
+		return 0, f.error("read", syscall.EISDIR)
+	}
+	if f.writable {
+		return 0, f.error("read", syscall.EBADF)
+	}
+	if off < 0 {
+		return 0, f.error("readat", errors.New("negative offset"))
+	}
+	frames := f.idx.frames
+	var read int
+	for read < len(p) && off < f.idx.size {
+		i := sort.Search(len(frames), func(i int) bool { return frames[i].plain > off }) - 1
+		chunk, err := f.readChunk(i)
+		if err != nil {
+			return read, err
+		}
+		n := copy(p[read:], chunk[off-frames[i].plain:])
+		read += n
+		off += int64(n)
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (f *CompressFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.write(p)
+}
+
+// WriteAt only accepts writes at the end of the file.
+func (f *CompressFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off != f.off {
+		return 0, f.error("writeat", ErrNotSupported)
+	}
+	return f.write(p)
+}
+
+func (f *CompressFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *CompressFile) write(p []byte) (int, error) {
+	if f.dir {
+		return 0, f.error("write", syscall.EISDIR)
+	}
+	if !f.writable {
+		return 0, f.error("write", syscall.EBADF)
+	}
+	if !f.dirty {
+		// Until closed, the index is gone, and readers scan the frames.
+		if err := f.writeHeader(0); err != nil {
+			return 0, f.error("write", err)
+		}
+		// The index is replaced by the frames written.
+		if err := f.src.Truncate(f.idx.end); err != nil {
+			return 0, f.error("write", err)
+		}
+		f.dirty = true
+	}
+	var written int
+	for written < len(p) {
+		n := f.fs.chunkSize - len(f.pending)
+		if n > len(p)-written {
+			n = len(p) - written
+		}
+		f.pending = append(f.pending, p[written:written+n]...)
+		written += n
+		f.off += int64(n)
+		if len(f.pending) == f.fs.chunkSize {
+			if err := f.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush compresses the pending data into a new frame.
+func (f *CompressFile) flush() error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	data, err := f.idx.codec.Compress(f.pending)
+	if err != nil {
+		return f.error("write", err)
+	}
+	frame := make([]byte, compressFrameHeader, compressFrameHeader+len(data))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(f.pending)))
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(data)))
+	frame = append(frame, data...)
+	if _, err := f.src.WriteAt(frame, f.idx.end); err != nil {
+		return f.error("write", err)
+	}
+	f.idx.frames = append(f.idx.frames, compressFrame{offset: f.idx.end, plain: f.idx.size})
+	f.idx.end += int64(len(frame))
+	f.idx.size += int64(len(f.pending))
+	f.pending = f.pending[:0]
+	return nil
+}
+
+// finish writes the pending data, the index and the header of a file
+// written.
+func (f *CompressFile) finish() error {
+	if !f.writable || f.dir || !f.dirty {
+		return nil
+	}
+	if err := f.flush(); err != nil {
+		return err
+	}
+	// The index starts with the header of a frame of no data, which
+	// stops the scan of a file whose header was not written yet.
+	index := make([]byte, compressFrameHeader+4, compressFrameHeader+4+16*len(f.idx.frames))
+	binary.BigEndian.PutUint32(index[4:8], uint32(4+16*len(f.idx.frames)))
+	binary.BigEndian.PutUint32(index[8:12], uint32(len(f.idx.frames)))
+	for _, frame := range f.idx.frames {
+		var entry [16]byte
+		binary.BigEndian.PutUint64(entry[0:8], uint64(frame.offset))
+		binary.BigEndian.PutUint64(entry[8:16], uint64(frame.plain))
+		index = append(index, entry[:]...)
+	}
+	if _, err := f.src.WriteAt(index, f.idx.end); err != nil {
+		return f.error("write", err)
+	}
+	if err := f.src.Truncate(f.idx.end + int64(len(index))); err != nil {
+		return f.error("write", err)
+	}
+	if err := f.writeHeader(f.idx.end); err != nil {
+		return f.error("write", err)
+	}
+	f.dirty = false
+	return nil
+}
+
+// Sync writes the data written so far, and the index, and syncs the file.
+// Syncing often makes for small chunks, which compress less well.
+func (f *CompressFile) Sync() error {
+	f.mu.Lock()
+	err := f.finish()
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return f.src.Sync()
+}
+
+func (f *CompressFile) Close() error {
+	f.mu.Lock()
+	err := f.finish()
+	f.mu.Unlock()
+	if cerr := f.src.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Seek may move anywhere in a file read, but only to the end of a file
+// written.
+func (f *CompressFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dir {
+		return f.src.Seek(offset, whence)
+	}
+	size := f.idx.size + int64(len(f.pending))
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, f.error("seek", os.ErrInvalid)
+	}
+	if f.writable && offset != f.off {
+		return 0, f.error("seek", ErrNotSupported)
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *CompressFile) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := f.src.Readdir(count)
+	for i, fi := range fis {
+		fis[i] = &compressFileInfo{FileInfo: fi, size: f.fs.plainSize(filepath.Join(f.Name(), fi.Name()), fi)}
+	}
+	return fis, err
+}
+
+func (f *CompressFile) Readdirnames(n int) ([]string, error) {
+	return f.src.Readdirnames(n)
+}
+
+func (f *CompressFile) Stat() (os.FileInfo, error) {
+	fi, err := f.src.Stat()
+	if err != nil || f.dir {
+		return fi, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &compressFileInfo{FileInfo: fi, size: f.idx.size + int64(len(f.pending))}, nil
+}
+
+// Truncate only accepts the current size, as compressed data cannot be
+// cut.
+func (f *CompressFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dir {
+		return f.error("truncate", syscall.EISDIR)
+	}
+	if !f.writable {
+		return f.error("truncate", syscall.EBADF)
+	}
+	if size != f.idx.size+int64(len(f.pending)) {
+		return f.error("truncate", ErrNotSupported)
+	}
+	return nil
+}
+
+func (f *CompressFile) Lock(ctx context.Context, exclusive bool) error {
+	return LockFile(ctx, f.src, exclusive)
+}
+
+func (f *CompressFile) TryLock(exclusive bool) error {
+	return TryLockFile(f.src, exclusive)
+}
+
+func (f *CompressFile) Unlock() error {
+	return UnlockFile(f.src)
+}
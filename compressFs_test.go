@@ -0,0 +1,179 @@
+package afero
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
+	"os"
+	"testing"
+)
+
+func compressTestLog(lines int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&buf, "2020-01-01T00:00:%02d INFO request %d served in %dms\n", i%60, i, i%17)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressFsRoundTrip(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewCompressFs(source, CompressOptions{ChunkSize: 1000})
+	content := compressTestLog(2000)
+	if err := WriteFile(fs, "/log", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadFile(fs, "/log")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("expected the content back, got %d bytes, %v", len(data), err)
+	}
+	fi, err := fs.Stat("/log")
+	if err != nil || fi.Size() != int64(len(content)) {
+		t.Errorf("expected the uncompressed size %d, got %v, %v", len(content), fi, err)
+	}
+	raw, _ := source.Stat("/log")
+	if raw.Size()*4 > int64(len(content)) {
+		t.Errorf("expected the log to compress, %d bytes for %d", raw.Size(), len(content))
+	}
+	fis, err := ReadDir(fs, "/")
+	if err != nil || len(fis) != 1 || fis[0].Size() != int64(len(content)) {
+		t.Errorf("expected listings to report the uncompressed size, got %v, %v", fis, err)
+	}
+}
+
+func TestCompressFsRandomReads(t *testing.T) {
+	fs := NewCompressFs(&MemMapFs{}, CompressOptions{ChunkSize: 100})
+	content := compressTestLog(300)
+	WriteFile(fs, "/log", content, 0644)
+	f, err := fs.Open("/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := mathrand.New(mathrand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		off := r.Intn(len(content) + 10)
+		p := make([]byte, r.Intn(300))
+		n, err := f.ReadAt(p, int64(off))
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		want := []byte{}
+		if off < len(content) {
+			want = content[off:]
+		}
+		if len(want) > len(p) {
+			want = want[:len(p)]
+		}
+		if !bytes.Equal(p[:n], want) {
+			t.Fatalf("read %q at %d, want %q", p[:n], off, want)
+		}
+	}
+	if pos, err := f.Seek(-10, io.SeekEnd); err != nil || pos != int64(len(content)-10) {
+		t.Fatalf("expected to seek near the end, got %d, %v", pos, err)
+	}
+	rest, _ := ioutil.ReadAll(f)
+	if !bytes.Equal(rest, content[len(content)-10:]) {
+		t.Errorf("expected the end of the file, got %q", rest)
+	}
+}
+
+func TestCompressFsAppend(t *testing.T) {
+	fs := NewCompressFs(&MemMapFs{}, CompressOptions{ChunkSize: 8})
+	WriteFile(fs, "/log", []byte("first line\n"), 0644)
+	f, err := fs.OpenFile("/log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("second line\n")
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("expected reading a file written to fail")
+	}
+	if _, err := f.WriteAt([]byte("x"), 0); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected writing in the middle to be refused, got %v", err)
+	}
+	f.Close()
+
+	data, err := ReadFile(fs, "/log")
+	if err != nil || string(data) != "first line\nsecond line\n" {
+		t.Errorf("expected both lines, got %q, %v", data, err)
+	}
+}
+
+func TestCompressFsUnclosed(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewCompressFs(source, CompressOptions{ChunkSize: 4})
+	f, _ := fs.Create("/log")
+	f.WriteString("written but never closed")
+	f.Sync()
+	f.WriteString(", and more")
+
+	// The file is read back from its frames, without the index.
+	data, err := ReadFile(fs, "/log")
+	if err != nil || string(data) != "written but never closed, and mo" {
+		t.Errorf("expected the complete chunks, got %q, %v", data, err)
+	}
+	f.Close()
+	if data, _ := ReadFile(fs, "/log"); string(data) != "written but never closed, and more" {
+		t.Errorf("expected the whole file once closed, got %q", data)
+	}
+
+	WriteFile(source, "/plain", []byte("plain"), 0644)
+	if _, err := fs.Open("/plain"); !errors.Is(err, ErrNotCompressed) {
+		t.Errorf("expected ErrNotCompressed, got %v", err)
+	}
+	if fi, err := fs.Stat("/plain"); err != nil || fi.Size() != 5 {
+		t.Errorf("expected the size of a plain file as is, got %v, %v", fi, err)
+	}
+}
+
+func TestCompressFsCorruptIndex(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewCompressFs(source, CompressOptions{ChunkSize: 4})
+	if err := WriteFile(fs, "/log", []byte("some content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ReadFile(source, "/log")
+	index := int(binary.BigEndian.Uint64(data[20:28]))
+
+	for name, corrupt := range map[string]func(p []byte){
+		"no frames":     func(p []byte) { binary.BigEndian.PutUint32(p[index+8:], 0) },
+		"large count":   func(p []byte) { binary.BigEndian.PutUint32(p[index+8:], 1<<31) },
+		"bad offset":    func(p []byte) { binary.BigEndian.PutUint64(p[index+12+16:], 1<<40) },
+		"out of order":  func(p []byte) { binary.BigEndian.PutUint64(p[index+12+16+8:], 0) },
+		"index offset":  func(p []byte) { binary.BigEndian.PutUint64(p[20:28], 4) },
+		"negative size": func(p []byte) { binary.BigEndian.PutUint64(p[12:20], 1<<63) },
+	} {
+		p := append([]byte(nil), data...)
+		corrupt(p)
+		WriteFile(source, "/corrupt", p, 0644)
+		if _, err := ReadFile(fs, "/corrupt"); !errors.Is(err, ErrNotCompressed) {
+			t.Errorf("%s: expected ErrNotCompressed, got %v", name, err)
+		}
+	}
+}
+
+func TestCompressFsCrashBeforeHeader(t *testing.T) {
+	source := &MemMapFs{}
+	fs := NewCompressFs(source, CompressOptions{ChunkSize: 4})
+	if err := WriteFile(fs, "/log", []byte("some content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index was written, but the header still says it is not.
+	data, _ := ReadFile(source, "/log")
+	binary.BigEndian.PutUint64(data[20:28], 0)
+	WriteFile(source, "/log", data, 0644)
+	if data, err := ReadFile(fs, "/log"); err != nil || string(data) != "some content" {
+		t.Errorf("expected the frames before the index, got %q, %v", data, err)
+	}
+	if fi, err := fs.Stat("/log"); err != nil || fi.Size() != 12 {
+		t.Errorf("expected the size of the frames, got %v, %v", fi, err)
+	}
+}
@@ -1,7 +1,7 @@
 package afero
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -32,15 +32,8 @@ func (u *CopyOnWriteFs) isBaseFile(name string) (bool, error) {
 		return false, nil
 	}
 	_, err := u.base.Stat(name)
-	if err != nil {
-		if oerr, ok := err.(*os.PathError); ok {
-			if oerr.Err == os.ErrNotExist || oerr.Err == syscall.ENOENT || oerr.Err == syscall.ENOTDIR {
-				return false, nil
-			}
-		}
-		if err == syscall.ENOENT {
-			return false, nil
-		}
+	if err != nil && u.isNotExist(err) {
+		return false, nil
 	}
 	return true, err
 }
@@ -150,14 +143,73 @@ func (u *CopyOnWriteFs) ReadlinkIfPossible(name string) (string, error) {
 	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
 }
 
-func (u *CopyOnWriteFs) isNotExist(err error) bool {
-	if e, ok := err.(*os.PathError); ok {
-		err = e.Err
+// Statfs reports the capacity of the layer, which all writes go to.
+func (u *CopyOnWriteFs) Statfs(name string) (*FsStats, error) {
+	if _, err := u.Stat(name); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: underlyingError(err)}
+	}
+	return statfsExisting(u.layer, name)
+}
+
+// xattrSource returns the layer the extended attributes of name are read
+// from.
+func (u *CopyOnWriteFs) xattrSource(name string) Fs {
+	if _, err := u.layer.Stat(name); err == nil {
+		return u.layer
+	}
+	return u.base
+}
+
+func (u *CopyOnWriteFs) GetXattr(name, attr string) ([]byte, error) {
+	if x, ok := u.xattrSource(name).(Xattrer); ok {
+		return x.GetXattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (u *CopyOnWriteFs) ListXattr(name string) ([]string, error) {
+	if x, ok := u.xattrSource(name).(Xattrer); ok {
+		return x.ListXattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (u *CopyOnWriteFs) SetXattr(name, attr string, value []byte) error {
+	x, ok := u.layer.(Xattrer)
+	if !ok {
+		return &os.PathError{Op: "setxattr", Path: name, Err: ErrNoXattr}
+	}
+	b, err := u.isBaseFile(name)
+	if err != nil {
+		return err
+	}
+	if b {
+		if err := u.copyToLayer(name); err != nil {
+			return err
+		}
+	}
+	return x.SetXattr(name, attr, value)
+}
+
+func (u *CopyOnWriteFs) RemoveXattr(name, attr string) error {
+	x, ok := u.layer.(Xattrer)
+	if !ok {
+		return &os.PathError{Op: "removexattr", Path: name, Err: ErrNoXattr}
 	}
-	if err == os.ErrNotExist || err == syscall.ENOENT || err == syscall.ENOTDIR {
-		return true
+	b, err := u.isBaseFile(name)
+	if err != nil {
+		return err
 	}
-	return false
+	if b {
+		if err := u.copyToLayer(name); err != nil {
+			return err
+		}
+	}
+	return x.RemoveXattr(name, attr)
+}
+
+func (u *CopyOnWriteFs) isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
 }
 
 // Renaming files present only in the base layer is not permitted
@@ -167,7 +219,7 @@ func (u *CopyOnWriteFs) Rename(oldname, newname string) error {
 		return err
 	}
 	if b {
-		return syscall.EPERM
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EPERM}
 	}
 	return u.layer.Rename(oldname, newname)
 }
@@ -177,30 +229,24 @@ func (u *CopyOnWriteFs) Rename(oldname, newname string) error {
 // will be removed.
 func (u *CopyOnWriteFs) Remove(name string) error {
 	err := u.layer.Remove(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
+	if err == nil || !u.isNotExist(err) {
 		return err
 	}
+	if _, berr := u.base.Stat(name); berr == nil {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOENT}
 }
 
 func (u *CopyOnWriteFs) RemoveAll(name string) error {
 	err := u.layer.RemoveAll(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
+	if err == nil || !u.isNotExist(err) {
 		return err
 	}
+	if _, berr := u.base.Stat(name); berr == nil {
+		return &os.PathError{Op: "remove_all", Path: name, Err: syscall.EPERM}
+	}
+	return &os.PathError{Op: "remove_all", Path: name, Err: syscall.ENOENT}
 }
 
 func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
@@ -286,9 +332,17 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 	bfile, bErr := u.base.Open(name)
 	lfile, lErr := u.layer.Open(name)
 
-	// If either have errors at this point something is very wrong. Return nil and the errors
+	// If either have errors at this point something is very wrong. Close
+	// whatever was opened and return the first error.
 	if bErr != nil || lErr != nil {
-		return nil, fmt.Errorf("BaseErr: %v\nOverlayErr: %v", bErr, lErr)
+		if bErr == nil {
+			bfile.Close()
+			return nil, lErr
+		}
+		if lErr == nil {
+			lfile.Close()
+		}
+		return nil, bErr
 	}
 
 	return &UnionFile{Base: bfile, Layer: lfile}, nil
@@ -300,11 +354,47 @@ func (u *CopyOnWriteFs) Mkdir(name string, perm os.FileMode) error {
 		return u.layer.MkdirAll(name, perm)
 	}
 	if dir {
-		return ErrFileExists
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrFileExists}
 	}
 	return u.layer.MkdirAll(name, perm)
 }
 
+// Watch delivers the events of both layers. Events of the base layer are
+// dropped for entries present in the overlay, which hides them. The
+// overlay is watched even if name does not exist there yet, as that is
+// where changes made through the CopyOnWriteFs end up.
+func (u *CopyOnWriteFs) Watch(name string, recursive bool) (Watch, error) {
+	var sources []Watch
+	lw, err := watchExisting(u.layer, name, recursive)
+	if err == nil {
+		sources = append(sources, lw)
+	} else if !errors.Is(err, ErrNoWatch) {
+		return nil, err
+	}
+	if _, serr := u.base.Stat(name); serr == nil {
+		if watcher, ok := u.base.(Watcher); ok {
+			bw, err := watcher.Watch(name, recursive)
+			if err != nil {
+				if lw != nil {
+					lw.Close()
+				}
+				return nil, err
+			}
+			sources = append(sources, newFilteredWatch(func(ev Event) (Event, bool) {
+				_, err := u.layer.Stat(ev.Name)
+				return ev, err != nil
+			}, bw))
+		}
+	}
+	if len(sources) == 0 {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: ErrNoWatch}
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return newFilteredWatch(func(ev Event) (Event, bool) { return ev, true }, sources...), nil
+}
+
 func (u *CopyOnWriteFs) Name() string {
 	return "CopyOnWriteFs"
 }
@@ -0,0 +1,329 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+var _ Lstater = (*CrashFs)(nil)
+
+// MaxCrashPending is the most files and directories with changes not yet
+// synced whose crash states CrashStates enumerates, 2^MaxCrashPending
+// states already being more than tests can go through.
+const MaxCrashPending = 20
+
+// ErrTooManyCrashStates is returned by CrashStates when more than
+// MaxCrashPending files and directories have changes not yet synced.
+var ErrTooManyCrashStates = errors.New("too many changes not synced to enumerate the crash states")
+
+// The CrashFs is an in-memory filesystem simulating what survives a power
+// loss, to test the recovery of code such as write-ahead logs.
+//
+// It keeps apart the volatile state, seen by its users, and the durable
+// state, which is what a crash leaves behind. The content of a file becomes
+// durable when Sync is called on one of its handles, and the entries of a
+// directory, i.e. the files created, removed or renamed in it, when Sync is
+// called on a handle of the directory itself, as with fsync(2).
+// Only contents and entries are modelled: modes and times after a crash
+// are the current ones.
+type CrashFs struct {
+	source *MemMapFs
+
+	mu sync.Mutex
+	// files holds the content of the files at their last Sync.
+	files map[*mem.FileData][]byte
+	// dirs holds the entries of the directories at their last Sync.
+	dirs map[*mem.FileData]map[string]*mem.FileData
+}
+
+// NewCrashFs returns an empty CrashFs.
+func NewCrashFs() *CrashFs {
+	c := &CrashFs{
+		source: &MemMapFs{},
+		files:  make(map[*mem.FileData][]byte),
+		dirs:   make(map[*mem.FileData]map[string]*mem.FileData),
+	}
+	c.dirs[c.root()] = map[string]*mem.FileData{}
+	return c
+}
+
+func (c *CrashFs) root() *mem.FileData {
+	root, _ := c.source.open(FilePathSeparator)
+	return root
+}
+
+// Crash returns the state left by a crash in which nothing that was not
+// synced survived. It is a new CrashFs, whose state is all durable; c is
+// left unchanged.
+func (c *CrashFs) Crash() *CrashFs {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.crashed(nil)
+}
+
+// CrashStates calls fn with each state a crash could leave, until fn
+// returns an error, which CrashStates then returns.
+//
+// Each file whose content and each directory whose entries changed since
+// they were last synced independently survive in either their synced or
+// their current state, so that for n of them fn is called 2^n times. This
+// covers, for example, a write which was lost while the rename made after
+// it was not, which real filesystems may do unless told otherwise.
+// The states are new CrashFs, whose state is all durable; c is left
+// unchanged. With more than MaxCrashPending files and directories
+// changed, CrashStates fails with ErrTooManyCrashStates without calling
+// fn.
+//
+// Files are modelled as surviving whole: the states in which a write
+// survived only in part, such as a prefix of an append or some of the
+// blocks written, are not enumerated, though real filesystems can leave
+// them.
+func (c *CrashFs) CrashStates(fn func(*CrashFs) error) error {
+	c.mu.Lock()
+	pending := c.pending()
+	c.mu.Unlock()
+	if len(pending) > MaxCrashPending {
+		return ErrTooManyCrashStates
+	}
+
+	for set := uint64(0); set < 1<<uint(len(pending)); set++ {
+		current := make(map[*mem.FileData]bool)
+		for i, f := range pending {
+			if set&(1<<uint(i)) != 0 {
+				current[f] = true
+			}
+		}
+		c.mu.Lock()
+		state := c.crashed(current)
+		c.mu.Unlock()
+		if err := fn(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pending returns the files and directories with changes not yet synced,
+// reachable from the root in the synced or current state, in a stable
+// order.
+func (c *CrashFs) pending() []*mem.FileData {
+	var pending []*mem.FileData
+	seen := make(map[*mem.FileData]bool)
+	var walk func(f *mem.FileData)
+	walk = func(f *mem.FileData) {
+		if seen[f] {
+			return
+		}
+		seen[f] = true
+		if !mem.GetFileInfo(f).IsDir() {
+			if !bytes.Equal(c.files[f], crashFileData(f)) {
+				pending = append(pending, f)
+			}
+			return
+		}
+		durable, current := c.dirs[f], crashDirEntries(f)
+		if !crashSameEntries(durable, current) {
+			pending = append(pending, f)
+		}
+		for _, entries := range []map[string]*mem.FileData{durable, current} {
+			for _, name := range crashSortedNames(entries) {
+				walk(entries[name])
+			}
+		}
+	}
+	walk(c.root())
+	return pending
+}
+
+// crashed builds the state in which the files and directories in current
+// are in their current state, and all others in their synced state.
+func (c *CrashFs) crashed(current map[*mem.FileData]bool) *CrashFs {
+	n := NewCrashFs()
+	var build func(dir *mem.FileData, path string, ancestors map[*mem.FileData]bool)
+	build = func(dir *mem.FileData, path string, ancestors map[*mem.FileData]bool) {
+		ancestors[dir] = true
+		defer delete(ancestors, dir)
+
+		entries := c.dirs[dir]
+		if current[dir] {
+			entries = crashDirEntries(dir)
+		}
+		for _, name := range crashSortedNames(entries) {
+			f := entries[name]
+			p := filepath.Join(path, name)
+			fi := mem.GetFileInfo(f)
+			if fi.IsDir() {
+				// A directory moved into one of its own descendants
+				// in one state but not the other cannot be rebuilt.
+				if ancestors[f] {
+					continue
+				}
+				n.source.Mkdir(p, fi.Mode().Perm())
+				n.source.Chmod(p, fi.Mode())
+				build(f, p, ancestors)
+			} else {
+				data := c.files[f]
+				if current[f] {
+					data = crashFileData(f)
+				}
+				WriteFile(n.source, p, data, fi.Mode().Perm())
+				n.source.Chmod(p, fi.Mode())
+			}
+			n.source.Chtimes(p, fi.ModTime(), fi.ModTime())
+		}
+	}
+	build(c.root(), FilePathSeparator, make(map[*mem.FileData]bool))
+	n.syncAll()
+	return n
+}
+
+// syncAll makes the whole current state durable.
+func (c *CrashFs) syncAll() {
+	var walk func(f *mem.FileData)
+	walk = func(f *mem.FileData) {
+		if !mem.GetFileInfo(f).IsDir() {
+			c.files[f] = crashFileData(f)
+			return
+		}
+		entries := crashDirEntries(f)
+		c.dirs[f] = entries
+		for _, e := range entries {
+			walk(e)
+		}
+	}
+	walk(c.root())
+}
+
+func (c *CrashFs) sync(f *mem.FileData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if mem.GetFileInfo(f).IsDir() {
+		c.dirs[f] = crashDirEntries(f)
+	} else {
+		c.files[f] = crashFileData(f)
+	}
+}
+
+func crashFileData(f *mem.FileData) []byte {
+	data, _ := ioutil.ReadAll(mem.NewReadOnlyFileHandle(f))
+	return data
+}
+
+func crashDirEntries(dir *mem.FileData) map[string]*mem.FileData {
+	entries := make(map[string]*mem.FileData)
+	fis, _ := mem.NewReadOnlyFileHandle(dir).Readdir(-1)
+	for _, fi := range fis {
+		entries[fi.Name()] = fi.(*mem.FileInfo).FileData
+	}
+	return entries
+}
+
+func crashSameEntries(a, b map[string]*mem.FileData) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, f := range a {
+		if b[name] != f {
+			return false
+		}
+	}
+	return true
+}
+
+func crashSortedNames(entries map[string]*mem.FileData) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *CrashFs) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &CrashFile{lockingFile: lockingFile{f}, fs: c}, nil
+}
+
+func (c *CrashFs) Name() string {
+	return "CrashFs"
+}
+
+func (c *CrashFs) Create(name string) (File, error) {
+	return c.wrap(c.source.Create(name))
+}
+
+func (c *CrashFs) Open(name string) (File, error) {
+	return c.wrap(c.source.Open(name))
+}
+
+func (c *CrashFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return c.wrap(c.source.OpenFile(name, flag, perm))
+}
+
+func (c *CrashFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *CrashFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *CrashFs) Remove(name string) error {
+	return c.source.Remove(name)
+}
+
+func (c *CrashFs) RemoveAll(path string) error {
+	return c.source.RemoveAll(path)
+}
+
+func (c *CrashFs) Rename(oldname, newname string) error {
+	return c.source.Rename(oldname, newname)
+}
+
+func (c *CrashFs) Stat(name string) (os.FileInfo, error) {
+	return c.source.Stat(name)
+}
+
+func (c *CrashFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	return c.source.LstatIfPossible(name)
+}
+
+func (c *CrashFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *CrashFs) Chown(name string, uid, gid int) error {
+	return c.source.Chown(name, uid, gid)
+}
+
+func (c *CrashFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+// CrashFile is a file opened through a CrashFs.
+type CrashFile struct {
+	lockingFile
+	fs *CrashFs
+}
+
+// Sync makes the content of the file, or the entries of the directory,
+// durable.
+func (f *CrashFile) Sync() error {
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	if mf, ok := f.File.(*mem.File); ok {
+		f.fs.sync(mf.Data())
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package afero
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func crashSync(t *testing.T, fs Fs, name string) {
+	t.Helper()
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestCrashFsSync(t *testing.T) {
+	fs := NewCrashFs()
+	f, err := fs.Create("/wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("first;")
+	f.Sync()
+	crashSync(t, fs, "/")
+	f.WriteString("second;")
+	f.Close()
+	WriteFile(fs, "/unsynced", []byte("lost"), 0644)
+
+	crashed := fs.Crash()
+	data, err := ReadFile(crashed, "/wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first;" {
+		t.Errorf("expected only the synced write, got %q", data)
+	}
+	if _, err := crashed.Stat("/unsynced"); !os.IsNotExist(err) {
+		t.Errorf("expected the file not synced in its directory to be lost, got %v", err)
+	}
+
+	// The volatile state is left alone.
+	if data, _ := ReadFile(fs, "/wal"); string(data) != "first;second;" {
+		t.Errorf("expected the current content, got %q", data)
+	}
+	// The state after a crash is durable.
+	if data, _ := ReadFile(crashed.Crash(), "/wal"); string(data) != "first;" {
+		t.Errorf("expected the content to survive a second crash, got %q", data)
+	}
+}
+
+func TestCrashFsDirectories(t *testing.T) {
+	fs := NewCrashFs()
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	WriteFile(fs, "/a/b/f", []byte("x"), 0644)
+	crashSync(t, fs, "/a/b/f")
+	crashSync(t, fs, "/a/b")
+	crashSync(t, fs, "/a")
+
+	// /a is not synced in the root, so nothing below it survives.
+	if _, err := fs.Crash().Stat("/a"); !os.IsNotExist(err) {
+		t.Errorf("expected /a to be lost, got %v", err)
+	}
+
+	crashSync(t, fs, "/")
+	if data, err := ReadFile(fs.Crash(), "/a/b/f"); err != nil || string(data) != "x" {
+		t.Errorf("expected the synced tree to survive, got %q, %v", data, err)
+	}
+
+	if err := fs.Rename("/a/b/f", "/a/g"); err != nil {
+		t.Fatal(err)
+	}
+	crashSync(t, fs, "/a")
+	crashed := fs.Crash()
+	for _, name := range []string{"/a/b/f", "/a/g"} {
+		if _, err := crashed.Stat(name); err != nil {
+			t.Errorf("expected %s to exist when only the new directory is synced: %v", name, err)
+		}
+	}
+}
+
+func crashStates(t *testing.T, fs *CrashFs, name string) map[string]int {
+	t.Helper()
+	seen := make(map[string]int)
+	err := fs.CrashStates(func(state *CrashFs) error {
+		data, err := ReadFile(state, name)
+		if os.IsNotExist(err) {
+			seen["<missing>"]++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seen[string(data)]++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return seen
+}
+
+func TestCrashFsStatesAtomicReplace(t *testing.T) {
+	fs := NewCrashFs()
+	if err := WriteFileAtomic(fs, "/state", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seen := crashStates(t, fs, "/state")
+	if len(seen) != 1 || seen["old"] != 1 {
+		t.Errorf("expected a single state once everything is synced, got %v", seen)
+	}
+
+	// Replace the file as WriteFileAtomic does, but stop before the
+	// directory is synced.
+	WriteFile(fs, "/.state.tmp", []byte("new"), 0644)
+	crashSync(t, fs, "/.state.tmp")
+	if err := fs.Rename("/.state.tmp", "/state"); err != nil {
+		t.Fatal(err)
+	}
+	seen = crashStates(t, fs, "/state")
+	if len(seen) != 2 || seen["old"] == 0 || seen["new"] == 0 {
+		t.Errorf("expected either content, got %v", seen)
+	}
+}
+
+func TestCrashFsStatesUnsyncedRename(t *testing.T) {
+	fs := NewCrashFs()
+	WriteFile(fs, "/state", []byte("old"), 0644)
+	crashSync(t, fs, "/state")
+	crashSync(t, fs, "/")
+
+	// Without syncing the new content first, the rename may survive
+	// while the content does not.
+	WriteFile(fs, "/.state.tmp", []byte("new"), 0644)
+	if err := fs.Rename("/.state.tmp", "/state"); err != nil {
+		t.Fatal(err)
+	}
+	seen := crashStates(t, fs, "/state")
+	if seen[""] == 0 || seen["old"] == 0 || seen["new"] == 0 {
+		t.Errorf("expected an empty file among the states, got %v", seen)
+	}
+	if n := seen[""] + seen["old"] + seen["new"]; n != 4 {
+		t.Errorf("expected 4 states for 2 pending changes, got %d", n)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := fs.CrashStates(func(*CrashFs) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected CrashStates to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestCrashFsTooManyStates(t *testing.T) {
+	fs := NewCrashFs()
+	for i := 0; i < 64; i++ {
+		WriteFile(fs, fmt.Sprintf("/f%d", i), []byte("data"), 0644)
+	}
+	calls := 0
+	err := fs.CrashStates(func(*CrashFs) error {
+		calls++
+		return nil
+	})
+	if err != ErrTooManyCrashStates || calls != 0 {
+		t.Errorf("expected ErrTooManyCrashStates, got %v after %d calls", err, calls)
+	}
+}
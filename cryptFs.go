@@ -0,0 +1,767 @@
+package afero
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ Lstater = (*CryptFs)(nil)
+
+// A KeyProvider provides the keys a CryptFs encrypts files with. Keys are
+// AES keys of 16, 24 or 32 bytes, named by an id of at most 39 bytes which
+// is stored in the header of the files, so that keys can be rotated.
+type KeyProvider interface {
+	// CurrentKey returns the key new files are encrypted with.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given id.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory.
+type StaticKeys struct {
+	// Current is the id of the key new files are encrypted with.
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, ErrCryptKey
+	}
+	return key, nil
+}
+
+var (
+	// ErrCryptKey is returned by StaticKeys for unknown key ids.
+	ErrCryptKey = errors.New("unknown encryption key")
+	// ErrNotEncrypted is the error that will be wrapped in an
+	// *os.PathError if a file read through a CryptFs was not written by
+	// one with the same chunk size.
+	ErrNotEncrypted = WrapError(os.ErrInvalid, errors.New("not an encrypted file"))
+	// ErrCryptAuth is the error that will be wrapped in an *os.PathError
+	// if encrypted data was altered.
+	ErrCryptAuth = errors.New("encrypted data failed authentication")
+)
+
+// CryptOptions are the options of a CryptFs.
+type CryptOptions struct {
+	// ChunkSize is the number of plaintext bytes encrypted together,
+	// 64 KiB if zero. It must not change for a given tree.
+	ChunkSize int
+	// NameKey, if set, is the key the names of files and directories
+	// are encrypted with. It must not change for a given tree.
+	NameKey []byte
+}
+
+const (
+	cryptMagic       = "AFC1"
+	cryptHeaderSize  = 64
+	cryptMaxKeyID    = cryptHeaderSize - len(cryptMagic) - 4 - 1 - cryptFileIDSize
+	cryptFileIDSize  = 16
+	cryptNonceSize   = 12
+	cryptOverhead    = cryptNonceSize + 16
+	cryptDefaultSize = 64 << 10
+)
+
+// The CryptFs encrypts the content of the files of a source filesystem,
+// and optionally their names, so that they can be stored on untrusted
+// storage such as s3fs or sftpfs.
+//
+// The content of a file is encrypted with AES-GCM in chunks of a fixed
+// size, each authenticated along with its position in the file, so that
+// ReadAt, WriteAt and Seek only need the chunks they touch and Stat reports
+// plaintext sizes without reading the file. A file starts with a header
+// naming its key, which lets keys be rotated: existing files keep being
+// read with the key they were written with.
+//
+// A handle reads the size and the header of its file again before each
+// operation, so that the writes of other handles, possibly of other
+// CryptFs over the same source, are seen. Writes of different handles to
+// the same chunk must not be concurrent.
+//
+// Names are encrypted deterministically, one path element at a time, so
+// that looking up a file needs no index. Entries whose names cannot be
+// decrypted are left out of directory listings.
+type CryptFs struct {
+	source    Fs
+	keys      KeyProvider
+	chunkSize int
+
+	names    cipher.AEAD // nil if names are not encrypted
+	namesMAC []byte
+}
+
+func NewCryptFs(source Fs, keys KeyProvider, opts CryptOptions) (*CryptFs, error) {
+	c := &CryptFs{source: source, keys: keys, chunkSize: opts.ChunkSize}
+	if c.chunkSize <= 0 {
+		c.chunkSize = cryptDefaultSize
+	}
+	if opts.NameKey != nil {
+		encKey := cryptDeriveKey(opts.NameKey, "afero name encryption")
+		aead, err := cryptAEAD(encKey)
+		if err != nil {
+			return nil, err
+		}
+		c.names = aead
+		c.namesMAC = cryptDeriveKey(opts.NameKey, "afero name nonce")
+	}
+	return c, nil
+}
+
+func cryptDeriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func cryptAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptName encrypts a name with a nonce derived from it, so that the
+// same name always gives the same result.
+func (c *CryptFs) encryptName(name string) string {
+	mac := hmac.New(sha256.New, c.namesMAC)
+	mac.Write([]byte(name))
+	nonce := mac.Sum(nil)[:cryptNonceSize]
+	return base64.RawURLEncoding.EncodeToString(c.names.Seal(nonce, nonce, []byte(name), nil))
+}
+
+func (c *CryptFs) decryptName(name string) (string, bool) {
+	if c.names == nil {
+		return name, true
+	}
+	b, err := base64.RawURLEncoding.DecodeString(name)
+	if err != nil || len(b) < cryptOverhead {
+		return "", false
+	}
+	plain, err := c.names.Open(nil, b[:cryptNonceSize], b[cryptNonceSize:], nil)
+	if err != nil {
+		return "", false
+	}
+	return string(plain), true
+}
+
+// realPath returns the path of name in the source filesystem.
+func (c *CryptFs) realPath(name string) string {
+	if c.names == nil {
+		return name
+	}
+	elems := strings.Split(filepath.Clean(name), string(filepath.Separator))
+	for i, e := range elems {
+		if e != "" && e != "." && e != ".." {
+			elems[i] = c.encryptName(e)
+		}
+	}
+	return strings.Join(elems, string(filepath.Separator))
+}
+
+// plainSize returns the size of the plaintext of an encrypted file of the
+// given size.
+func (c *CryptFs) plainSize(size int64) int64 {
+	n := size - cryptHeaderSize
+	if n <= 0 {
+		return 0
+	}
+	chunk := int64(c.chunkSize + cryptOverhead)
+	plain := n / chunk * int64(c.chunkSize)
+	if rem := n % chunk; rem > cryptOverhead {
+		plain += rem - cryptOverhead
+	}
+	return plain
+}
+
+// cryptFileInfo reports the plaintext name and size of a file.
+type cryptFileInfo struct {
+	os.FileInfo
+	name string
+	size int64
+}
+
+func (fi *cryptFileInfo) Name() string { return fi.name }
+func (fi *cryptFileInfo) Size() int64  { return fi.size }
+
+func (c *CryptFs) fileInfo(fi os.FileInfo, name string) os.FileInfo {
+	size := fi.Size()
+	if fi.Mode().IsRegular() {
+		size = c.plainSize(size)
+	}
+	return &cryptFileInfo{FileInfo: fi, name: name, size: size}
+}
+
+func (c *CryptFs) Name() string {
+	return "CryptFs"
+}
+
+func (c *CryptFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *CryptFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *CryptFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	// Writing a part of a chunk needs reading the rest of it, and
+	// appending is done with WriteAt.
+	srcFlag := flag &^ os.O_APPEND
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if writable {
+		srcFlag = srcFlag&^os.O_WRONLY | os.O_RDWR
+	}
+	src, err := c.source.OpenFile(c.realPath(name), srcFlag, perm)
+	if err != nil {
+		return nil, cryptPathError(err, name)
+	}
+	f := &CryptFile{
+		fs:       c,
+		src:      src,
+		name:     name,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}
+	if err := f.init(); err != nil {
+		src.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// cryptPathError replaces the path of an *os.PathError from the source by
+// name, not to leak encrypted names.
+func cryptPathError(err error, name string) error {
+	if perr, ok := err.(*os.PathError); ok {
+		return &os.PathError{Op: perr.Op, Path: name, Err: perr.Err}
+	}
+	return err
+}
+
+func (c *CryptFs) Mkdir(name string, perm os.FileMode) error {
+	return cryptPathError(c.source.Mkdir(c.realPath(name), perm), name)
+}
+
+func (c *CryptFs) MkdirAll(path string, perm os.FileMode) error {
+	return cryptPathError(c.source.MkdirAll(c.realPath(path), perm), path)
+}
+
+func (c *CryptFs) Remove(name string) error {
+	return cryptPathError(c.source.Remove(c.realPath(name)), name)
+}
+
+func (c *CryptFs) RemoveAll(path string) error {
+	return cryptPathError(c.source.RemoveAll(c.realPath(path)), path)
+}
+
+func (c *CryptFs) Rename(oldname, newname string) error {
+	if err := c.source.Rename(c.realPath(oldname), c.realPath(newname)); err != nil {
+		if lerr, ok := err.(*os.LinkError); ok {
+			return &os.LinkError{Op: lerr.Op, Old: oldname, New: newname, Err: lerr.Err}
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *CryptFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := c.source.Stat(c.realPath(name))
+	if err != nil {
+		return nil, cryptPathError(err, name)
+	}
+	return c.fileInfo(fi, filepath.Base(name)), nil
+}
+
+func (c *CryptFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	lstater, ok := c.source.(Lstater)
+	if !ok {
+		fi, err := c.Stat(name)
+		return fi, false, err
+	}
+	fi, lstat, err := lstater.LstatIfPossible(c.realPath(name))
+	if err != nil {
+		return nil, lstat, cryptPathError(err, name)
+	}
+	return c.fileInfo(fi, filepath.Base(name)), lstat, nil
+}
+
+func (c *CryptFs) Chmod(name string, mode os.FileMode) error {
+	return cryptPathError(c.source.Chmod(c.realPath(name), mode), name)
+}
+
+func (c *CryptFs) Chown(name string, uid, gid int) error {
+	return cryptPathError(c.source.Chown(c.realPath(name), uid, gid), name)
+}
+
+func (c *CryptFs) Chtimes(name string, atime, mtime time.Time) error {
+	return cryptPathError(c.source.Chtimes(c.realPath(name), atime, mtime), name)
+}
+
+// CryptFile is a file opened through a CryptFs.
+type CryptFile struct {
+	fs   *CryptFs
+	src  File
+	name string
+
+	readable, writable, append bool
+
+	mu     sync.Mutex
+	dir    bool
+	aead   cipher.AEAD
+	fileID []byte
+	size   int64 // of the plaintext
+	off    int64
+}
+
+// init reads the header of the file, or writes it if the file is empty.
+func (f *CryptFile) init() error {
+	fi, err := f.src.Stat()
+	if err != nil {
+		return cryptPathError(err, f.name)
+	}
+	if fi.IsDir() {
+		f.dir = true
+		return nil
+	}
+	return f.load(fi.Size())
+}
+
+// refresh loads the file again before an operation, as other handles may
+// have written it since.
+func (f *CryptFile) refresh() error {
+	if f.dir {
+		return nil
+	}
+	fi, err := f.src.Stat()
+	if err != nil {
+		return cryptPathError(err, f.name)
+	}
+	return f.load(fi.Size())
+}
+
+// load reads the header and the plaintext size of the file, of the given
+// size in the source, or writes the header if the file is empty. The key
+// is only looked up again if the header was written again since.
+func (f *CryptFile) load(size int64) error {
+	if size == 0 {
+		if !f.writable {
+			f.size = 0
+			return nil
+		}
+		return f.writeHeader()
+	}
+
+	header := make([]byte, cryptHeaderSize)
+	if _, err := f.src.ReadAt(header, 0); err != nil {
+		return f.error("open", ErrNotEncrypted)
+	}
+	idLen := int(header[8])
+	if string(header[:4]) != cryptMagic || idLen > cryptMaxKeyID ||
+		binary.BigEndian.Uint32(header[4:8]) != uint32(f.fs.chunkSize) {
+		return f.error("open", ErrNotEncrypted)
+	}
+	if fileID := header[cryptHeaderSize-cryptFileIDSize:]; f.aead == nil || !bytes.Equal(fileID, f.fileID) {
+		key, err := f.fs.keys.Key(string(header[9 : 9+idLen]))
+		if err != nil {
+			return f.error("open", err)
+		}
+		if f.aead, err = cryptAEAD(key); err != nil {
+			return f.error("open", err)
+		}
+		f.fileID = fileID
+	}
+	f.size = f.fs.plainSize(size)
+	return nil
+}
+
+// writeHeader starts an empty file with the current key.
+func (f *CryptFile) writeHeader() error {
+	id, key, err := f.fs.keys.CurrentKey()
+	if err != nil {
+		return f.error("open", err)
+	}
+	if len(id) > cryptMaxKeyID {
+		return f.error("open", errors.New("encryption key id too long"))
+	}
+	if f.aead, err = cryptAEAD(key); err != nil {
+		return f.error("open", err)
+	}
+	header := make([]byte, cryptHeaderSize)
+	copy(header, cryptMagic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(f.fs.chunkSize))
+	header[8] = byte(len(id))
+	copy(header[9:], id)
+	f.fileID = header[cryptHeaderSize-cryptFileIDSize:]
+	if _, err := io.ReadFull(cryptorand.Reader, f.fileID); err != nil {
+		return f.error("open", err)
+	}
+	if _, err := f.src.WriteAt(header, 0); err != nil {
+		return cryptPathError(err, f.name)
+	}
+	// Even an empty file has a last chunk, so that removing chunks from
+	// its end is detected.
+	f.size = 0
+	return f.writeChunk(0, nil, true)
+}
+
+func (f *CryptFile) error(op string, err error) error {
+	return &os.PathError{Op: op, Path: f.name, Err: err}
+}
+
+// chunks returns the number of chunks of a file of the given size.
+func (f *CryptFile) chunks(size int64) int64 {
+	n := (size + int64(f.fs.chunkSize) - 1) / int64(f.fs.chunkSize)
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+func (f *CryptFile) chunkOffset(i int64) int64 {
+	return cryptHeaderSize + i*int64(f.fs.chunkSize+cryptOverhead)
+}
+
+// chunkAAD returns the data a chunk is authenticated with: the file it
+// belongs to, its index and whether it is the last one.
+func (f *CryptFile) chunkAAD(i int64, last bool) []byte {
+	aad := make([]byte, cryptFileIDSize+9)
+	copy(aad, f.fileID)
+	binary.BigEndian.PutUint64(aad[cryptFileIDSize:], uint64(i))
+	if last {
+		aad[cryptFileIDSize+8] = 1
+	}
+	return aad
+}
+
+// readChunk returns the plaintext of chunk i.
+func (f *CryptFile) readChunk(i int64) ([]byte, error) {
+	if f.aead == nil {
+		return nil, nil
+	}
+	n := int64(f.fs.chunkSize)
+	if end := f.size - i*n; end < n {
+		n = end
+	}
+	buf := make([]byte, n+cryptOverhead)
+	if _, err := f.src.ReadAt(buf, f.chunkOffset(i)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, f.error("read", err)
+	}
+	last := i == f.chunks(f.size)-1
+	plain, err := f.aead.Open(nil, buf[:cryptNonceSize], buf[cryptNonceSize:], f.chunkAAD(i, last))
+	if err != nil {
+		return nil, f.error("read", ErrCryptAuth)
+	}
+	return plain, nil
+}
+
+func (f *CryptFile) writeChunk(i int64, plain []byte, last bool) error {
+	buf := make([]byte, cryptNonceSize, cryptNonceSize+len(plain)+16)
+	if _, err := io.ReadFull(cryptorand.Reader, buf); err != nil {
+		return f.error("write", err)
+	}
+	buf = f.aead.Seal(buf, buf, plain, f.chunkAAD(i, last))
+	if _, err := f.src.WriteAt(buf, f.chunkOffset(i)); err != nil {
+		return cryptPathError(err, f.name)
+	}
+	return nil
+}
+
+func (f *CryptFile) Name() string {
+	return f.name
+}
+
+func (f *CryptFile) Close() error {
+	return cryptPathError(f.src.Close(), f.name)
+}
+
+func (f *CryptFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *CryptFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	return f.readAt(p, off)
+}
+
+func (f *CryptFile) readAt(p []byte, off int64) (int, error) {
+	if f.dir {
+		return 0, f.error("read", syscall.EISDIR)
+	}
+	if !f.readable {
+		return 0, f.error("read", syscall.EBADF)
+	}
+	if off < 0 {
+		return 0, f.error("readat", errors.New("negative offset"))
+	}
+	var read int
+	chunk := int64(f.fs.chunkSize)
+	for read < len(p) && off < f.size {
+		plain, err := f.readChunk(off / chunk)
+		if err != nil {
+			return read, err
+		}
+		n := copy(p[read:], plain[off%chunk:])
+		read += n
+		off += int64(n)
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (f *CryptFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	if f.append {
+		f.off = f.size
+	}
+	n, err := f.writeAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *CryptFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.append {
+		return 0, f.error("writeat", errors.New("os: invalid use of WriteAt on file opened with O_APPEND"))
+	}
+	if err := f.refresh(); err != nil {
+		return 0, err
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *CryptFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// writeAt writes p at off, filling any gap after the end of the file with
+// zeros. The chunks written are all the ones touched, plus the last one
+// if it stops being the last.
+func (f *CryptFile) writeAt(p []byte, off int64) (int, error) {
+	if f.dir {
+		return 0, f.error("write", syscall.EISDIR)
+	}
+	if !f.writable {
+		return 0, f.error("write", syscall.EBADF)
+	}
+	if off < 0 {
+		return 0, f.error("writeat", errors.New("negative offset"))
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	chunk := int64(f.fs.chunkSize)
+	end := off + int64(len(p))
+	newSize := f.size
+	if end > newSize {
+		newSize = end
+	}
+	first := off
+	if f.size < first {
+		first = f.size
+	}
+	i := first / chunk
+	if last := f.chunks(f.size) - 1; newSize > f.size && i > last {
+		i = last
+	}
+	lastChunk := f.chunks(newSize) - 1
+	for ; i <= lastChunk && i*chunk < end; i++ {
+		start := i * chunk
+		old, err := f.readChunkIfPresent(i)
+		if err != nil {
+			return 0, err
+		}
+		n := newSize - start
+		if n > chunk {
+			n = chunk
+		}
+		plain := make([]byte, n)
+		copy(plain, old)
+		if off < start+n && end > start {
+			from := off - start
+			var src []byte
+			if from < 0 {
+				src = p[-from:]
+				from = 0
+			} else {
+				src = p
+			}
+			copy(plain[from:], src)
+		}
+		if err := f.writeChunk(i, plain, i == lastChunk); err != nil {
+			return 0, err
+		}
+	}
+	f.size = newSize
+	return len(p), nil
+}
+
+func (f *CryptFile) readChunkIfPresent(i int64) ([]byte, error) {
+	if i*int64(f.fs.chunkSize) >= f.size && !(i == 0 && f.size == 0) {
+		return nil, nil
+	}
+	return f.readChunk(i)
+}
+
+func (f *CryptFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dir {
+		return f.src.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		if err := f.refresh(); err != nil {
+			return 0, err
+		}
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, f.error("seek", os.ErrInvalid)
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// Readdir leaves out the entries whose names do not decrypt.
+func (f *CryptFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := readdirFiltered(f.src, count, func(fi os.FileInfo) (os.FileInfo, bool) {
+		name, ok := f.fs.decryptName(fi.Name())
+		if !ok {
+			return nil, false
+		}
+		return f.fs.fileInfo(fi, name), true
+	})
+	return infos, cryptPathError(err, f.name)
+}
+
+func (f *CryptFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
+
+func (f *CryptFile) Stat() (os.FileInfo, error) {
+	fi, err := f.src.Stat()
+	if err != nil {
+		return nil, cryptPathError(err, f.name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.dir {
+		if err := f.load(fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	return &cryptFileInfo{FileInfo: fi, name: filepath.Base(f.name), size: f.size}, nil
+}
+
+func (f *CryptFile) Sync() error {
+	return cryptPathError(f.src.Sync(), f.name)
+}
+
+func (f *CryptFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dir {
+		return f.error("truncate", syscall.EISDIR)
+	}
+	if !f.writable {
+		return f.error("truncate", syscall.EBADF)
+	}
+	if size < 0 {
+		return f.error("truncate", os.ErrInvalid)
+	}
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	chunk := int64(f.fs.chunkSize)
+	if size > f.size {
+		// Extend one chunk at a time, not to hold all the zeros.
+		zeros := make([]byte, chunk)
+		for f.size < size {
+			n := size - f.size
+			if n > chunk-f.size%chunk {
+				n = chunk - f.size%chunk
+			}
+			if _, err := f.writeAt(zeros[:n], f.size); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if size == f.size {
+		return nil
+	}
+	last := f.chunks(size) - 1
+	plain, err := f.readChunk(last)
+	if err != nil {
+		return err
+	}
+	plain = plain[:size-last*chunk]
+	if err := f.writeChunk(last, plain, true); err != nil {
+		return err
+	}
+	if err := f.src.Truncate(f.chunkOffset(last) + int64(len(plain)+cryptOverhead)); err != nil {
+		return cryptPathError(err, f.name)
+	}
+	f.size = size
+	return nil
+}
+
+func (f *CryptFile) Lock(ctx context.Context, exclusive bool) error {
+	return LockFile(ctx, f.src, exclusive)
+}
+
+func (f *CryptFile) TryLock(exclusive bool) error {
+	return TryLockFile(f.src, exclusive)
+}
+
+func (f *CryptFile) Unlock() error {
+	return UnlockFile(f.src)
+}
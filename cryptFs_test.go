@@ -0,0 +1,286 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newTestCryptFs(t *testing.T, source Fs, opts CryptOptions) (*CryptFs, *StaticKeys) {
+	t.Helper()
+	keys := &StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	fs, err := NewCryptFs(source, keys, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, keys
+}
+
+func TestCryptFsRandomAccess(t *testing.T) {
+	source := &MemMapFs{}
+	fs, _ := newTestCryptFs(t, source, CryptOptions{ChunkSize: 16})
+	r := mathrand.New(mathrand.NewSource(1))
+
+	f, err := fs.Create("/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var model []byte
+	for i := 0; i < 500; i++ {
+		switch r.Intn(4) {
+		case 0, 1:
+			off := r.Intn(len(model) + 40)
+			p := make([]byte, r.Intn(50))
+			r.Read(p)
+			if _, err := f.WriteAt(p, int64(off)); err != nil {
+				t.Fatal(err)
+			}
+			if len(p) == 0 {
+				break
+			}
+			if end := off + len(p); end > len(model) {
+				model = append(model, make([]byte, end-len(model))...)
+			}
+			copy(model[off:], p)
+		case 2:
+			size := r.Intn(len(model) + 40)
+			if err := f.Truncate(int64(size)); err != nil {
+				t.Fatal(err)
+			}
+			if size > len(model) {
+				model = append(model, make([]byte, size-len(model))...)
+			}
+			model = model[:size]
+		case 3:
+			off := r.Intn(len(model) + 1)
+			p := make([]byte, r.Intn(50))
+			n, err := f.ReadAt(p, int64(off))
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			want := model[off:]
+			if len(want) > len(p) {
+				want = want[:len(p)]
+			}
+			if !bytes.Equal(p[:n], want) {
+				t.Fatalf("step %d: read %q at %d, want %q", i, p[:n], off, want)
+			}
+		}
+		fi, err := fs.Stat("/f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != int64(len(model)) {
+			t.Fatalf("step %d: expected size %d, got %d", i, len(model), fi.Size())
+		}
+	}
+	f.Close()
+
+	data, err := ReadFile(fs, "/f")
+	if err != nil || !bytes.Equal(data, model) {
+		t.Fatalf("expected the content to survive reopening, got %v", err)
+	}
+	raw, _ := ReadFile(source, "/f")
+	if len(model) > 8 && bytes.Contains(raw, model[:8]) {
+		t.Error("expected the content to be encrypted")
+	}
+}
+
+func TestCryptFsAppendAndSeek(t *testing.T) {
+	fs, _ := newTestCryptFs(t, &MemMapFs{}, CryptOptions{ChunkSize: 4})
+	WriteFile(fs, "/log", []byte("first;"), 0644)
+	f, err := fs.OpenFile("/log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("second;")
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("expected reading a write only file to fail")
+	}
+	f.Close()
+
+	f, _ = fs.Open("/log")
+	defer f.Close()
+	if pos, err := f.Seek(-7, io.SeekEnd); err != nil || pos != 6 {
+		t.Fatalf("expected to seek to 6, got %d, %v", pos, err)
+	}
+	rest, _ := ioutil.ReadAll(f)
+	if string(rest) != "second;" {
+		t.Errorf("expected the appended data, got %q", rest)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("expected writing a read only file to fail")
+	}
+}
+
+func TestCryptFsTampering(t *testing.T) {
+	source := &MemMapFs{}
+	fs, _ := newTestCryptFs(t, source, CryptOptions{ChunkSize: 8})
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	WriteFile(fs, "/f", content, 0644)
+	raw, _ := ReadFile(source, "/f")
+	chunk := 8 + cryptOverhead
+
+	tampered := map[string][]byte{
+		"flipped byte":    append([]byte{}, raw...),
+		"dropped chunk":   raw[:len(raw)-(len(raw)-cryptHeaderSize)%chunk],
+		"swapped chunks":  append(append(append([]byte{}, raw[:cryptHeaderSize]...), raw[cryptHeaderSize+chunk:cryptHeaderSize+2*chunk]...), raw[cryptHeaderSize+chunk:]...),
+		"other file data": nil,
+	}
+	tampered["flipped byte"][cryptHeaderSize+20] ^= 1
+	WriteFile(fs, "/other", content, 0644)
+	tampered["other file data"], _ = ReadFile(source, "/other")
+	tampered["other file data"] = append(append([]byte{}, raw[:cryptHeaderSize]...), tampered["other file data"][cryptHeaderSize:]...)
+
+	for name, data := range tampered {
+		WriteFile(source, "/f", data, 0644)
+		_, err := ReadFile(fs, "/f")
+		if !errors.Is(err, ErrCryptAuth) {
+			t.Errorf("%s: expected ErrCryptAuth, got %v", name, err)
+		}
+	}
+
+	WriteFile(source, "/plain", []byte("not encrypted at all, really not"), 0644)
+	if _, err := fs.Open("/plain"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestCryptFsNames(t *testing.T) {
+	source := &MemMapFs{}
+	fs, _ := newTestCryptFs(t, source, CryptOptions{NameKey: []byte("name key")})
+	if err := fs.MkdirAll("/secret/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/secret/dir/report.pdf", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Walk(source, "/", func(path string, info os.FileInfo, err error) error {
+		if strings.Contains(path, "secret") || strings.Contains(path, "report") {
+			t.Errorf("expected names to be encrypted, found %s", path)
+		}
+		return nil
+	})
+
+	names, err := readDirNames(fs, "/secret/dir")
+	if err != nil || len(names) != 1 || names[0] != "report.pdf" {
+		t.Errorf("expected the plaintext names, got %v, %v", names, err)
+	}
+	fi, err := fs.Stat("/secret/dir/report.pdf")
+	if err != nil || fi.Name() != "report.pdf" || fi.Size() != 1 {
+		t.Errorf("expected to stat the file by its name, got %v, %v", fi, err)
+	}
+	if err := fs.Rename("/secret/dir/report.pdf", "/secret/r.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/secret/r.pdf"); err != nil {
+		t.Error(err)
+	}
+	_, err = fs.Stat("/secret/missing")
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr.Path != "/secret/missing" || !os.IsNotExist(err) {
+		t.Errorf("expected errors to carry the plaintext name, got %v", err)
+	}
+}
+
+func TestCryptFsReaddirBatches(t *testing.T) {
+	source := &MemMapFs{}
+	fs, _ := newTestCryptFs(t, source, CryptOptions{NameKey: []byte("name key")})
+	fs.Mkdir("/dir", 0755)
+	for _, name := range []string{"a", "b", "c"} {
+		WriteFile(fs, "/dir/"+name, nil, 0644)
+	}
+	for i := 0; i < 10; i++ {
+		WriteFile(source, fmt.Sprintf("%s/stray%d", fs.realPath("/dir"), i), nil, 0644)
+	}
+
+	d, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	var names []string
+	for {
+		fis, err := d.Readdir(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(fis) != 1 {
+			t.Fatalf("expected one entry or io.EOF, got %v, %v", fis, err)
+		}
+		names = append(names, fis[0].Name())
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("expected the entries which decrypt, got %v", names)
+	}
+}
+
+func TestCryptFsKeyRotation(t *testing.T) {
+	source := &MemMapFs{}
+	fs, keys := newTestCryptFs(t, source, CryptOptions{})
+	WriteFile(fs, "/old", []byte("old data"), 0644)
+
+	keys.Keys["k2"] = bytes.Repeat([]byte{2}, 32)
+	keys.Current = "k2"
+	WriteFile(fs, "/new", []byte("new data"), 0644)
+	for name, want := range map[string]string{"/old": "old data", "/new": "new data"} {
+		if data, err := ReadFile(fs, name); err != nil || string(data) != want {
+			t.Errorf("%s: expected %q, got %q, %v", name, want, data, err)
+		}
+	}
+
+	delete(keys.Keys, "k1")
+	if _, err := fs.Open("/old"); !errors.Is(err, ErrCryptKey) {
+		t.Errorf("expected the missing key to be reported, got %v", err)
+	}
+
+	other, _ := newTestCryptFs(t, source, CryptOptions{ChunkSize: 100})
+	if _, err := other.Open("/new"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("expected a different chunk size to be refused, got %v", err)
+	}
+}
+
+func TestCryptFsSeveralHandles(t *testing.T) {
+	fs, _ := newTestCryptFs(t, &MemMapFs{}, CryptOptions{ChunkSize: 4})
+	WriteFile(fs, "/f", []byte("abc"), 0644)
+	f1, _ := fs.OpenFile("/f", os.O_RDWR, 0)
+	defer f1.Close()
+	f2, _ := fs.OpenFile("/f", os.O_RDWR, 0)
+	defer f2.Close()
+	r, _ := fs.Open("/f")
+	defer r.Close()
+
+	// Each handle sees what the others wrote.
+	if _, err := f1.WriteAt([]byte("defgh"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f2.WriteAt([]byte("XY"), 7); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := r.Stat(); err != nil || fi.Size() != 9 {
+		t.Errorf("expected the size written by the other handles, got %v, %v", fi, err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "abcdefgXY" {
+		t.Errorf("expected the writes of both handles, got %q, %v", data, err)
+	}
+
+	// A file truncated by another handle starts again with a new header.
+	f3, _ := fs.Create("/f")
+	f3.WriteString("new")
+	f3.Close()
+	if _, err := f1.Write([]byte("N")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/f"); err != nil || string(data) != "New" {
+		t.Errorf("expected the write on the new content, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,919 @@
+package afero
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+// DedupOptions are the options of a DedupFs.
+type DedupOptions struct {
+	// Chunking splits files into chunks at boundaries depending on their
+	// content, so that files sharing part of their content share chunks.
+	// Otherwise, only identical files are stored once.
+	Chunking bool
+
+	// The bounds and average of the sizes of chunks, 16 KiB, 256 KiB and
+	// 64 KiB if zero.
+	MinChunkSize int
+	MaxChunkSize int
+	AvgChunkSize int
+}
+
+// DedupStats describes what a DedupFs stores.
+type DedupStats struct {
+	Files        int
+	Blobs        int
+	LogicalBytes int64 // the size of the files
+	StoredBytes  int64 // the size of the blobs
+}
+
+// dedupChunk is a chunk of a file, stored as the blob of its hash.
+type dedupChunk struct {
+	Hash string
+	Size int64
+}
+
+// dedupNode is a file or directory in the index.
+type dedupNode struct {
+	Mode    os.FileMode
+	ModTime time.Time
+	UID     int          `json:",omitempty"`
+	GID     int          `json:",omitempty"`
+	Chunks  []dedupChunk `json:",omitempty"`
+
+	removed bool // while open
+}
+
+func (n *dedupNode) size() int64 {
+	var size int64
+	for _, c := range n.Chunks {
+		size += c.Size
+	}
+	return size
+}
+
+const (
+	dedupIndex = "index.json"
+	dedupBlobs = "blobs"
+)
+
+// dedupGear is the table of the rolling hash finding chunk boundaries.
+var dedupGear = func() (gear [256]uint64) {
+	for i := range gear {
+		sum := sha256.Sum256([]byte{byte(i)})
+		gear[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return gear
+}()
+
+// The DedupFs is a filesystem storing the content of its files in another
+// one, the store, as blobs named by the hash of their content, so that
+// identical contents are stored once. With chunking, files are split into
+// chunks at boundaries found by a rolling hash of their content, and
+// identical chunks are stored once too.
+//
+// The namespace, with the directories, the names and modes of the files
+// and their chunks, is kept in memory, and saved as an index in the store
+// after every change. Blobs are removed as soon as nothing refers to them:
+// neither a file, nor a handle open for reading. GC removes the blobs left
+// behind by a crash.
+//
+// A file opened for writing is held in memory until closed or synced,
+// when it is chunked and stored. Files read are only read chunk by chunk,
+// and fail with ErrCorrupted on a blob not matching its hash.
+//
+// The index and the blobs are kept at relative paths of the store, which is
+// typically a BasePathFs or a MemMapFs.
+type DedupFs struct {
+	store Fs
+	opts  DedupOptions
+	mask  uint64
+
+	mu       sync.Mutex
+	nodes    map[string]*dedupNode
+	children map[string]map[string]bool
+	refs     map[string]int
+	sizes    map[string]int64 // of the blobs
+}
+
+// NewDedupFs returns a DedupFs storing its files in store, loading the
+// index found there, if any.
+func NewDedupFs(store Fs, opts DedupOptions) (*DedupFs, error) {
+	if opts.MinChunkSize <= 0 {
+		opts.MinChunkSize = 16 << 10
+	}
+	if opts.MaxChunkSize <= 0 {
+		opts.MaxChunkSize = 256 << 10
+	}
+	if opts.AvgChunkSize <= 0 {
+		opts.AvgChunkSize = 64 << 10
+	}
+	d := &DedupFs{
+		store:    store,
+		opts:     opts,
+		nodes:    make(map[string]*dedupNode),
+		children: make(map[string]map[string]bool),
+		refs:     make(map[string]int),
+		sizes:    make(map[string]int64),
+	}
+	// Boundaries are found about every AvgChunkSize bytes past the
+	// minimum.
+	for d.mask = 1; int(d.mask) < opts.AvgChunkSize-opts.MinChunkSize; d.mask <<= 1 {
+	}
+	d.mask--
+
+	data, err := ReadFile(store, dedupIndex)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.nodes[FilePathSeparator] = &dedupNode{Mode: os.ModeDir | 0755, ModTime: time.Now()}
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &d.nodes); err != nil {
+			return nil, err
+		}
+		if d.nodes[FilePathSeparator] == nil {
+			return nil, &os.PathError{Op: "open", Path: dedupIndex, Err: errors.New("no root in index")}
+		}
+	}
+	for name, node := range d.nodes {
+		if name != FilePathSeparator {
+			d.link(name)
+		}
+		d.ref(node.Chunks, 1)
+	}
+	return d, nil
+}
+
+// link adds name to the children of its parent.
+func (d *DedupFs) link(name string) {
+	parent, base := filepath.Dir(name), filepath.Base(name)
+	if d.children[parent] == nil {
+		d.children[parent] = make(map[string]bool)
+	}
+	d.children[parent][base] = true
+}
+
+func (d *DedupFs) unlink(name string) {
+	delete(d.children[filepath.Dir(name)], filepath.Base(name))
+}
+
+// ref adds delta references to chunks, and returns the blobs no longer
+// referred to.
+func (d *DedupFs) ref(chunks []dedupChunk, delta int) []string {
+	var unused []string
+	for _, c := range chunks {
+		d.refs[c.Hash] += delta
+		d.sizes[c.Hash] = c.Size
+		if d.refs[c.Hash] <= 0 {
+			delete(d.refs, c.Hash)
+			delete(d.sizes, c.Hash)
+			unused = append(unused, c.Hash)
+		}
+	}
+	return unused
+}
+
+func blobPath(hash string) string {
+	return filepath.Join(dedupBlobs, hash[:2], hash)
+}
+
+// removeBlobs removes blobs no longer referred to.
+func (d *DedupFs) removeBlobs(hashes []string) error {
+	for _, hash := range hashes {
+		if err := d.store.Remove(blobPath(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes the index to the store. The lock must be held.
+func (d *DedupFs) save() error {
+	data, err := json.Marshal(d.nodes)
+	if err != nil {
+		return err
+	}
+	if err := WriteFile(d.store, dedupIndex+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return d.store.Rename(dedupIndex+".tmp", dedupIndex)
+}
+
+// split cuts data into chunks.
+func (d *DedupFs) split(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	if !d.opts.Chunking || len(data) <= d.opts.MinChunkSize {
+		return [][]byte{data}
+	}
+	var chunks [][]byte
+	var h uint64
+	start := 0
+	for i, b := range data {
+		h = h<<1 + dedupGear[b]
+		size := i + 1 - start
+		if size >= d.opts.MinChunkSize && h&d.mask == 0 || size >= d.opts.MaxChunkSize {
+			chunks = append(chunks, data[start:i+1])
+			start, h = i+1, 0
+		}
+	}
+	if start < len(data) {
+		chunks = append(chunks, data[start:])
+	}
+	return chunks
+}
+
+// storeContent writes the blobs of data missing from the store, and
+// returns its chunks, holding a reference to each of them, so that none is
+// removed before the caller refers to them.
+func (d *DedupFs) storeContent(data []byte) ([]dedupChunk, error) {
+	var chunks []dedupChunk
+	for _, p := range d.split(data) {
+		sum := sha256.Sum256(p)
+		chunk := dedupChunk{Hash: hex.EncodeToString(sum[:]), Size: int64(len(p))}
+		d.mu.Lock()
+		known := d.refs[chunk.Hash] > 0
+		d.ref([]dedupChunk{chunk}, 1)
+		d.mu.Unlock()
+		chunks = append(chunks, chunk)
+		if known {
+			continue
+		}
+		if err := d.writeBlob(chunk.Hash, p); err != nil {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.removeBlobs(d.ref(chunks, -1))
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// writeBlob writes the blob of hash, unless it is in the store already.
+func (d *DedupFs) writeBlob(hash string, p []byte) error {
+	if _, err := d.store.Stat(blobPath(hash)); err == nil {
+		return nil
+	}
+	if err := d.store.MkdirAll(filepath.Dir(blobPath(hash)), 0755); err != nil {
+		return err
+	}
+	// Written aside first, so that a blob is never incomplete.
+	if err := WriteFile(d.store, blobPath(hash)+".tmp", p, 0644); err != nil {
+		return err
+	}
+	return d.store.Rename(blobPath(hash)+".tmp", blobPath(hash))
+}
+
+// setContent stores data as the content of the file of node, opened as
+// name, taking over the references of storeContent. The node is followed
+// through renames.
+func (d *DedupFs) setContent(node *dedupNode, name string, data []byte) error {
+	chunks, err := d.storeContent(data)
+	if err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if node.removed {
+		// Removed while open: the content goes nowhere, and the blobs
+		// written for it are dropped.
+		return d.removeBlobs(d.ref(chunks, -1))
+	}
+	old := node.Chunks
+	node.Chunks = chunks
+	node.ModTime = time.Now()
+	unused := d.ref(old, -1)
+	if err := d.save(); err != nil {
+		return err
+	}
+	return d.removeBlobs(unused)
+}
+
+// GC removes the blobs of the store nothing refers to, such as those left
+// behind by a crash, and returns how many it removed. It must not run while
+// files are being written.
+func (d *DedupFs) GC() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := 0
+	err := Walk(d.store, dedupBlobs, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if hash := filepath.Base(path); d.refs[hash] > 0 {
+			return nil
+		}
+		if err := d.store.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return removed, err
+}
+
+// Stats describes what the DedupFs stores.
+func (d *DedupFs) Stats() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var s DedupStats
+	for _, node := range d.nodes {
+		if node.Mode.IsRegular() {
+			s.Files++
+			s.LogicalBytes += node.size()
+		}
+	}
+	for _, size := range d.sizes {
+		s.Blobs++
+		s.StoredBytes += size
+	}
+	return s
+}
+
+func (d *DedupFs) Name() string {
+	return "DedupFs"
+}
+
+// lookup returns the node of name. The lock must be held.
+func (d *DedupFs) lookup(op, name string) (*dedupNode, error) {
+	node, ok := d.nodes[name]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return node, nil
+}
+
+// create adds the node of name, whose parent must be a directory. The lock
+// must be held.
+func (d *DedupFs) create(op, name string, mode os.FileMode) error {
+	if _, ok := d.nodes[name]; ok {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+	}
+	parent, ok := d.nodes[filepath.Dir(name)]
+	if !ok {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	if !parent.Mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	d.nodes[name] = &dedupNode{Mode: mode, ModTime: time.Now()}
+	d.link(name)
+	return d.save()
+}
+
+func (d *DedupFs) Create(name string) (File, error) {
+	return d.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (d *DedupFs) Open(name string) (File, error) {
+	return d.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (d *DedupFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = normalizePath(name)
+	d.mu.Lock()
+	node, ok := d.nodes[name]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		d.mu.Unlock()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		d.mu.Unlock()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		if err := d.create("open", name, perm&os.ModePerm); err != nil {
+			d.mu.Unlock()
+			return nil, err
+		}
+		node = d.nodes[name]
+	}
+	f := &DedupFile{fs: d, name: name, node: node}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if node.Mode.IsDir() {
+		d.mu.Unlock()
+		if writable {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		f.dir = true
+		return f, nil
+	}
+	chunks := node.Chunks
+	// The chunks are pinned for as long as they are needed.
+	d.ref(chunks, 1)
+	d.mu.Unlock()
+
+	if !writable {
+		f.chunks = chunks
+		f.pinned = chunks
+		return f, nil
+	}
+	defer d.unpin(chunks)
+	data := mem.CreateFile(name)
+	mem.SetMode(data, node.Mode)
+	f.w = mem.NewFileHandle(data)
+	if flag&os.O_TRUNC != 0 {
+		f.dirty = true
+	} else {
+		r := &DedupFile{fs: d, name: name, chunks: chunks}
+		if _, err := io.Copy(f.w, r); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		if _, err := f.w.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		f.w.Seek(0, io.SeekEnd)
+	}
+	return f, nil
+}
+
+// unpin drops the references of a handle to chunks.
+func (d *DedupFs) unpin(chunks []dedupChunk) error {
+	d.mu.Lock()
+	unused := d.ref(chunks, -1)
+	d.mu.Unlock()
+	return d.removeBlobs(unused)
+}
+
+func (d *DedupFs) Mkdir(name string, perm os.FileMode) error {
+	name = normalizePath(name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.create("mkdir", name, os.ModeDir|perm&os.ModePerm)
+}
+
+func (d *DedupFs) MkdirAll(path string, perm os.FileMode) error {
+	path = normalizePath(path)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var missing []string
+	for p := path; ; p = filepath.Dir(p) {
+		node, ok := d.nodes[p]
+		if ok {
+			if !node.Mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := d.create("mkdir", missing[i], os.ModeDir|perm&os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// descendants returns the paths below dir. The lock must be held.
+func (d *DedupFs) descendants(dir string) []string {
+	var names []string
+	for base := range d.children[dir] {
+		name := filepath.Join(dir, base)
+		names = append(names, name)
+		names = append(names, d.descendants(name)...)
+	}
+	return names
+}
+
+// remove removes name and what it contains. The lock must be held.
+func (d *DedupFs) remove(name string) []string {
+	var unused []string
+	for _, p := range append(d.descendants(name), name) {
+		unused = append(unused, d.ref(d.nodes[p].Chunks, -1)...)
+		d.nodes[p].removed = true
+		delete(d.nodes, p)
+		delete(d.children, p)
+		d.unlink(p)
+	}
+	return unused
+}
+
+func (d *DedupFs) Remove(name string) error {
+	name = normalizePath(name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.lookup("remove", name); err != nil {
+		return err
+	}
+	if len(d.children[name]) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	if name == FilePathSeparator {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	unused := d.remove(name)
+	if err := d.save(); err != nil {
+		return err
+	}
+	return d.removeBlobs(unused)
+}
+
+func (d *DedupFs) RemoveAll(path string) error {
+	path = normalizePath(path)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.nodes[path]; !ok {
+		return nil
+	}
+	var unused []string
+	if path == FilePathSeparator {
+		for _, name := range d.descendants(path) {
+			if _, ok := d.nodes[name]; ok {
+				unused = append(unused, d.remove(name)...)
+			}
+		}
+	} else {
+		unused = d.remove(path)
+	}
+	if err := d.save(); err != nil {
+		return err
+	}
+	return d.removeBlobs(unused)
+}
+
+func (d *DedupFs) Rename(oldname, newname string) error {
+	oldname, newname = normalizePath(oldname), normalizePath(newname)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, ok := d.nodes[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if oldname == newname {
+		return nil
+	}
+	if strings.HasPrefix(newname, oldname+FilePathSeparator) || oldname == FilePathSeparator {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
+	parent, ok := d.nodes[filepath.Dir(newname)]
+	if !ok || !parent.Mode.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	var unused []string
+	if target, ok := d.nodes[newname]; ok {
+		switch {
+		case target.Mode.IsDir() != node.Mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrExist}
+		case len(d.children[newname]) > 0:
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTEMPTY}
+		}
+		unused = d.remove(newname)
+	}
+	for _, p := range append(d.descendants(oldname), oldname) {
+		renamed := newname + strings.TrimPrefix(p, oldname)
+		d.nodes[renamed] = d.nodes[p]
+		delete(d.nodes, p)
+		if children, ok := d.children[p]; ok {
+			d.children[renamed] = children
+			delete(d.children, p)
+		}
+	}
+	d.unlink(oldname)
+	d.link(newname)
+	if err := d.save(); err != nil {
+		return err
+	}
+	return d.removeBlobs(unused)
+}
+
+func (d *DedupFs) Stat(name string) (os.FileInfo, error) {
+	name = normalizePath(name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, err := d.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return newDedupFileInfo(name, node), nil
+}
+
+// update changes the node of name, and saves the index.
+func (d *DedupFs) update(op, name string, fn func(*dedupNode)) error {
+	name = normalizePath(name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, err := d.lookup(op, name)
+	if err != nil {
+		return err
+	}
+	fn(node)
+	return d.save()
+}
+
+func (d *DedupFs) Chmod(name string, mode os.FileMode) error {
+	return d.update("chmod", name, func(node *dedupNode) {
+		node.Mode = node.Mode&os.ModeType | mode&chmodBits
+	})
+}
+
+func (d *DedupFs) Chown(name string, uid, gid int) error {
+	return d.update("chown", name, func(node *dedupNode) {
+		node.UID, node.GID = uid, gid
+	})
+}
+
+func (d *DedupFs) Chtimes(name string, atime, mtime time.Time) error {
+	return d.update("chtimes", name, func(node *dedupNode) {
+		node.ModTime = mtime
+	})
+}
+
+// dedupFileInfo describes a file of a DedupFs.
+type dedupFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func newDedupFileInfo(name string, node *dedupNode) *dedupFileInfo {
+	return &dedupFileInfo{name: filepath.Base(name), size: node.size(), mode: node.Mode, modTime: node.ModTime}
+}
+
+func (fi *dedupFileInfo) Name() string       { return fi.name }
+func (fi *dedupFileInfo) Size() int64        { return fi.size }
+func (fi *dedupFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *dedupFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *dedupFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *dedupFileInfo) Sys() interface{}   { return nil }
+
+// DedupFile is a file opened in a DedupFs.
+type DedupFile struct {
+	fs     *DedupFs
+	name   string
+	node   *dedupNode
+	closed bool
+
+	// Of a directory.
+	dir     bool
+	dirRead []string
+	dirOff  int
+
+	// Of a file read: its chunks, and the last one read.
+	chunks     []dedupChunk
+	pinned     []dedupChunk
+	off        int64
+	chunk      []byte
+	chunkIndex int
+
+	// Of a file written: its content, held in memory.
+	w     *mem.File
+	dirty bool
+}
+
+func (f *DedupFile) error(op string, err error) error {
+	return &os.PathError{Op: op, Path: f.name, Err: err}
+}
+
+func (f *DedupFile) Name() string {
+	return f.name
+}
+
+func (f *DedupFile) Close() error {
+	if f.closed {
+		return f.error("close", ErrFileClosed)
+	}
+	f.closed = true
+	if f.w != nil {
+		err := f.sync()
+		f.w.Close()
+		return err
+	}
+	return f.fs.unpin(f.pinned)
+}
+
+func (f *DedupFile) sync() error {
+	if !f.dirty {
+		return nil
+	}
+	data, err := dedupContent(f.w)
+	if err != nil {
+		return err
+	}
+	if err := f.fs.setContent(f.node, f.name, data); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+// dedupContent returns the whole content of a file held in memory, without
+// moving its offset.
+func dedupContent(f *mem.File) ([]byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, fi.Size())
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Sync stores the content of a file written.
+func (f *DedupFile) Sync() error {
+	if f.closed {
+		return f.error("sync", ErrFileClosed)
+	}
+	if f.w != nil {
+		return f.sync()
+	}
+	return nil
+}
+
+func (f *DedupFile) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, f.error("stat", ErrFileClosed)
+	}
+	if f.w != nil {
+		data := f.w.Data()
+		fi := mem.GetFileInfo(data)
+		return &dedupFileInfo{name: filepath.Base(f.name), size: fi.Size(), mode: fi.Mode(), modTime: fi.ModTime()}, nil
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return newDedupFileInfo(f.name, f.node), nil
+}
+
+func (f *DedupFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, f.error("readdir", ErrFileClosed)
+	}
+	if !f.dir {
+		return nil, f.error("readdir", syscall.ENOTDIR)
+	}
+	f.fs.mu.Lock()
+	if f.dirRead == nil {
+		f.dirRead = []string{}
+		for base := range f.fs.children[f.name] {
+			f.dirRead = append(f.dirRead, base)
+		}
+		sort.Strings(f.dirRead)
+	}
+	names := f.dirRead[f.dirOff:]
+	if count > 0 && len(names) > count {
+		names = names[:count]
+	}
+	var fis []os.FileInfo
+	for _, base := range names {
+		name := filepath.Join(f.name, base)
+		if node, ok := f.fs.nodes[name]; ok {
+			fis = append(fis, newDedupFileInfo(name, node))
+		}
+	}
+	f.fs.mu.Unlock()
+	f.dirOff += len(names)
+	if count > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	return fis, nil
+}
+
+func (f *DedupFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
+
+func (f *DedupFile) check(op string) error {
+	if f.closed {
+		return f.error(op, ErrFileClosed)
+	}
+	if f.dir {
+		return f.error(op, syscall.EISDIR)
+	}
+	return nil
+}
+
+func (f *DedupFile) Read(p []byte) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if f.w != nil {
+		return f.w.Read(p)
+	}
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *DedupFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	if f.w != nil {
+		return f.w.ReadAt(p, off)
+	}
+	if off < 0 {
+		return 0, f.error("readat", errors.New("negative offset"))
+	}
+	var read int
+	var start int64
+	for i, c := range f.chunks {
+		if read == len(p) {
+			break
+		}
+		if off >= start+c.Size {
+			start += c.Size
+			continue
+		}
+		if i != f.chunkIndex || f.chunk == nil {
+			data, err := ReadFile(f.fs.store, blobPath(c.Hash))
+			if err != nil {
+				return read, f.error("read", err)
+			}
+			if sum := sha256.Sum256(data); int64(len(data)) != c.Size || hex.EncodeToString(sum[:]) != c.Hash {
+				return read, f.error("read", ErrCorrupted)
+			}
+			f.chunk, f.chunkIndex = data, i
+		}
+		n := copy(p[read:], f.chunk[off-start:])
+		read += n
+		off += int64(n)
+		start += c.Size
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (f *DedupFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+	if f.w != nil {
+		return f.w.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		var size int64
+		for _, c := range f.chunks {
+			size += c.Size
+		}
+		offset += size
+	}
+	if offset < 0 {
+		return 0, f.error("seek", os.ErrInvalid)
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *DedupFile) writable(op string) error {
+	if err := f.check(op); err != nil {
+		return err
+	}
+	if f.w == nil {
+		return f.error(op, syscall.EBADF)
+	}
+	f.dirty = true
+	return nil
+}
+
+func (f *DedupFile) Write(p []byte) (int, error) {
+	if err := f.writable("write"); err != nil {
+		return 0, err
+	}
+	return f.w.Write(p)
+}
+
+func (f *DedupFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.writable("write"); err != nil {
+		return 0, err
+	}
+	return f.w.WriteAt(p, off)
+}
+
+func (f *DedupFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *DedupFile) Truncate(size int64) error {
+	if err := f.writable("truncate"); err != nil {
+		return err
+	}
+	return f.w.Truncate(size)
+}
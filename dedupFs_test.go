@@ -0,0 +1,188 @@
+package afero
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
+	"os"
+	"testing"
+)
+
+func newTestDedupFs(t *testing.T, store Fs, opts DedupOptions) *DedupFs {
+	t.Helper()
+	fs, err := NewDedupFs(store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestDedupFsIdenticalFiles(t *testing.T) {
+	store := &MemMapFs{}
+	fs := newTestDedupFs(t, store, DedupOptions{})
+	content := bytes.Repeat([]byte("build output "), 1000)
+	fs.MkdirAll("/build/1", 0755)
+	fs.MkdirAll("/build/2", 0755)
+	WriteFile(fs, "/build/1/app", content, 0755)
+	WriteFile(fs, "/build/2/app", content, 0755)
+
+	stats := fs.Stats()
+	if stats.Files != 2 || stats.Blobs != 1 || stats.LogicalBytes != 2*int64(len(content)) || stats.StoredBytes != int64(len(content)) {
+		t.Errorf("expected the content to be stored once, got %+v", stats)
+	}
+	fi, err := fs.Stat("/build/2/app")
+	if err != nil || fi.Size() != int64(len(content)) || fi.Mode() != 0755 {
+		t.Errorf("expected the file info, got %v, %v", fi, err)
+	}
+	if data, err := ReadFile(fs, "/build/1/app"); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("expected the content back, got %v", err)
+	}
+
+	fs.RemoveAll("/build/1")
+	if stats := fs.Stats(); stats.Blobs != 1 {
+		t.Errorf("expected the blob to stay referenced, got %+v", stats)
+	}
+	fs.Remove("/build/2/app")
+	if stats := fs.Stats(); stats.Blobs != 0 {
+		t.Errorf("expected the blob to be collected, got %+v", stats)
+	}
+	if fis, _ := ReadDir(store, "blobs"); len(fis) == 1 {
+		if blobs, _ := ReadDir(store, "blobs/"+fis[0].Name()); len(blobs) != 0 {
+			t.Errorf("expected the blob to be removed from the store, got %v", blobs)
+		}
+	}
+}
+
+func TestDedupFsChunking(t *testing.T) {
+	fs := newTestDedupFs(t, &MemMapFs{}, DedupOptions{Chunking: true, MinChunkSize: 256, AvgChunkSize: 1024, MaxChunkSize: 4096})
+	r := mathrand.New(mathrand.NewSource(1))
+	base := make([]byte, 64<<10)
+	r.Read(base)
+	edited := append(append(append([]byte{}, base[:30000]...), "an edit in the middle"...), base[30000:]...)
+	WriteFile(fs, "/v1", base, 0644)
+	WriteFile(fs, "/v2", edited, 0644)
+
+	stats := fs.Stats()
+	if stats.StoredBytes > int64(len(base))+8192 {
+		t.Errorf("expected most chunks to be shared, stored %d bytes for %d", stats.StoredBytes, stats.LogicalBytes)
+	}
+
+	f, err := fs.Open("/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 100; i++ {
+		off := r.Intn(len(edited))
+		p := make([]byte, r.Intn(5000))
+		n, err := f.ReadAt(p, int64(off))
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p[:n], edited[off:off+n]) || n < len(p) && off+n != len(edited) {
+			t.Fatalf("read %d bytes at %d, mismatch", n, off)
+		}
+	}
+}
+
+func TestDedupFsReopen(t *testing.T) {
+	store := &MemMapFs{}
+	fs := newTestDedupFs(t, store, DedupOptions{})
+	fs.MkdirAll("/a/b", 0700)
+	WriteFile(fs, "/a/b/f", []byte("hello"), 0600)
+	f, _ := fs.OpenFile("/a/b/f", os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString(" world")
+	f.Close()
+	fs.Rename("/a", "/c")
+
+	// Readers keep their content while it is replaced.
+	r, _ := fs.Open("/c/b/f")
+	WriteFile(fs, "/c/b/f", []byte("replaced"), 0600)
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "hello world" {
+		t.Errorf("expected the content when opened, got %q, %v", data, err)
+	}
+	r.Close()
+
+	WriteFile(store, "blobs/00/orphan", []byte("x"), 0644)
+	reopened := newTestDedupFs(t, store, DedupOptions{})
+	if data, err := ReadFile(reopened, "/c/b/f"); err != nil || string(data) != "replaced" {
+		t.Errorf("expected the namespace to persist, got %q, %v", data, err)
+	}
+	if fi, err := reopened.Stat("/c/b"); err != nil || !fi.IsDir() || fi.Mode().Perm() != 0700 {
+		t.Errorf("expected the directory to persist, got %v, %v", fi, err)
+	}
+	if n, err := reopened.GC(); err != nil || n != 1 {
+		t.Errorf("expected GC to remove the orphan blob, got %d, %v", n, err)
+	}
+	if names, _ := readDirNames(reopened, "/"); len(names) != 1 || names[0] != "c" {
+		t.Errorf("expected only the renamed directory, got %v", names)
+	}
+}
+
+func TestDedupFsRenameWhileOpen(t *testing.T) {
+	fs := newTestDedupFs(t, &MemMapFs{}, DedupOptions{})
+	f, _ := fs.Create("/tmp")
+	f.WriteString("hello")
+	if err := fs.Rename("/tmp", "/final"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/final"); err != nil || string(data) != "hello" {
+		t.Errorf("expected the content to follow the rename, got %q, %v", data, err)
+	}
+	if _, err := fs.Stat("/tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected the old name to be gone, got %v", err)
+	}
+
+	// Written to a file replaced, the content goes nowhere.
+	f, _ = fs.Create("/old")
+	f.WriteString("lost")
+	WriteFile(fs, "/new", []byte("kept"), 0644)
+	fs.Rename("/new", "/old")
+	f.Close()
+	if data, _ := ReadFile(fs, "/old"); string(data) != "kept" {
+		t.Errorf("expected the replacing content, got %q", data)
+	}
+	if s := fs.Stats(); s.Blobs != 2 {
+		t.Errorf("expected the blobs of the replaced content to be dropped, got %+v", s)
+	}
+}
+
+func TestDedupFsCorruptBlob(t *testing.T) {
+	store := &MemMapFs{}
+	fs := newTestDedupFs(t, store, DedupOptions{})
+	WriteFile(fs, "/a", []byte("hello"), 0644)
+	WriteFile(fs, "/b", []byte("world"), 0644)
+	for content, damaged := range map[string]string{"hello": "he", "world": "w0rld"} {
+		sum := sha256.Sum256([]byte(content))
+		WriteFile(store, blobPath(hex.EncodeToString(sum[:])), []byte(damaged), 0644)
+	}
+	for _, name := range []string{"/a", "/b"} {
+		if _, err := ReadFile(fs, name); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: expected ErrCorrupted, got %v", name, err)
+		}
+	}
+}
+
+func TestDedupFsStoreWhileRemoving(t *testing.T) {
+	store := &MemMapFs{}
+	fs := newTestDedupFs(t, store, DedupOptions{})
+	WriteFile(fs, "/a", []byte("shared"), 0644)
+
+	// The content of a file being closed is stored, and the only other
+	// file referring to it removed before the file refers to it.
+	chunks, err := fs.storeContent([]byte("shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Remove("/a")
+	if _, err := store.Stat(blobPath(chunks[0].Hash)); err != nil {
+		t.Errorf("expected the blob to be kept, got %v", err)
+	}
+}
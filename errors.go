@@ -0,0 +1,59 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// All filesystems in Afero report failures as an *os.PathError (or an
+// *os.LinkError for operations with two paths) carrying the operation, the
+// path and an error which can be matched with errors.Is against one of
+// os.ErrNotExist, os.ErrExist, os.ErrPermission or os.ErrInvalid.
+// Backend specific causes are kept in the chain underneath and can still be
+// matched with errors.Is and errors.As.
+
+// ErrReadOnly is wrapped in an *os.PathError by read-only filesystems when a
+// mutating operation is attempted. It matches both os.ErrPermission and
+// syscall.EROFS.
+var ErrReadOnly = WrapError(os.ErrPermission, syscall.EROFS)
+
+// ErrNotSupported is wrapped in an *os.PathError by filesystems for
+// operations their backend cannot perform. It matches os.ErrInvalid.
+var ErrNotSupported = WrapError(os.ErrInvalid, errors.New("operation not supported"))
+
+// WrapError returns an error with the message of cause which matches kind
+// with errors.Is, in addition to everything cause itself matches. It is
+// meant to attach one of the os.ErrNotExist, os.ErrExist, os.ErrPermission
+// or os.ErrInvalid sentinels to a backend specific error.
+// If cause is nil or already matches kind, cause is returned as is.
+func WrapError(kind, cause error) error {
+	if cause == nil || errors.Is(cause, kind) {
+		return cause
+	}
+	return &kindError{kind: kind, cause: cause}
+}
+
+type kindError struct {
+	kind  error
+	cause error
+}
+
+func (e *kindError) Error() string        { return e.cause.Error() }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+func (e *kindError) Unwrap() error        { return e.cause }
+
+// underlyingError returns the error wrapped by an *os.PathError,
+// *os.LinkError or *os.SyscallError, or err itself. It avoids nesting a
+// path error inside another one when re-labelling the operation.
+func underlyingError(err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	case *os.SyscallError:
+		return e.Err
+	}
+	return err
+}
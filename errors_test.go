@@ -0,0 +1,88 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"syscall"
+	"testing"
+)
+
+func TestWrapError(t *testing.T) {
+	err := WrapError(os.ErrPermission, syscall.EROFS)
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected %v to match os.ErrPermission", err)
+	}
+	if !errors.Is(err, syscall.EROFS) {
+		t.Errorf("expected %v to match syscall.EROFS", err)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v not to match os.ErrNotExist", err)
+	}
+	if err.Error() != syscall.EROFS.Error() {
+		t.Errorf("expected message %q, got %q", syscall.EROFS.Error(), err.Error())
+	}
+	if WrapError(os.ErrNotExist, syscall.ENOENT) != syscall.ENOENT {
+		t.Error("expected a cause already matching the kind to be returned as is")
+	}
+	if WrapError(os.ErrNotExist, nil) != nil {
+		t.Error("expected nil for a nil cause")
+	}
+}
+
+func checkErrorKind(t *testing.T, fs Fs, op string, err error, kind error) {
+	t.Helper()
+	switch err.(type) {
+	case *os.PathError, *os.LinkError:
+	default:
+		t.Errorf("%s %s: expected *os.PathError or *os.LinkError, got %T (%v)", fs.Name(), op, err, err)
+		return
+	}
+	if !errors.Is(err, kind) {
+		t.Errorf("%s %s: expected %v to match %v", fs.Name(), op, err, kind)
+	}
+}
+
+func TestErrorTaxonomy(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/dir/file.txt", []byte("content"), 0644)
+
+	ro := NewReadOnlyFs(base)
+	_, err := ro.Create("/dir/new.txt")
+	checkErrorKind(t, ro, "create", err, os.ErrPermission)
+	checkErrorKind(t, ro, "remove", ro.Remove("/dir/file.txt"), os.ErrPermission)
+	checkErrorKind(t, ro, "rename", ro.Rename("/dir/file.txt", "/dir/b"), os.ErrPermission)
+	checkErrorKind(t, ro, "mkdir", ro.Mkdir("/other", 0755), os.ErrPermission)
+	checkErrorKind(t, ro, "chmod", ro.Chmod("/dir/file.txt", 0600), ErrReadOnly)
+
+	cow := NewCopyOnWriteFs(ro, &MemMapFs{})
+	checkErrorKind(t, cow, "rename", cow.Rename("/dir/file.txt", "/dir/b"), os.ErrPermission)
+	checkErrorKind(t, cow, "remove", cow.Remove("/dir/file.txt"), os.ErrPermission)
+	checkErrorKind(t, cow, "remove", cow.Remove("/dir/missing"), os.ErrNotExist)
+	checkErrorKind(t, cow, "mkdir", cow.Mkdir("/dir", 0755), os.ErrExist)
+
+	re := NewRegexpFs(base, regexp.MustCompile(`\.txt$`))
+	_, err = re.Open("/dir/file.go")
+	checkErrorKind(t, re, "open", err, os.ErrNotExist)
+	_, err = re.Create("/dir/file.go")
+	checkErrorKind(t, re, "create", err, os.ErrNotExist)
+	_, err = re.Stat("/dir/missing.txt")
+	checkErrorKind(t, re, "stat", err, os.ErrNotExist)
+
+	_, err = base.Open("/missing")
+	checkErrorKind(t, base, "open", err, os.ErrNotExist)
+	_, err = base.OpenFile("/dir/file.txt", os.O_CREATE|os.O_EXCL, 0644)
+	checkErrorKind(t, base, "open", err, os.ErrExist)
+	checkErrorKind(t, base, "remove", base.Remove("/missing"), os.ErrNotExist)
+
+	f, _ := base.Open("/dir/file.txt")
+	_, err = f.Write([]byte("x"))
+	checkErrorKind(t, base, "write", err, os.ErrPermission)
+	checkErrorKind(t, base, "truncate", f.Truncate(1), os.ErrPermission)
+	f.Close()
+	f, _ = base.OpenFile("/dir/file.txt", os.O_RDWR, 0)
+	checkErrorKind(t, base, "truncate", f.Truncate(-1), os.ErrInvalid)
+	f.Close()
+	_, err = f.Read(make([]byte, 1))
+	checkErrorKind(t, base, "read", err, os.ErrClosed)
+}
@@ -0,0 +1,380 @@
+package afero
+
+import (
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Lstater = (*FaultFs)(nil)
+
+// A FaultRule describes failures injected by a FaultFs. A call matches the
+// rule if both its operation and its path match; whether a matching call is
+// then hit is decided by Nth and Probability.
+type FaultRule struct {
+	// Ops lists the operations the rule applies to, by method name:
+	// Create, Open, OpenFile, Mkdir, MkdirAll, Remove, RemoveAll, Rename,
+	// Stat, Lstat, Chmod, Chown, Chtimes, and for files Read, ReadAt,
+	// Write, WriteAt, Seek, Readdir, Readdirnames, Sync, Truncate and
+	// Close. Stat covers both Fs.Stat and File.Stat. Empty matches all.
+	Ops []string
+	// Path is matched against the name of the file with filepath.Match.
+	// For Rename either name may match. Empty matches all.
+	Path string
+
+	// Nth makes only the Nth matching call, counting from 1, be hit.
+	Nth int
+	// Probability, if above zero, is the chance a matching call is hit,
+	// drawn from the seeded generator of the FaultFs.
+	Probability float64
+
+	// Latency is added to the calls hit.
+	Latency time.Duration
+	// Short, if above zero, limits the calls to Read, ReadAt, Write and
+	// WriteAt hit to transferring Short bytes. A short write fails with
+	// io.ErrShortWrite unless Err is set.
+	Short int
+	// Err is returned by the calls hit, wrapped in an *os.PathError, or
+	// an *os.LinkError for Rename. Nil lets the call through, for rules
+	// only adding latency or short transfers.
+	Err error
+}
+
+type faultRuleState struct {
+	FaultRule
+	calls int
+}
+
+// The FaultFs injects failures described by rules into the calls made to a
+// source filesystem and to the files opened through it. It is meant for
+// testing how code copes with failing, slow or flaky storage.
+//
+// The first rule hit by a call applies. Randomness comes from a generator
+// seeded at creation, so a test run can be reproduced.
+type FaultFs struct {
+	source Fs
+
+	mu    sync.Mutex
+	rules []*faultRuleState
+	rand  *mathrand.Rand
+}
+
+func NewFaultFs(source Fs, seed int64, rules ...FaultRule) *FaultFs {
+	f := &FaultFs{source: source, rand: mathrand.New(mathrand.NewSource(seed))}
+	for _, rule := range rules {
+		f.AddRule(rule)
+	}
+	return f
+}
+
+// AddRule appends a rule, which applies after the existing ones.
+func (f *FaultFs) AddRule(rule FaultRule) {
+	f.mu.Lock()
+	f.rules = append(f.rules, &faultRuleState{FaultRule: rule})
+	f.mu.Unlock()
+}
+
+// ClearRules removes all rules, letting all calls through.
+func (f *FaultFs) ClearRules() {
+	f.mu.Lock()
+	f.rules = nil
+	f.mu.Unlock()
+}
+
+func (r *faultRuleState) matches(op string, names []string) bool {
+	if len(r.Ops) > 0 {
+		found := false
+		for _, o := range r.Ops {
+			if o == op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Path == "" {
+		return true
+	}
+	for _, name := range names {
+		if ok, _ := filepath.Match(r.Path, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hit returns the rule hit by a call, if any, after waiting for its
+// latency.
+func (f *FaultFs) hit(op string, names ...string) *FaultRule {
+	f.mu.Lock()
+	var hit *FaultRule
+	for _, r := range f.rules {
+		if !r.matches(op, names) {
+			continue
+		}
+		r.calls++
+		if r.Nth > 0 && r.calls != r.Nth {
+			continue
+		}
+		if r.Probability > 0 && f.rand.Float64() >= r.Probability {
+			continue
+		}
+		rule := r.FaultRule
+		hit = &rule
+		break
+	}
+	f.mu.Unlock()
+	if hit != nil && hit.Latency > 0 {
+		time.Sleep(hit.Latency)
+	}
+	return hit
+}
+
+// fail returns the error injected into a call, if any.
+func (f *FaultFs) fail(op, name string) error {
+	if rule := f.hit(op, name); rule != nil && rule.Err != nil {
+		return &os.PathError{Op: methodErrorOp(op), Path: name, Err: rule.Err}
+	}
+	return nil
+}
+
+// methodErrorOp returns the operation name an *os.PathError carries for the
+// name of the method which failed.
+func methodErrorOp(op string) string {
+	switch op {
+	case "OpenFile":
+		return "open"
+	case "MkdirAll":
+		return "mkdir"
+	case "RemoveAll":
+		return "remove_all"
+	case "ReadAt":
+		return "read"
+	case "WriteAt":
+		return "write"
+	case "Readdirnames":
+		return "readdir"
+	}
+	return strings.ToLower(op)
+}
+
+func (f *FaultFs) wrap(file File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &FaultFile{lockingFile: lockingFile{file}, fs: f}, nil
+}
+
+func (f *FaultFs) Name() string {
+	return "FaultFs"
+}
+
+func (f *FaultFs) Create(name string) (File, error) {
+	if err := f.fail("Create", name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.source.Create(name))
+}
+
+func (f *FaultFs) Open(name string) (File, error) {
+	if err := f.fail("Open", name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.source.Open(name))
+}
+
+func (f *FaultFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := f.fail("OpenFile", name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.source.OpenFile(name, flag, perm))
+}
+
+func (f *FaultFs) Mkdir(name string, perm os.FileMode) error {
+	if err := f.fail("Mkdir", name); err != nil {
+		return err
+	}
+	return f.source.Mkdir(name, perm)
+}
+
+func (f *FaultFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := f.fail("MkdirAll", path); err != nil {
+		return err
+	}
+	return f.source.MkdirAll(path, perm)
+}
+
+func (f *FaultFs) Remove(name string) error {
+	if err := f.fail("Remove", name); err != nil {
+		return err
+	}
+	return f.source.Remove(name)
+}
+
+func (f *FaultFs) RemoveAll(path string) error {
+	if err := f.fail("RemoveAll", path); err != nil {
+		return err
+	}
+	return f.source.RemoveAll(path)
+}
+
+func (f *FaultFs) Rename(oldname, newname string) error {
+	if rule := f.hit("Rename", oldname, newname); rule != nil && rule.Err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: rule.Err}
+	}
+	return f.source.Rename(oldname, newname)
+}
+
+func (f *FaultFs) Stat(name string) (os.FileInfo, error) {
+	if err := f.fail("Stat", name); err != nil {
+		return nil, err
+	}
+	return f.source.Stat(name)
+}
+
+func (f *FaultFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := f.fail("Lstat", name); err != nil {
+		return nil, false, err
+	}
+	if lstater, ok := f.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := f.source.Stat(name)
+	return fi, false, err
+}
+
+func (f *FaultFs) Chmod(name string, mode os.FileMode) error {
+	if err := f.fail("Chmod", name); err != nil {
+		return err
+	}
+	return f.source.Chmod(name, mode)
+}
+
+func (f *FaultFs) Chown(name string, uid, gid int) error {
+	if err := f.fail("Chown", name); err != nil {
+		return err
+	}
+	return f.source.Chown(name, uid, gid)
+}
+
+func (f *FaultFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.fail("Chtimes", name); err != nil {
+		return err
+	}
+	return f.source.Chtimes(name, atime, mtime)
+}
+
+// FaultFile is a file opened through a FaultFs.
+type FaultFile struct {
+	lockingFile
+	fs *FaultFs
+}
+
+// transfer performs a read or write of p with do, applying the rule hit by
+// the call, if any.
+func (f *FaultFile) transfer(op string, p []byte, do func([]byte) (int, error)) (int, error) {
+	rule := f.fs.hit(op, f.Name())
+	if rule == nil {
+		return do(p)
+	}
+	if rule.Short == 0 && rule.Err != nil {
+		return 0, &os.PathError{Op: methodErrorOp(op), Path: f.Name(), Err: rule.Err}
+	}
+	q := p
+	if rule.Short > 0 && rule.Short < len(p) {
+		q = p[:rule.Short]
+	}
+	n, err := do(q)
+	switch {
+	case err != nil:
+		return n, err
+	case rule.Err != nil:
+		return n, &os.PathError{Op: methodErrorOp(op), Path: f.Name(), Err: rule.Err}
+	case n == len(p):
+		return n, nil
+	case op == "Write" || op == "WriteAt":
+		return n, io.ErrShortWrite
+	case op == "ReadAt":
+		// ReadAt may only return less than asked for with an error.
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+func (f *FaultFile) Read(p []byte) (int, error) {
+	return f.transfer("Read", p, f.File.Read)
+}
+
+func (f *FaultFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.transfer("ReadAt", p, func(q []byte) (int, error) { return f.File.ReadAt(q, off) })
+}
+
+func (f *FaultFile) Write(p []byte) (int, error) {
+	return f.transfer("Write", p, f.File.Write)
+}
+
+func (f *FaultFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.transfer("WriteAt", p, func(q []byte) (int, error) { return f.File.WriteAt(q, off) })
+}
+
+func (f *FaultFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *FaultFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.fs.fail("Seek", f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.Seek(offset, whence)
+}
+
+func (f *FaultFile) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.fs.fail("Readdir", f.Name()); err != nil {
+		return nil, err
+	}
+	return f.File.Readdir(count)
+}
+
+func (f *FaultFile) Readdirnames(n int) ([]string, error) {
+	if err := f.fs.fail("Readdirnames", f.Name()); err != nil {
+		return nil, err
+	}
+	return f.File.Readdirnames(n)
+}
+
+func (f *FaultFile) Stat() (os.FileInfo, error) {
+	if err := f.fs.fail("Stat", f.Name()); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
+
+func (f *FaultFile) Sync() error {
+	if err := f.fs.fail("Sync", f.Name()); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *FaultFile) Truncate(size int64) error {
+	if err := f.fs.fail("Truncate", f.Name()); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+// Close closes the source file even if an error is injected, so that
+// failing closes do not leak it.
+func (f *FaultFile) Close() error {
+	err := f.fs.fail("Close", f.Name())
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
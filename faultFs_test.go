@@ -0,0 +1,114 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFaultFsRules(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{}, 1,
+		FaultRule{Ops: []string{"Create", "OpenFile"}, Path: "/full/*", Err: syscall.ENOSPC},
+		FaultRule{Ops: []string{"Remove"}, Nth: 2, Err: syscall.EACCES},
+		FaultRule{Ops: []string{"Rename"}, Path: "/locked", Err: syscall.EIO},
+	)
+	fs.MkdirAll("/full", 0755)
+
+	_, err := fs.Create("/full/file")
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr.Op != "create" || !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("expected an ENOSPC path error, got %v", err)
+	}
+	if err := WriteFile(fs, "/ok", nil, 0644); err != nil {
+		t.Errorf("unexpected error for a path not matching: %v", err)
+	}
+
+	WriteFile(fs, "/a", nil, 0644)
+	WriteFile(fs, "/b", nil, 0644)
+	WriteFile(fs, "/c", nil, 0644)
+	if err := fs.Remove("/a"); err != nil {
+		t.Error(err)
+	}
+	if err := fs.Remove("/b"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected the second remove to fail, got %v", err)
+	}
+	if err := fs.Remove("/c"); err != nil {
+		t.Error(err)
+	}
+
+	if err := fs.Rename("/ok", "/locked"); !errors.Is(err, syscall.EIO) {
+		t.Errorf("expected the rename to fail, got %v", err)
+	}
+	fs.ClearRules()
+	if err := fs.Rename("/ok", "/locked"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFaultFsShortIO(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{}, 1)
+	WriteFile(fs, "/file", []byte("0123456789"), 0644)
+	fs.AddRule(FaultRule{Ops: []string{"Read", "Write"}, Short: 3})
+	fs.AddRule(FaultRule{Ops: []string{"ReadAt"}, Short: 2, Err: syscall.EIO})
+
+	f, _ := fs.OpenFile("/file", os.O_RDWR, 0)
+	defer f.Close()
+	buf := make([]byte, 10)
+	n, err := f.Read(buf)
+	if n != 3 || err != nil {
+		t.Errorf("expected a short read, got %d, %v", n, err)
+	}
+	n, err = f.ReadAt(buf, 0)
+	if n != 2 || !errors.Is(err, syscall.EIO) {
+		t.Errorf("expected a short failing read, got %d, %v", n, err)
+	}
+	n, err = f.Write([]byte("abcdef"))
+	if n != 3 || err != io.ErrShortWrite {
+		t.Errorf("expected a short write, got %d, %v", n, err)
+	}
+
+	fs.ClearRules()
+	data, _ := ReadFile(fs, "/file")
+	if string(data) != "012abc6789" {
+		t.Errorf("unexpected content %q", data)
+	}
+}
+
+func TestFaultFsProbability(t *testing.T) {
+	failures := func(seed int64) []bool {
+		fs := NewFaultFs(&MemMapFs{}, seed, FaultRule{Ops: []string{"Stat"}, Probability: 0.5, Err: syscall.EIO})
+		var got []bool
+		for i := 0; i < 100; i++ {
+			_, err := fs.Stat("/")
+			got = append(got, err != nil)
+		}
+		return got
+	}
+	a, b := failures(42), failures(42)
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("the same seed gave different failures")
+		}
+		if a[i] {
+			n++
+		}
+	}
+	if n < 25 || n > 75 {
+		t.Errorf("expected about half of the calls to fail, got %d", n)
+	}
+}
+
+func TestFaultFsLatency(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{}, 1, FaultRule{Ops: []string{"Stat"}, Latency: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := fs.Stat("/"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected latency to be added, took %v", elapsed)
+	}
+}
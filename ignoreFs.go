@@ -0,0 +1,435 @@
+package afero
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ Lstater = (*IgnoreFs)(nil)
+
+// IgnoreOptions are the options of an IgnoreFs.
+type IgnoreOptions struct {
+	// Patterns apply to the whole filesystem, as if they were at the top
+	// of an ignore file in the root directory.
+	Patterns []string
+
+	// FileName is the name of the ignore files read in the directories of
+	// the source, ".gitignore" if empty.
+	FileName string
+}
+
+// The IgnoreFs hides the files and directories of a source filesystem
+// matching patterns in the syntax of .gitignore files: they are left out
+// of directory listings, and are reported as not existing by every other
+// operation. As listings leave them out, Walk does not descend into
+// excluded directories.
+//
+// The patterns are those of the options, and of the ignore files found in
+// the directories of the source, the patterns of an ignore file applying
+// to the paths below its directory. As with git:
+//
+//   - a pattern without a slash but a trailing one matches a name at any
+//     level, other patterns are anchored to the directory of their file;
+//   - a trailing slash only matches directories;
+//   - "**" matches any number of directories;
+//   - a pattern prefixed with "!" includes again what previous patterns
+//     excluded, the last pattern matching, with those of deeper ignore
+//     files last, deciding;
+//   - nothing can be included again below an excluded directory.
+//
+// The ignore files themselves are not hidden, unless they match a pattern.
+// They are cached, and read again when their size or modification time
+// change, or when they are changed through the IgnoreFs. An ignore file
+// that cannot be read has no patterns.
+//
+// The content of excluded entries is kept: removing a directory with
+// excluded entries fails with ENOTEMPTY.
+type IgnoreFs struct {
+	source   Fs
+	rules    []ignoreRule
+	fileName string
+
+	mu    sync.Mutex
+	files map[string]*ignoreFile // by path
+}
+
+// ignoreRule is a pattern of an ignore file.
+type ignoreRule struct {
+	depth    int      // of the directory of the ignore file
+	parts    []string // of the pattern, split on slashes
+	anchored bool
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreFile is an ignore file read.
+type ignoreFile struct {
+	size    int64
+	modTime time.Time
+	rules   []ignoreRule
+}
+
+func NewIgnoreFs(source Fs, opts IgnoreOptions) *IgnoreFs {
+	if opts.FileName == "" {
+		opts.FileName = ".gitignore"
+	}
+	return &IgnoreFs{
+		source:   source,
+		rules:    parseIgnore(strings.Join(opts.Patterns, "\n"), 0),
+		fileName: opts.FileName,
+		files:    make(map[string]*ignoreFile),
+	}
+}
+
+// parseIgnore parses the patterns of an ignore file in a directory at the
+// given depth.
+func parseIgnore(data string, depth int) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		// Trailing spaces are dropped, unless escaped.
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		rule := ignoreRule{depth: depth}
+		if line[0] == '!' {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimLeft(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.parts = strings.Split(line, "/")
+		valid := true
+		for _, part := range rule.parts {
+			if _, err := path.Match(part, ""); err != nil {
+				valid = false
+			}
+		}
+		if valid {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// splitPath splits name into its elements, none for the root.
+func splitPath(name string) []string {
+	name = strings.Trim(filepath.ToSlash(normalizePath(name)), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// matchParts tells whether the elements of a path match those of a
+// pattern.
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// A trailing "**" matches everything inside.
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchRules tells whether the path of the given elements is excluded by
+// the rules.
+func matchRules(rules []ignoreRule, parts []string, isDir bool) bool {
+	excluded := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir || len(parts) <= rule.depth {
+			continue
+		}
+		rel := parts[rule.depth:]
+		var matched bool
+		if rule.anchored {
+			matched = matchParts(rule.parts, rel)
+		} else {
+			matched, _ = path.Match(rule.parts[0], rel[len(rel)-1])
+		}
+		if matched {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// load returns the rules of the ignore file of dir, at the given depth.
+func (g *IgnoreFs) load(dir string, depth int) []ignoreRule {
+	name := filepath.Join(dir, g.fileName)
+	fi, err := g.source.Stat(name)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil || fi.IsDir() {
+		delete(g.files, name)
+		return nil
+	}
+	if file, ok := g.files[name]; ok && file.size == fi.Size() && file.modTime.Equal(fi.ModTime()) {
+		return file.rules
+	}
+	data, err := ReadFile(g.source, name)
+	if err != nil {
+		delete(g.files, name)
+		return nil
+	}
+	file := &ignoreFile{size: fi.Size(), modTime: fi.ModTime(), rules: parseIgnore(string(data), depth)}
+	g.files[name] = file
+	return file.rules
+}
+
+// forget drops name from the cache of the ignore files.
+func (g *IgnoreFs) forget(name string) {
+	g.mu.Lock()
+	delete(g.files, normalizePath(name))
+	g.mu.Unlock()
+}
+
+// rulesFor returns the rules applying to the entries of dir, or whether
+// dir is excluded itself.
+func (g *IgnoreFs) rulesFor(dir string) ([]ignoreRule, bool) {
+	rules := append(g.rules[:len(g.rules):len(g.rules)], g.load(FilePathSeparator, 0)...)
+	parts := splitPath(dir)
+	current := FilePathSeparator
+	for i, part := range parts {
+		if matchRules(rules, parts[:i+1], true) {
+			return nil, true
+		}
+		current = filepath.Join(current, part)
+		rules = append(rules, g.load(current, i+1)...)
+	}
+	return rules, false
+}
+
+// ignored tells whether name, which is a directory or not, is excluded.
+func (g *IgnoreFs) ignored(name string, isDir bool) bool {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return false
+	}
+	rules, excluded := g.rulesFor(filepath.Dir(normalizePath(name)))
+	return excluded || matchRules(rules, parts, isDir)
+}
+
+// check fails with ENOENT if name, as it is in the source, is excluded.
+func (g *IgnoreFs) check(op, name string) error {
+	fi, err := lstatIfPossible(g.source, name)
+	if g.ignored(name, err == nil && fi.IsDir()) {
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+	}
+	return nil
+}
+
+func (g *IgnoreFs) Name() string {
+	return "IgnoreFs"
+}
+
+func (g *IgnoreFs) Create(name string) (File, error) {
+	return g.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (g *IgnoreFs) Open(name string) (File, error) {
+	return g.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (g *IgnoreFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := g.check("open", name); err != nil {
+		return nil, err
+	}
+	f, err := g.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &IgnoreFile{lockingFile: lockingFile{f}, fs: g, name: name, writable: flag&(os.O_WRONLY|os.O_RDWR) != 0}, nil
+}
+
+func (g *IgnoreFs) Mkdir(name string, perm os.FileMode) error {
+	if g.ignored(name, true) {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOENT}
+	}
+	return g.source.Mkdir(name, perm)
+}
+
+func (g *IgnoreFs) MkdirAll(path string, perm os.FileMode) error {
+	if g.ignored(path, true) {
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOENT}
+	}
+	return g.source.MkdirAll(path, perm)
+}
+
+func (g *IgnoreFs) Remove(name string) error {
+	if err := g.check("remove", name); err != nil {
+		return err
+	}
+	if fi, err := lstatIfPossible(g.source, name); err == nil && fi.IsDir() {
+		// Not all sources fail on directories with entries, excluded here.
+		if names, _ := readDirNames(g.source, name); len(names) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	g.forget(name)
+	return g.source.Remove(name)
+}
+
+// RemoveAll removes path and the entries it contains which are not
+// excluded. It fails with ENOTEMPTY on directories left with excluded
+// entries.
+func (g *IgnoreFs) RemoveAll(path string) error {
+	fi, err := lstatIfPossible(g.source, path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && g.ignored(path, fi.IsDir()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return g.Remove(path)
+	}
+	dir, err := g.Open(path)
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	// The ignore file goes last, and only if nothing it excludes is left,
+	// not to show what it excludes.
+	hasIgnore := false
+	for _, name := range names {
+		if name == g.fileName {
+			hasIgnore = true
+		} else if err := g.RemoveAll(filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+	left, err := readDirNames(g.source, path)
+	if err != nil {
+		return err
+	}
+	if len(left) > 1 || len(left) == 1 && (!hasIgnore || left[0] != g.fileName) {
+		return &os.PathError{Op: "remove_all", Path: path, Err: syscall.ENOTEMPTY}
+	}
+	if hasIgnore {
+		if err := g.Remove(filepath.Join(path, g.fileName)); err != nil {
+			return err
+		}
+	}
+	return g.source.Remove(path)
+}
+
+func (g *IgnoreFs) Rename(oldname, newname string) error {
+	fi, err := lstatIfPossible(g.source, oldname)
+	isDir := err == nil && fi.IsDir()
+	if g.ignored(oldname, isDir) || g.ignored(newname, isDir) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOENT}
+	}
+	g.forget(oldname)
+	g.forget(newname)
+	return g.source.Rename(oldname, newname)
+}
+
+func (g *IgnoreFs) Stat(name string) (os.FileInfo, error) {
+	if err := g.check("stat", name); err != nil {
+		return nil, err
+	}
+	return g.source.Stat(name)
+}
+
+func (g *IgnoreFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := g.check("lstat", name); err != nil {
+		return nil, false, err
+	}
+	if lstater, ok := g.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := g.source.Stat(name)
+	return fi, false, err
+}
+
+func (g *IgnoreFs) Chmod(name string, mode os.FileMode) error {
+	if err := g.check("chmod", name); err != nil {
+		return err
+	}
+	return g.source.Chmod(name, mode)
+}
+
+func (g *IgnoreFs) Chown(name string, uid, gid int) error {
+	if err := g.check("chown", name); err != nil {
+		return err
+	}
+	return g.source.Chown(name, uid, gid)
+}
+
+func (g *IgnoreFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := g.check("chtimes", name); err != nil {
+		return err
+	}
+	return g.source.Chtimes(name, atime, mtime)
+}
+
+// IgnoreFile is a file opened through an IgnoreFs.
+type IgnoreFile struct {
+	lockingFile
+	fs       *IgnoreFs
+	name     string
+	writable bool
+}
+
+// Close reads the patterns again if the file is an ignore file written.
+func (f *IgnoreFile) Close() error {
+	if f.writable && filepath.Base(f.name) == f.fs.fileName {
+		defer f.fs.forget(f.name)
+	}
+	return f.File.Close()
+}
+
+// Readdir leaves out the excluded entries.
+func (f *IgnoreFile) Readdir(count int) ([]os.FileInfo, error) {
+	rules, _ := f.fs.rulesFor(f.name)
+	parts := splitPath(f.name)
+	return readdirFiltered(f.File, count, func(fi os.FileInfo) (os.FileInfo, bool) {
+		return fi, !matchRules(rules, append(parts[:len(parts):len(parts)], fi.Name()), fi.IsDir())
+	})
+}
+
+func (f *IgnoreFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
@@ -0,0 +1,124 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func newIgnoreTestFs(t *testing.T) (Fs, *IgnoreFs) {
+	source := &MemMapFs{}
+	for _, dir := range []string{"/node_modules/lib", "/build", "/sub/build", "/sub/node_modules", "/docs/a/b"} {
+		source.MkdirAll(dir, 0755)
+	}
+	files := map[string]string{
+		"/.gitignore":              "# dependencies\nnode_modules/\n*.log\n!keep.log\n/build\ndocs/**/*.tmp\n!node_modules/keep\n",
+		"/sub/.gitignore":          "!debug.log\nlocal.txt   \n",
+		"/main.go":                 "",
+		"/app.log":                 "",
+		"/keep.log":                "",
+		"/node_modules/keep":       "",
+		"/node_modules/lib/x.js":   "",
+		"/build/out":               "",
+		"/sub/build/out":           "",
+		"/sub/debug.log":           "",
+		"/sub/trace.log":           "",
+		"/sub/local.txt":           "",
+		"/sub/node_modules/y.js":   "",
+		"/docs/x.tmp":              "",
+		"/docs/a/b/x.tmp":          "",
+		"/docs/a/b/x.md":           "",
+		"/docs/node_modules":       "a file",
+		"/docs/a/b/node_modules/z": "",
+	}
+	for name, content := range files {
+		if err := WriteFile(source, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return source, NewIgnoreFs(source, IgnoreOptions{Patterns: []string{"*.md"}})
+}
+
+func TestIgnoreFsWalk(t *testing.T) {
+	_, fs := newIgnoreTestFs(t)
+	var paths []string
+	err := Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(path))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/",
+		"/.gitignore",
+		"/docs",
+		"/docs/a",
+		"/docs/a/b",
+		"/docs/node_modules",
+		"/keep.log",
+		"/main.go",
+		"/sub",
+		"/sub/.gitignore",
+		"/sub/build",
+		"/sub/build/out",
+		"/sub/debug.log",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestIgnoreFsHidden(t *testing.T) {
+	source, fs := newIgnoreTestFs(t)
+	for _, name := range []string{"/app.log", "/node_modules", "/node_modules/keep", "/build/out", "/sub/local.txt", "/docs/a/b/x.tmp"} {
+		if _, err := fs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected ENOENT, got %v", name, err)
+		}
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected ENOENT, got %v", name, err)
+		}
+	}
+	if _, err := fs.Create("/new.log"); !os.IsNotExist(err) {
+		t.Errorf("expected creating an excluded file to fail, got %v", err)
+	}
+	if err := fs.Rename("/main.go", "/main.log"); err == nil {
+		t.Error("expected renaming to an excluded name to fail")
+	}
+
+	// Patterns are read again when their file changes.
+	if err := WriteFile(fs, "/sub/.gitignore", []byte("*.go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/sub/local.txt"); err != nil {
+		t.Errorf("expected the new patterns to apply, got %v", err)
+	}
+	WriteFile(source, "/sub/x.go", nil, 0644)
+	if _, err := fs.Stat("/sub/x.go"); !os.IsNotExist(err) {
+		t.Errorf("expected the new patterns to apply, got %v", err)
+	}
+
+	// Excluded entries are kept.
+	if err := fs.RemoveAll("/sub/build"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Stat("/sub/build"); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be removed, got %v", err)
+	}
+	if err := fs.RemoveAll("/sub"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("expected ENOTEMPTY, got %v", err)
+	}
+	if err := fs.Remove("/docs/a/b"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("expected ENOTEMPTY, got %v", err)
+	}
+	names, _ := readDirNames(source, "/sub")
+	if !reflect.DeepEqual(names, []string{".gitignore", "debug.log", "node_modules", "trace.log", "x.go"}) {
+		t.Errorf("expected the excluded entries to be kept, got %v", names)
+	}
+}
@@ -0,0 +1,377 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+var _ Symlinker = (*InterceptFs)(nil)
+
+// errNoFile is the error of an open call for which the handlers returned
+// neither a file nor an error.
+var errNoFile = WrapError(os.ErrInvalid, errors.New("no file returned"))
+
+// A Call is an operation made on an InterceptFs or on a file opened
+// through it, as passed to the handlers. Only the fields used by the
+// operation are set.
+type Call struct {
+	// Op is the name of the method called: Create, Open, OpenFile, Mkdir,
+	// MkdirAll, Remove, RemoveAll, Rename, Stat, Lstat, Chmod, Chown,
+	// Chtimes, Symlink, Readlink, and for files Read, ReadAt, Write,
+	// WriteAt, Seek, Readdir, Readdirnames, Stat, Sync, Truncate and
+	// Close.
+	Op string
+	// File is the file the call is made on, nil for filesystem calls.
+	File File
+	// Name is the path of the call, or the name of File. For Symlink it
+	// is the new link.
+	Name string
+	// NewName is the new path for Rename, and the target for Symlink.
+	NewName string
+
+	Flag         int
+	Perm         os.FileMode // also the mode of Chmod
+	UID, GID     int
+	Atime, Mtime time.Time
+	// Buf is the buffer read into or written from.
+	Buf []byte
+	// Offset is the offset of ReadAt, WriteAt and Seek, and the size of
+	// Truncate.
+	Offset int64
+	Whence int
+	// Count is the count of Readdir and Readdirnames.
+	Count int
+}
+
+// Error wraps err in an *os.PathError, or an *os.LinkError for Rename and
+// Symlink, describing the call, as the methods of Fs and File return.
+func (c *Call) Error(err error) error {
+	switch c.Op {
+	case "Rename":
+		return &os.LinkError{Op: "rename", Old: c.Name, New: c.NewName, Err: err}
+	case "Symlink":
+		return &os.LinkError{Op: "symlink", Old: c.NewName, New: c.Name, Err: err}
+	}
+	return &os.PathError{Op: methodErrorOp(c.Op), Path: c.Name, Err: err}
+}
+
+// A Result holds what a call returns. Only the fields returned by the
+// operation are used.
+type Result struct {
+	// File is the file opened. It is wrapped for the calls made on it to
+	// go through the handlers too.
+	File File
+	Info os.FileInfo
+	// Lstat tells whether Lstat was used, as LstatIfPossible returns.
+	Lstat bool
+	// N is the number of bytes read or written.
+	N int
+	// Offset is the offset returned by Seek.
+	Offset int64
+	Infos  []os.FileInfo
+	Names  []string
+	// Link is the target returned by Readlink.
+	Link string
+	Err  error
+}
+
+// A Handler performs a call.
+type Handler func(c *Call) Result
+
+// An Interceptor wraps a handler, usually to do something before and
+// after calling it, or instead of calling it.
+type Interceptor func(next Handler) Handler
+
+// Before returns an interceptor calling fn before each call. If fn returns
+// an error, the call is not made and fails with it; Call.Error helps
+// building it.
+func Before(fn func(c *Call) error) Interceptor {
+	return func(next Handler) Handler {
+		return func(c *Call) Result {
+			if err := fn(c); err != nil {
+				return Result{Err: err}
+			}
+			return next(c)
+		}
+	}
+}
+
+// After returns an interceptor calling fn after each call, with what it
+// returned, which fn may change.
+func After(fn func(c *Call, r *Result)) Interceptor {
+	return func(next Handler) Handler {
+		return func(c *Call) Result {
+			r := next(c)
+			fn(c, &r)
+			return r
+		}
+	}
+}
+
+// The InterceptFs passes all calls made to a source filesystem, and to the
+// files opened through it, through a chain of interceptors. It provides
+// the whole of the Fs and File interfaces, as well as Symlinker, so that a
+// wrapper only has to write the interceptors for the calls it is about.
+//
+// The first interceptor is the outermost one, seeing the calls first and
+// their results last.
+type InterceptFs struct {
+	source  Fs
+	handler Handler
+}
+
+func NewInterceptFs(source Fs, interceptors ...Interceptor) *InterceptFs {
+	i := &InterceptFs{source: source}
+	i.handler = i.do
+	for n := len(interceptors) - 1; n >= 0; n-- {
+		i.handler = interceptors[n](i.handler)
+	}
+	return i
+}
+
+// do performs a call on the source filesystem or file.
+func (i *InterceptFs) do(c *Call) Result {
+	if c.File != nil {
+		return interceptFileDo(c)
+	}
+	var r Result
+	switch c.Op {
+	case "Create":
+		r.File, r.Err = i.source.Create(c.Name)
+	case "Open":
+		r.File, r.Err = i.source.Open(c.Name)
+	case "OpenFile":
+		r.File, r.Err = i.source.OpenFile(c.Name, c.Flag, c.Perm)
+	case "Mkdir":
+		r.Err = i.source.Mkdir(c.Name, c.Perm)
+	case "MkdirAll":
+		r.Err = i.source.MkdirAll(c.Name, c.Perm)
+	case "Remove":
+		r.Err = i.source.Remove(c.Name)
+	case "RemoveAll":
+		r.Err = i.source.RemoveAll(c.Name)
+	case "Rename":
+		r.Err = i.source.Rename(c.Name, c.NewName)
+	case "Stat":
+		r.Info, r.Err = i.source.Stat(c.Name)
+	case "Lstat":
+		if lstater, ok := i.source.(Lstater); ok {
+			r.Info, r.Lstat, r.Err = lstater.LstatIfPossible(c.Name)
+		} else {
+			r.Info, r.Err = i.source.Stat(c.Name)
+		}
+	case "Chmod":
+		r.Err = i.source.Chmod(c.Name, c.Perm)
+	case "Chown":
+		r.Err = i.source.Chown(c.Name, c.UID, c.GID)
+	case "Chtimes":
+		r.Err = i.source.Chtimes(c.Name, c.Atime, c.Mtime)
+	case "Symlink":
+		if linker, ok := i.source.(Linker); ok {
+			r.Err = linker.SymlinkIfPossible(c.NewName, c.Name)
+		} else {
+			r.Err = c.Error(ErrNoSymlink)
+		}
+	case "Readlink":
+		if reader, ok := i.source.(LinkReader); ok {
+			r.Link, r.Err = reader.ReadlinkIfPossible(c.Name)
+		} else {
+			r.Err = c.Error(ErrNoReadlink)
+		}
+	default:
+		r.Err = c.Error(ErrNotSupported)
+	}
+	return r
+}
+
+func interceptFileDo(c *Call) Result {
+	var r Result
+	switch c.Op {
+	case "Close":
+		r.Err = c.File.Close()
+	case "Read":
+		r.N, r.Err = c.File.Read(c.Buf)
+	case "ReadAt":
+		r.N, r.Err = c.File.ReadAt(c.Buf, c.Offset)
+	case "Write":
+		r.N, r.Err = c.File.Write(c.Buf)
+	case "WriteAt":
+		r.N, r.Err = c.File.WriteAt(c.Buf, c.Offset)
+	case "Seek":
+		r.Offset, r.Err = c.File.Seek(c.Offset, c.Whence)
+	case "Readdir":
+		r.Infos, r.Err = c.File.Readdir(c.Count)
+	case "Readdirnames":
+		r.Names, r.Err = c.File.Readdirnames(c.Count)
+	case "Stat":
+		r.Info, r.Err = c.File.Stat()
+	case "Sync":
+		r.Err = c.File.Sync()
+	case "Truncate":
+		r.Err = c.File.Truncate(c.Offset)
+	default:
+		r.Err = c.Error(ErrNotSupported)
+	}
+	return r
+}
+
+func (i *InterceptFs) open(c *Call) (File, error) {
+	r := i.handler(c)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if r.File == nil {
+		return nil, c.Error(errNoFile)
+	}
+	return &InterceptFile{lockingFile: lockingFile{r.File}, fs: i}, nil
+}
+
+func (i *InterceptFs) Name() string {
+	return "InterceptFs"
+}
+
+func (i *InterceptFs) Create(name string) (File, error) {
+	return i.open(&Call{Op: "Create", Name: name})
+}
+
+func (i *InterceptFs) Open(name string) (File, error) {
+	return i.open(&Call{Op: "Open", Name: name})
+}
+
+func (i *InterceptFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return i.open(&Call{Op: "OpenFile", Name: name, Flag: flag, Perm: perm})
+}
+
+func (i *InterceptFs) Mkdir(name string, perm os.FileMode) error {
+	return i.handler(&Call{Op: "Mkdir", Name: name, Perm: perm}).Err
+}
+
+func (i *InterceptFs) MkdirAll(path string, perm os.FileMode) error {
+	return i.handler(&Call{Op: "MkdirAll", Name: path, Perm: perm}).Err
+}
+
+func (i *InterceptFs) Remove(name string) error {
+	return i.handler(&Call{Op: "Remove", Name: name}).Err
+}
+
+func (i *InterceptFs) RemoveAll(path string) error {
+	return i.handler(&Call{Op: "RemoveAll", Name: path}).Err
+}
+
+func (i *InterceptFs) Rename(oldname, newname string) error {
+	return i.handler(&Call{Op: "Rename", Name: oldname, NewName: newname}).Err
+}
+
+func (i *InterceptFs) Stat(name string) (os.FileInfo, error) {
+	r := i.handler(&Call{Op: "Stat", Name: name})
+	return r.Info, r.Err
+}
+
+func (i *InterceptFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	r := i.handler(&Call{Op: "Lstat", Name: name})
+	return r.Info, r.Lstat, r.Err
+}
+
+func (i *InterceptFs) Chmod(name string, mode os.FileMode) error {
+	return i.handler(&Call{Op: "Chmod", Name: name, Perm: mode}).Err
+}
+
+func (i *InterceptFs) Chown(name string, uid, gid int) error {
+	return i.handler(&Call{Op: "Chown", Name: name, UID: uid, GID: gid}).Err
+}
+
+func (i *InterceptFs) Chtimes(name string, atime, mtime time.Time) error {
+	return i.handler(&Call{Op: "Chtimes", Name: name, Atime: atime, Mtime: mtime}).Err
+}
+
+func (i *InterceptFs) SymlinkIfPossible(oldname, newname string) error {
+	return i.handler(&Call{Op: "Symlink", Name: newname, NewName: oldname}).Err
+}
+
+func (i *InterceptFs) ReadlinkIfPossible(name string) (string, error) {
+	r := i.handler(&Call{Op: "Readlink", Name: name})
+	return r.Link, r.Err
+}
+
+// InterceptFile is a file opened through an InterceptFs.
+type InterceptFile struct {
+	lockingFile
+	fs *InterceptFs
+}
+
+func (f *InterceptFile) call(op string) *Call {
+	return &Call{Op: op, File: f.File, Name: f.File.Name()}
+}
+
+func (f *InterceptFile) Close() error {
+	return f.fs.handler(f.call("Close")).Err
+}
+
+func (f *InterceptFile) Read(p []byte) (int, error) {
+	c := f.call("Read")
+	c.Buf = p
+	r := f.fs.handler(c)
+	return r.N, r.Err
+}
+
+func (f *InterceptFile) ReadAt(p []byte, off int64) (int, error) {
+	c := f.call("ReadAt")
+	c.Buf, c.Offset = p, off
+	r := f.fs.handler(c)
+	return r.N, r.Err
+}
+
+func (f *InterceptFile) Write(p []byte) (int, error) {
+	c := f.call("Write")
+	c.Buf = p
+	r := f.fs.handler(c)
+	return r.N, r.Err
+}
+
+func (f *InterceptFile) WriteAt(p []byte, off int64) (int, error) {
+	c := f.call("WriteAt")
+	c.Buf, c.Offset = p, off
+	r := f.fs.handler(c)
+	return r.N, r.Err
+}
+
+func (f *InterceptFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *InterceptFile) Seek(offset int64, whence int) (int64, error) {
+	c := f.call("Seek")
+	c.Offset, c.Whence = offset, whence
+	r := f.fs.handler(c)
+	return r.Offset, r.Err
+}
+
+func (f *InterceptFile) Readdir(count int) ([]os.FileInfo, error) {
+	c := f.call("Readdir")
+	c.Count = count
+	r := f.fs.handler(c)
+	return r.Infos, r.Err
+}
+
+func (f *InterceptFile) Readdirnames(n int) ([]string, error) {
+	c := f.call("Readdirnames")
+	c.Count = n
+	r := f.fs.handler(c)
+	return r.Names, r.Err
+}
+
+func (f *InterceptFile) Stat() (os.FileInfo, error) {
+	r := f.fs.handler(f.call("Stat"))
+	return r.Info, r.Err
+}
+
+func (f *InterceptFile) Sync() error {
+	return f.fs.handler(f.call("Sync")).Err
+}
+
+func (f *InterceptFile) Truncate(size int64) error {
+	c := f.call("Truncate")
+	c.Offset = size
+	return f.fs.handler(c).Err
+}
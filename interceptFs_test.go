@@ -0,0 +1,139 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// interceptReadOnly is a read only policy written with an interceptor.
+var interceptReadOnly = Before(func(c *Call) error {
+	switch c.Op {
+	case "Create", "Mkdir", "MkdirAll", "Remove", "RemoveAll", "Rename",
+		"Chmod", "Chown", "Chtimes", "Symlink", "Write", "WriteAt", "Truncate":
+		return c.Error(syscall.EPERM)
+	case "OpenFile":
+		if c.Flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return c.Error(syscall.EPERM)
+		}
+	}
+	return nil
+})
+
+func TestInterceptFsBefore(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/a", []byte("data"), 0644)
+	fs := NewInterceptFs(base, interceptReadOnly)
+
+	if data, err := ReadFile(fs, "/a"); err != nil || string(data) != "data" {
+		t.Errorf("expected reads to go through, got %q, %v", data, err)
+	}
+	err := WriteFile(fs, "/b", []byte("x"), 0644)
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr.Op != "open" || perr.Path != "/b" || !os.IsPermission(err) {
+		t.Errorf("expected an open error, got %v", err)
+	}
+	err = fs.Rename("/a", "/c")
+	var lerr *os.LinkError
+	if !errors.As(err, &lerr) || lerr.New != "/c" || !os.IsPermission(err) {
+		t.Errorf("expected a rename error, got %v", err)
+	}
+	f, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); !os.IsPermission(err) {
+		t.Errorf("expected file writes to be intercepted, got %v", err)
+	}
+
+	// An interceptor returning no file nor error.
+	fs = NewInterceptFs(base, func(next Handler) Handler {
+		return func(c *Call) Result { return Result{} }
+	})
+	if _, err := fs.Open("/a"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected an error for the missing file, got %v", err)
+	}
+}
+
+func TestInterceptFsAfter(t *testing.T) {
+	base := &MemMapFs{}
+	base.MkdirAll("/dir", 0755)
+	WriteFile(base, "/dir/.hidden", nil, 0644)
+	WriteFile(base, "/dir/visible", nil, 0644)
+
+	hide := After(func(c *Call, r *Result) {
+		if c.Op != "Readdirnames" {
+			return
+		}
+		names := r.Names[:0]
+		for _, name := range r.Names {
+			if !strings.HasPrefix(name, ".") {
+				names = append(names, name)
+			}
+		}
+		r.Names = names
+	})
+	var ops []string
+	trace := func(tag string) Interceptor {
+		return func(next Handler) Handler {
+			return func(c *Call) Result {
+				ops = append(ops, tag+">"+c.Op)
+				r := next(c)
+				ops = append(ops, tag+"<"+c.Op)
+				return r
+			}
+		}
+	}
+	fs := NewInterceptFs(base, trace("outer"), hide, trace("inner"))
+
+	d, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "visible" {
+		t.Errorf("expected the hidden file to be filtered, got %v", names)
+	}
+	d.Close()
+
+	want := "outer>Open inner>Open inner<Open outer<Open " +
+		"outer>Readdirnames inner>Readdirnames inner<Readdirnames outer<Readdirnames " +
+		"outer>Close inner>Close inner<Close outer<Close"
+	if got := strings.Join(ops, " "); got != want {
+		t.Errorf("expected calls in the order\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestInterceptFsSymlinks(t *testing.T) {
+	dir, err := TempDir(NewOsFs(), "", "afero-intercept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewInterceptFs(NewOsFs())
+	WriteFile(fs, filepath.Join(dir, "target"), []byte("x"), 0644)
+	link := filepath.Join(dir, "link")
+	if err := fs.SymlinkIfPossible("target", link); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := fs.ReadlinkIfPossible(link); err != nil || target != "target" {
+		t.Errorf("expected the link target, got %q, %v", target, err)
+	}
+	fi, lstat, err := fs.LstatIfPossible(link)
+	if err != nil || !lstat || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected to lstat the link, got %v, %t, %v", fi, lstat, err)
+	}
+
+	mfs := NewInterceptFs(&MemMapFs{})
+	if err := mfs.SymlinkIfPossible("a", "/b"); !errors.Is(err, ErrNoSymlink) {
+		t.Errorf("expected ErrNoSymlink, got %v", err)
+	}
+}
@@ -0,0 +1,328 @@
+package afero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Lstater = (*LeakFs)(nil)
+
+// ErrOpenHandles is wrapped by the error CheckNoOpenHandles returns when
+// handles are left open.
+var ErrOpenHandles = errors.New("file handles left open")
+
+// OpenHandle describes a file handle opened through a LeakFs and not
+// closed yet.
+type OpenHandle struct {
+	Name   string
+	Opened time.Time
+	// Stack is the stack of the call which opened the handle, formatted
+	// as in a panic.
+	Stack string
+}
+
+// The LeakFs keeps track of the file handles opened through it and not
+// closed yet, along with the stack of the calls which opened them, to find
+// the handles which are never closed.
+//
+// A UnionFile holds two handles, one from each layer; to check that both
+// are closed, wrap each layer of the union filesystem in a LeakFs.
+//
+// The handles of a LeakFs fail with ErrFileClosed once closed, whatever
+// the source filesystem does.
+type LeakFs struct {
+	source Fs
+
+	mu   sync.Mutex
+	open map[*LeakFile]struct{}
+}
+
+func NewLeakFs(source Fs) *LeakFs {
+	return &LeakFs{source: source, open: make(map[*LeakFile]struct{})}
+}
+
+// OpenHandles returns the handles open, oldest first.
+func (l *LeakFs) OpenHandles() []OpenHandle {
+	return l.LongLived(0)
+}
+
+// LongLived returns the handles which have been open for at least age,
+// oldest first.
+func (l *LeakFs) LongLived(age time.Duration) []OpenHandle {
+	now := time.Now()
+	l.mu.Lock()
+	files := make([]*LeakFile, 0, len(l.open))
+	for f := range l.open {
+		if now.Sub(f.opened) >= age {
+			files = append(files, f)
+		}
+	}
+	l.mu.Unlock()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].opened.Before(files[j].opened) })
+	handles := make([]OpenHandle, len(files))
+	for i, f := range files {
+		handles[i] = OpenHandle{Name: f.Name(), Opened: f.opened, Stack: leakStack(f.stack)}
+	}
+	return handles
+}
+
+// WriteReport writes the handles which have been open for at least age,
+// with the stacks which opened them, to w.
+func (l *LeakFs) WriteReport(w io.Writer, age time.Duration) error {
+	_, err := io.WriteString(w, leakReport(l.LongLived(age)))
+	return err
+}
+
+// CheckNoOpenHandles returns an error wrapping ErrOpenHandles and listing
+// the handles open, if any.
+func (l *LeakFs) CheckNoOpenHandles() error {
+	handles := l.OpenHandles()
+	if len(handles) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d\n%s", ErrOpenHandles, len(handles), leakReport(handles))
+}
+
+// AssertNoOpenHandles reports the handles open as an error of the test t,
+// typically a *testing.T.
+func (l *LeakFs) AssertNoOpenHandles(t interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}) {
+	t.Helper()
+	if err := l.CheckNoOpenHandles(); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func leakReport(handles []OpenHandle) string {
+	var b strings.Builder
+	now := time.Now()
+	for _, h := range handles {
+		fmt.Fprintf(&b, "%s opened %v ago by:\n%s\n", h.Name, now.Sub(h.Opened).Round(time.Millisecond), h.Stack)
+	}
+	return b.String()
+}
+
+func leakStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// wrap tracks a file opened by the caller of the caller of wrap.
+func (l *LeakFs) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(3, pcs)]
+	lf := &LeakFile{File: f, fs: l, opened: time.Now(), stack: pcs}
+	l.mu.Lock()
+	l.open[lf] = struct{}{}
+	l.mu.Unlock()
+	return lf, nil
+}
+
+func (l *LeakFs) Name() string {
+	return "LeakFs"
+}
+
+func (l *LeakFs) Create(name string) (File, error) {
+	return l.wrap(l.source.Create(name))
+}
+
+func (l *LeakFs) Open(name string) (File, error) {
+	return l.wrap(l.source.Open(name))
+}
+
+func (l *LeakFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return l.wrap(l.source.OpenFile(name, flag, perm))
+}
+
+func (l *LeakFs) Mkdir(name string, perm os.FileMode) error {
+	return l.source.Mkdir(name, perm)
+}
+
+func (l *LeakFs) MkdirAll(path string, perm os.FileMode) error {
+	return l.source.MkdirAll(path, perm)
+}
+
+func (l *LeakFs) Remove(name string) error {
+	return l.source.Remove(name)
+}
+
+func (l *LeakFs) RemoveAll(path string) error {
+	return l.source.RemoveAll(path)
+}
+
+func (l *LeakFs) Rename(oldname, newname string) error {
+	return l.source.Rename(oldname, newname)
+}
+
+func (l *LeakFs) Stat(name string) (os.FileInfo, error) {
+	return l.source.Stat(name)
+}
+
+func (l *LeakFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lstater, ok := l.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := l.source.Stat(name)
+	return fi, false, err
+}
+
+func (l *LeakFs) Chmod(name string, mode os.FileMode) error {
+	return l.source.Chmod(name, mode)
+}
+
+func (l *LeakFs) Chown(name string, uid, gid int) error {
+	return l.source.Chown(name, uid, gid)
+}
+
+func (l *LeakFs) Chtimes(name string, atime, mtime time.Time) error {
+	return l.source.Chtimes(name, atime, mtime)
+}
+
+// LeakFile is a file opened through a LeakFs.
+type LeakFile struct {
+	File
+	fs     *LeakFs
+	opened time.Time
+	stack  []uintptr
+	closed int32
+}
+
+// check returns an *os.PathError wrapping ErrFileClosed if f is closed.
+func (f *LeakFile) check(op string) error {
+	if atomic.LoadInt32(&f.closed) != 0 {
+		return &os.PathError{Op: op, Path: f.Name(), Err: ErrFileClosed}
+	}
+	return nil
+}
+
+// Close closes the source file the first time only.
+func (f *LeakFile) Close() error {
+	if !atomic.CompareAndSwapInt32(&f.closed, 0, 1) {
+		return &os.PathError{Op: "close", Path: f.Name(), Err: ErrFileClosed}
+	}
+	f.fs.mu.Lock()
+	delete(f.fs.open, f)
+	f.fs.mu.Unlock()
+	return f.File.Close()
+}
+
+func (f *LeakFile) Read(p []byte) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *LeakFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *LeakFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+	return f.File.Seek(offset, whence)
+}
+
+func (f *LeakFile) Write(p []byte) (int, error) {
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *LeakFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *LeakFile) WriteString(s string) (int, error) {
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+	return f.File.WriteString(s)
+}
+
+func (f *LeakFile) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.check("readdir"); err != nil {
+		return nil, err
+	}
+	return f.File.Readdir(count)
+}
+
+func (f *LeakFile) Readdirnames(n int) ([]string, error) {
+	if err := f.check("readdir"); err != nil {
+		return nil, err
+	}
+	return f.File.Readdirnames(n)
+}
+
+func (f *LeakFile) Stat() (os.FileInfo, error) {
+	if err := f.check("stat"); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
+
+func (f *LeakFile) Sync() error {
+	if err := f.check("sync"); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *LeakFile) Truncate(size int64) error {
+	if err := f.check("truncate"); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+func (f *LeakFile) Lock(ctx context.Context, exclusive bool) error {
+	if err := f.check("lock"); err != nil {
+		return err
+	}
+	return LockFile(ctx, f.File, exclusive)
+}
+
+func (f *LeakFile) TryLock(exclusive bool) error {
+	if err := f.check("lock"); err != nil {
+		return err
+	}
+	return TryLockFile(f.File, exclusive)
+}
+
+func (f *LeakFile) Unlock() error {
+	if err := f.check("unlock"); err != nil {
+		return err
+	}
+	return UnlockFile(f.File)
+}
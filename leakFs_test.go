@@ -0,0 +1,119 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type leakRecorder struct {
+	errors []string
+}
+
+func (r *leakRecorder) Helper() {}
+
+func (r *leakRecorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func leakOpen(fs Fs, name string) (File, error) {
+	return fs.Open(name)
+}
+
+func TestLeakFs(t *testing.T) {
+	fs := NewLeakFs(&MemMapFs{})
+	WriteFile(fs, "/a", []byte("data"), 0644)
+	fs.AssertNoOpenHandles(t)
+
+	f, err := leakOpen(fs, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handles := fs.OpenHandles()
+	if len(handles) != 1 || handles[0].Name != "/a" {
+		t.Fatalf("expected /a to be open, got %v", handles)
+	}
+	if !strings.Contains(handles[0].Stack, "afero.leakOpen") {
+		t.Errorf("expected the stack to start at the caller of Open, got:\n%s", handles[0].Stack)
+	}
+	if strings.Contains(handles[0].Stack, "(*LeakFs)") {
+		t.Errorf("expected the LeakFs frames to be skipped, got:\n%s", handles[0].Stack)
+	}
+
+	r := &leakRecorder{}
+	fs.AssertNoOpenHandles(r)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "/a opened") {
+		t.Errorf("expected the open handle to be reported, got %v", r.errors)
+	}
+	if err := fs.CheckNoOpenHandles(); !errors.Is(err, ErrOpenHandles) {
+		t.Errorf("expected ErrOpenHandles, got %v", err)
+	}
+
+	if got := fs.LongLived(time.Hour); len(got) != 0 {
+		t.Errorf("expected no handle open for an hour, got %v", got)
+	}
+	var report bytes.Buffer
+	if err := fs.WriteReport(&report, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "leakOpen") {
+		t.Errorf("expected the report to show the stack, got:\n%s", report.String())
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.AssertNoOpenHandles(t)
+}
+
+func TestLeakFsClosed(t *testing.T) {
+	fs := NewLeakFs(&MemMapFs{})
+	f, err := fs.Create("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	checks := map[string]error{}
+	_, checks["read"] = f.Read(make([]byte, 1))
+	_, checks["write"] = f.Write([]byte("x"))
+	_, checks["writestring"] = f.WriteString("x")
+	_, checks["seek"] = f.Seek(0, 0)
+	_, checks["stat"] = f.Stat()
+	checks["sync"] = f.Sync()
+	checks["truncate"] = f.Truncate(0)
+	checks["close"] = f.Close()
+	checks["lock"] = TryLockFile(f, true)
+	for op, err := range checks {
+		if !errors.Is(err, ErrFileClosed) {
+			t.Errorf("%s: expected ErrFileClosed, got %v", op, err)
+		}
+	}
+	if f.Name() != "/a" {
+		t.Errorf("expected the name to be kept, got %q", f.Name())
+	}
+}
+
+func TestLeakFsUnion(t *testing.T) {
+	base, layer := NewLeakFs(&MemMapFs{}), NewLeakFs(&MemMapFs{})
+	base.MkdirAll("/dir", 0755)
+	layer.MkdirAll("/dir", 0755)
+	ufs := NewCopyOnWriteFs(base, layer)
+
+	f, err := ufs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*UnionFile); !ok {
+		t.Fatalf("expected a UnionFile, got %T", f)
+	}
+	if len(base.OpenHandles()) != 1 || len(layer.OpenHandles()) != 1 {
+		t.Error("expected a handle open in each layer")
+	}
+	f.Close()
+	base.AssertNoOpenHandles(t)
+	layer.AssertNoOpenHandles(t)
+}
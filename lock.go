@@ -0,0 +1,114 @@
+package afero
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+// Locker is an optional interface in Afero. It is only implemented by the
+// files saying so.
+// It places advisory, flock-style locks on an open file: any number of
+// handles may hold a shared lock at the same time, but an exclusive lock
+// excludes all other handles. Calling Lock or TryLock on a handle which
+// already holds a lock converts it. Closing a handle releases its lock.
+//
+// Use LockFile, TryLockFile and UnlockFile instead of calling these methods
+// directly, as they also handle *os.File.
+type Locker interface {
+	// Lock blocks until the lock is acquired or ctx is done.
+	Lock(ctx context.Context, exclusive bool) error
+	// TryLock acquires the lock without blocking. If that is not possible
+	// it fails with an error matching ErrLocked.
+	TryLock(exclusive bool) error
+	Unlock() error
+}
+
+// ErrNoLock is the error that will be wrapped in an *os.PathError if a file
+// does not support locking either directly or through the file it wraps.
+var ErrNoLock = WrapError(os.ErrInvalid, errors.New("lock not supported"))
+
+// ErrLocked is wrapped in an *os.PathError by TryLockFile when the lock is
+// held by another handle.
+var ErrLocked = mem.ErrLocked
+
+// lockPollInterval bounds the delay between two attempts to acquire a lock
+// for backends which cannot block on it in a cancellable way.
+const lockPollInterval = 50 * time.Millisecond
+
+// LockFile places a shared or exclusive advisory lock on f, blocking until
+// it is acquired or ctx is done.
+// Files of the os filesystem are locked with flock(2) where available.
+func LockFile(ctx context.Context, f File, exclusive bool) error {
+	if l, ok := f.(Locker); ok {
+		return l.Lock(ctx, exclusive)
+	}
+	if osf, ok := f.(*os.File); ok {
+		return pollLock(ctx, osf.Name(), func() error { return tryLockOsFile(osf, exclusive) })
+	}
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: ErrNoLock}
+}
+
+// TryLockFile places a shared or exclusive advisory lock on f if that is
+// possible without blocking, else it returns an error matching ErrLocked.
+func TryLockFile(f File, exclusive bool) error {
+	if l, ok := f.(Locker); ok {
+		return l.TryLock(exclusive)
+	}
+	if osf, ok := f.(*os.File); ok {
+		return tryLockOsFile(osf, exclusive)
+	}
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: ErrNoLock}
+}
+
+// UnlockFile releases the lock held by f.
+func UnlockFile(f File) error {
+	if l, ok := f.(Locker); ok {
+		return l.Unlock()
+	}
+	if osf, ok := f.(*os.File); ok {
+		return unlockOsFile(osf)
+	}
+	return &os.PathError{Op: "unlock", Path: f.Name(), Err: ErrNoLock}
+}
+
+// lockingFile forwards the methods of Locker to the File it wraps, for the
+// wrappers embedding it instead of File to lock the files they wrap.
+type lockingFile struct {
+	File
+}
+
+func (f lockingFile) Lock(ctx context.Context, exclusive bool) error {
+	return LockFile(ctx, f.File, exclusive)
+}
+
+func (f lockingFile) TryLock(exclusive bool) error {
+	return TryLockFile(f.File, exclusive)
+}
+
+func (f lockingFile) Unlock() error {
+	return UnlockFile(f.File)
+}
+
+// pollLock calls try until it succeeds, fails with something else than
+// ErrLocked, or ctx is done.
+func pollLock(ctx context.Context, name string, try func() error) error {
+	delay := time.Millisecond
+	for {
+		err := try()
+		if err == nil || !errors.Is(err, ErrLocked) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return &os.PathError{Op: "lock", Path: name, Err: ctx.Err()}
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > lockPollInterval {
+			delay = lockPollInterval
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package afero
+
+import (
+	"os"
+)
+
+func tryLockOsFile(f *os.File, exclusive bool) error {
+	return &os.PathError{Op: "lock", Path: f.Name(), Err: ErrNoLock}
+}
+
+func unlockOsFile(f *os.File) error {
+	return &os.PathError{Op: "unlock", Path: f.Name(), Err: ErrNoLock}
+}
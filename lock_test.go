@@ -0,0 +1,144 @@
+package afero
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemMapFsLock(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/state", []byte("x"), 0644)
+	a, _ := fs.OpenFile("/state", os.O_RDWR, 0)
+	b, _ := fs.Open("/state")
+	defer b.Close()
+
+	if err := TryLockFile(a, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := TryLockFile(b, false); err != nil {
+		t.Errorf("shared locks should not conflict: %v", err)
+	}
+	if err := TryLockFile(a, true); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked on upgrade, got %v", err)
+	}
+	if err := UnlockFile(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := TryLockFile(a, true); err != nil {
+		t.Errorf("upgrade failed: %v", err)
+	}
+	if err := TryLockFile(b, false); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := LockFile(ctx, b, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+
+	locked := make(chan error)
+	go func() { locked <- LockFile(context.Background(), b, true) }()
+	select {
+	case err := <-locked:
+		t.Fatalf("lock acquired while held elsewhere: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	// Closing the handle releases its lock.
+	a.Close()
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the lock")
+	}
+	if err := TryLockFile(a, false); err == nil {
+		t.Error("expected an error locking a closed file")
+	}
+}
+
+func TestOsFsLock(t *testing.T) {
+	osfs := &OsFs{}
+	dir, err := TempDir(osfs, "", "afero-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osfs.RemoveAll(dir)
+	name := filepath.Join(dir, "state")
+	WriteFile(osfs, name, []byte("x"), 0644)
+
+	a, _ := osfs.Open(name)
+	defer a.Close()
+	b, _ := osfs.Open(name)
+	defer b.Close()
+
+	if err := TryLockFile(a, true); err != nil {
+		if errors.Is(err, ErrNoLock) {
+			t.Skip("OsFs does not support locking on this platform")
+		}
+		t.Fatal(err)
+	}
+	if err := TryLockFile(b, true); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := LockFile(ctx, b, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+	if err := UnlockFile(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockFile(context.Background(), b, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLockWrappers(t *testing.T) {
+	mfs := &MemMapFs{}
+	WriteFile(mfs, "/base/state.txt", []byte("x"), 0644)
+
+	for _, fs := range []Fs{
+		NewBasePathFs(mfs, "/base"),
+		NewRegexpFs(NewBasePathFs(mfs, "/base"), nil),
+		NewCacheOnReadFs(NewBasePathFs(mfs, "/base"), &MemMapFs{}, 0),
+	} {
+		a, err := fs.Open("/state.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := TryLockFile(a, true); err != nil {
+			t.Errorf("%T: %v", fs, err)
+		}
+		b, _ := mfs.Open("/base/state.txt")
+		if _, ok := fs.(*CacheOnReadFs); !ok {
+			if err := TryLockFile(b, true); !errors.Is(err, ErrLocked) {
+				t.Errorf("%T: expected the lock to reach the source, got %v", fs, err)
+			}
+		}
+		b.Close()
+		a.Close()
+	}
+}
+
+type nolockFile struct{ File }
+
+func TestLockNotSupported(t *testing.T) {
+	fs := &MemMapFs{}
+	f, _ := fs.Create("/file")
+	defer f.Close()
+	err := TryLockFile(nolockFile{f}, true)
+	if !errors.Is(err, ErrNoLock) || !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected ErrNoLock, got %v", err)
+	}
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr.Path != "/file" {
+		t.Errorf("expected a *os.PathError for /file, got %#v", err)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -58,6 +59,15 @@ type FileData struct {
 	modtime time.Time
 	uid     int
 	gid     int
+
+	// modifyHook is called after the content was changed through a
+	// file handle, without the lock held.
+	modifyHook func()
+
+	// locks holds the advisory locks placed through the file handles.
+	locks lockTable
+
+	xattrs map[string][]byte
 }
 
 func (d *FileData) Name() string {
@@ -108,6 +118,14 @@ func SetGID(f *FileData, gid int) {
 	f.Unlock()
 }
 
+// SetModifyHook registers a function to be called each time the content of
+// f is changed through a file handle, i.e. by Write, WriteAt or Truncate.
+func SetModifyHook(f *FileData, hook func()) {
+	f.Lock()
+	f.modifyHook = hook
+	f.Unlock()
+}
+
 func GetFileInfo(f *FileData) *FileInfo {
 	return &FileInfo{f}
 }
@@ -124,6 +142,7 @@ func (f *File) Open() error {
 func (f *File) Close() error {
 	f.fileData.Lock()
 	f.closed = true
+	f.fileData.locks.release(f)
 	if !f.readOnly {
 		setModTime(f.fileData, time.Now())
 	}
@@ -145,7 +164,7 @@ func (f *File) Sync() error {
 
 func (f *File) Readdir(count int) (res []os.FileInfo, err error) {
 	if !f.fileData.dir {
-		return nil, &os.PathError{Op: "readdir", Path: f.fileData.name, Err: errors.New("not a dir")}
+		return nil, &os.PathError{Op: "readdir", Path: f.fileData.name, Err: syscall.ENOTDIR}
 	}
 	var outLength int64
 
@@ -187,7 +206,7 @@ func (f *File) Read(b []byte) (n int, err error) {
 	f.fileData.Lock()
 	defer f.fileData.Unlock()
 	if f.closed == true {
-		return 0, ErrFileClosed
+		return 0, &os.PathError{Op: "read", Path: f.fileData.name, Err: ErrFileClosed}
 	}
 	if len(b) > 0 && int(f.at) == len(f.fileData.data) {
 		return 0, io.EOF
@@ -215,16 +234,15 @@ func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
 
 func (f *File) Truncate(size int64) error {
 	if f.closed == true {
-		return ErrFileClosed
+		return &os.PathError{Op: "truncate", Path: f.fileData.name, Err: ErrFileClosed}
 	}
 	if f.readOnly {
-		return &os.PathError{Op: "truncate", Path: f.fileData.name, Err: errors.New("file handle is read only")}
+		return &os.PathError{Op: "truncate", Path: f.fileData.name, Err: ErrReadOnlyHandle}
 	}
 	if size < 0 {
-		return ErrOutOfRange
+		return &os.PathError{Op: "truncate", Path: f.fileData.name, Err: ErrOutOfRange}
 	}
 	f.fileData.Lock()
-	defer f.fileData.Unlock()
 	if size > int64(len(f.fileData.data)) {
 		diff := size - int64(len(f.fileData.data))
 		f.fileData.data = append(f.fileData.data, bytes.Repeat([]byte{00}, int(diff))...)
@@ -232,12 +250,17 @@ func (f *File) Truncate(size int64) error {
 		f.fileData.data = f.fileData.data[0:size]
 	}
 	setModTime(f.fileData, time.Now())
+	hook := f.fileData.modifyHook
+	f.fileData.Unlock()
+	if hook != nil {
+		hook()
+	}
 	return nil
 }
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	if f.closed == true {
-		return 0, ErrFileClosed
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: ErrFileClosed}
 	}
 	switch whence {
 	case io.SeekStart:
@@ -252,15 +275,14 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 
 func (f *File) Write(b []byte) (n int, err error) {
 	if f.closed == true {
-		return 0, ErrFileClosed
+		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: ErrFileClosed}
 	}
 	if f.readOnly {
-		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: errors.New("file handle is read only")}
+		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: ErrReadOnlyHandle}
 	}
 	n = len(b)
 	cur := atomic.LoadInt64(&f.at)
 	f.fileData.Lock()
-	defer f.fileData.Unlock()
 	diff := cur - int64(len(f.fileData.data))
 	var tail []byte
 	if n+int(cur) < len(f.fileData.data) {
@@ -274,8 +296,13 @@ func (f *File) Write(b []byte) (n int, err error) {
 		f.fileData.data = append(f.fileData.data, tail...)
 	}
 	setModTime(f.fileData, time.Now())
+	hook := f.fileData.modifyHook
+	f.fileData.Unlock()
 
 	atomic.AddInt64(&f.at, int64(n))
+	if hook != nil {
+		hook()
+	}
 	return
 }
 
@@ -329,10 +356,25 @@ func (s *FileInfo) Size() int64 {
 }
 
 var (
-	ErrFileClosed        = errors.New("File is closed")
-	ErrOutOfRange        = errors.New("Out of range")
+	ErrFileClosed        = newKindError(os.ErrClosed, "File is closed")
+	ErrOutOfRange        = newKindError(os.ErrInvalid, "Out of range")
+	ErrReadOnlyHandle    = newKindError(os.ErrPermission, "file handle is read only")
 	ErrTooLarge          = errors.New("Too large")
 	ErrFileNotFound      = os.ErrNotExist
 	ErrFileExists        = os.ErrExist
 	ErrDestinationExists = os.ErrExist
 )
+
+// kindError is an error which matches, with errors.Is, the os error of its
+// kind, such as os.ErrClosed.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func newKindError(kind error, msg string) error {
+	return &kindError{kind: kind, msg: msg}
+}
+
+func (e *kindError) Error() string        { return e.msg }
+func (e *kindError) Is(target error) bool { return target == e.kind }
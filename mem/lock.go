@@ -0,0 +1,120 @@
+package mem
+
+import (
+	"context"
+	"os"
+)
+
+// lockTable tracks the flock-style advisory locks held on a FileData. It is
+// guarded by the FileData mutex.
+type lockTable struct {
+	exclusive *File
+	shared    map[*File]struct{}
+	// released is closed, and reset, each time a lock is given up, to wake
+	// up the handles waiting for one.
+	released chan struct{}
+}
+
+// acquire places or converts the lock of f, reporting false if another
+// handle holds a conflicting one.
+func (t *lockTable) acquire(f *File, exclusive bool) bool {
+	if t.exclusive != nil && t.exclusive != f {
+		return false
+	}
+	if exclusive {
+		for other := range t.shared {
+			if other != f {
+				return false
+			}
+		}
+		delete(t.shared, f)
+		t.exclusive = f
+		return true
+	}
+	if t.shared == nil {
+		t.shared = make(map[*File]struct{})
+	}
+	t.shared[f] = struct{}{}
+	if t.exclusive == f {
+		// Downgrading lets other shared lockers in.
+		t.exclusive = nil
+		t.wake()
+	}
+	return true
+}
+
+func (t *lockTable) release(f *File) {
+	_, held := t.shared[f]
+	if !held && t.exclusive != f {
+		return
+	}
+	delete(t.shared, f)
+	if t.exclusive == f {
+		t.exclusive = nil
+	}
+	t.wake()
+}
+
+func (t *lockTable) wake() {
+	if t.released != nil {
+		close(t.released)
+		t.released = nil
+	}
+}
+
+func (t *lockTable) wait() <-chan struct{} {
+	if t.released == nil {
+		t.released = make(chan struct{})
+	}
+	return t.released
+}
+
+// Lock places a shared or exclusive advisory lock on the file, waiting until
+// the conflicting locks of other handles are released or ctx is done.
+func (f *File) Lock(ctx context.Context, exclusive bool) error {
+	for {
+		f.fileData.Lock()
+		if f.closed {
+			f.fileData.Unlock()
+			return &os.PathError{Op: "lock", Path: f.fileData.name, Err: ErrFileClosed}
+		}
+		if f.fileData.locks.acquire(f, exclusive) {
+			f.fileData.Unlock()
+			return nil
+		}
+		released := f.fileData.locks.wait()
+		name := f.fileData.name
+		f.fileData.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return &os.PathError{Op: "lock", Path: name, Err: ctx.Err()}
+		}
+	}
+}
+
+// TryLock is like Lock, but fails with ErrLocked instead of waiting.
+func (f *File) TryLock(exclusive bool) error {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "lock", Path: f.fileData.name, Err: ErrFileClosed}
+	}
+	if !f.fileData.locks.acquire(f, exclusive) {
+		return &os.PathError{Op: "lock", Path: f.fileData.name, Err: ErrLocked}
+	}
+	return nil
+}
+
+// Unlock releases the lock held by the file, if any. Closing the file
+// releases it as well.
+func (f *File) Unlock() error {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "unlock", Path: f.fileData.name, Err: ErrFileClosed}
+	}
+	f.fileData.locks.release(f)
+	return nil
+}
@@ -0,0 +1,9 @@
+// +build !plan9
+
+package mem
+
+import "syscall"
+
+// ErrLocked is the error TryLock fails with when the lock is held by
+// another handle.
+var ErrLocked error = syscall.EWOULDBLOCK
@@ -0,0 +1,7 @@
+package mem
+
+import "errors"
+
+// ErrLocked is the error TryLock fails with when the lock is held by
+// another handle. Plan 9 has no EWOULDBLOCK.
+var ErrLocked = errors.New("resource temporarily unavailable")
@@ -0,0 +1,48 @@
+package mem
+
+import "sort"
+
+// GetXattr returns a copy of the value of the extended attribute attr of f,
+// and whether it is set.
+func GetXattr(f *FileData, attr string) ([]byte, bool) {
+	f.Lock()
+	defer f.Unlock()
+	value, ok := f.xattrs[attr]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, value...), true
+}
+
+func SetXattr(f *FileData, attr string, value []byte) {
+	f.Lock()
+	if f.xattrs == nil {
+		f.xattrs = make(map[string][]byte)
+	}
+	f.xattrs[attr] = append([]byte{}, value...)
+	f.Unlock()
+}
+
+// ListXattr returns the names of the extended attributes of f, sorted.
+func ListXattr(f *FileData) []string {
+	f.Lock()
+	defer f.Unlock()
+	attrs := make([]string, 0, len(f.xattrs))
+	for attr := range f.xattrs {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+// RemoveXattr removes the extended attribute attr of f, reporting whether it
+// was set.
+func RemoveXattr(f *FileData, attr string) bool {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.xattrs[attr]; !ok {
+		return false
+	}
+	delete(f.xattrs, attr)
+	return true
+}
@@ -16,10 +16,12 @@ package afero
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/spf13/afero/mem"
@@ -28,9 +30,14 @@ import (
 const chmodBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky // Only a subset of bits are allowed to be changed. Documented under os.Chmod()
 
 type MemMapFs struct {
-	mu   sync.RWMutex
-	data map[string]*mem.FileData
-	init sync.Once
+	mu      sync.RWMutex
+	data    map[string]*mem.FileData
+	init    sync.Once
+	watches watchSet
+
+	// capacity reported by Statfs, zero meaning unlimited.
+	capacityBytes  uint64
+	capacityInodes uint64
 }
 
 func NewMemMapFs() Fs {
@@ -54,10 +61,17 @@ func (*MemMapFs) Name() string { return "MemMapFS" }
 func (m *MemMapFs) Create(name string) (File, error) {
 	name = normalizePath(name)
 	m.mu.Lock()
+	_, exists := m.getData()[name]
 	file := mem.CreateFile(name)
+	mem.SetModifyHook(file, func() { m.watches.notify(file.Name(), OpWrite) })
 	m.getData()[name] = file
 	m.registerWithParent(file, 0)
 	m.mu.Unlock()
+	if exists {
+		m.watches.notify(name, OpWrite)
+	} else {
+		m.watches.notify(name, OpCreate)
+	}
 	return mem.NewFileHandle(file), nil
 }
 
@@ -119,13 +133,14 @@ func (m *MemMapFs) lockfreeMkdir(name string, perm os.FileMode) error {
 		// Only return ErrFileExists if it's a file, not a directory.
 		i := mem.FileInfo{FileData: x}
 		if !i.IsDir() {
-			return ErrFileExists
+			return &os.PathError{Op: "mkdir", Path: name, Err: ErrFileExists}
 		}
 	} else {
 		item := mem.CreateDir(name)
 		mem.SetMode(item, os.ModeDir|perm)
 		m.getData()[name] = item
 		m.registerWithParent(item, perm)
+		m.watches.notify(name, OpCreate)
 	}
 	return nil
 }
@@ -147,6 +162,7 @@ func (m *MemMapFs) Mkdir(name string, perm os.FileMode) error {
 	m.getData()[name] = item
 	m.registerWithParent(item, perm)
 	m.mu.Unlock()
+	m.watches.notify(name, OpCreate)
 
 	return m.setFileMode(name, perm|os.ModeDir)
 }
@@ -210,7 +226,7 @@ func (m *MemMapFs) lockfreeOpen(name string) (*mem.FileData, error) {
 	if ok {
 		return f, nil
 	} else {
-		return nil, ErrFileNotFound
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrFileNotFound}
 	}
 }
 
@@ -260,9 +276,10 @@ func (m *MemMapFs) Remove(name string) error {
 	if _, ok := m.getData()[name]; ok {
 		err := m.unRegisterWithParent(name)
 		if err != nil {
-			return &os.PathError{Op: "remove", Path: name, Err: err}
+			return &os.PathError{Op: "remove", Path: name, Err: underlyingError(err)}
 		}
 		delete(m.getData(), name)
+		m.watches.notify(name, OpRemove)
 	} else {
 		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
 	}
@@ -284,12 +301,15 @@ func (m *MemMapFs) RemoveAll(path string) error {
 			m.mu.Lock()
 			delete(m.getData(), p)
 			m.mu.Unlock()
+			m.watches.notify(p, OpRemove)
 			m.mu.RLock()
 		}
 	}
 	return nil
 }
 
+// Rename fails with EINVAL when moving a directory into itself, and with
+// ENOTEMPTY when replacing a directory that is not empty.
 func (m *MemMapFs) Rename(oldname, newname string) error {
 	oldname = normalizePath(oldname)
 	newname = normalizePath(newname)
@@ -301,6 +321,12 @@ func (m *MemMapFs) Rename(oldname, newname string) error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if _, ok := m.getData()[oldname]; ok {
+		if strings.HasPrefix(newname, oldname+FilePathSeparator) {
+			return &os.PathError{Op: "rename", Path: oldname, Err: syscall.EINVAL}
+		}
+		if m.hasDescendants(newname) {
+			return &os.PathError{Op: "rename", Path: newname, Err: syscall.ENOTEMPTY}
+		}
 		m.mu.RUnlock()
 		m.mu.Lock()
 		m.unRegisterWithParent(oldname)
@@ -308,8 +334,11 @@ func (m *MemMapFs) Rename(oldname, newname string) error {
 		delete(m.getData(), oldname)
 		mem.ChangeFileName(fileData, newname)
 		m.getData()[newname] = fileData
+		m.renameDescendants(oldname, newname)
 		m.registerWithParent(fileData, 0)
 		m.mu.Unlock()
+		m.watches.notify(oldname, OpRename)
+		m.watches.notify(newname, OpCreate)
 		m.mu.RLock()
 	} else {
 		return &os.PathError{Op: "rename", Path: oldname, Err: ErrFileNotFound}
@@ -317,6 +346,56 @@ func (m *MemMapFs) Rename(oldname, newname string) error {
 	return nil
 }
 
+// hasDescendants tells whether name is a directory that is not empty. The
+// lock must be held.
+func (m *MemMapFs) hasDescendants(name string) bool {
+	prefix := name + FilePathSeparator
+	for p := range m.getData() {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameDescendants moves what a directory renamed contains along with it.
+// The lock must be held.
+func (m *MemMapFs) renameDescendants(oldname, newname string) {
+	prefix := oldname + FilePathSeparator
+	var descendants []string
+	for name := range m.getData() {
+		if strings.HasPrefix(name, prefix) {
+			descendants = append(descendants, name)
+		}
+	}
+	// The entries of directories are keyed by name, so they leave their
+	// parents under their old names, and join them under the new ones.
+	for _, name := range descendants {
+		dir := filepath.Dir(name)
+		if dir == oldname {
+			// Moved already.
+			dir = newname
+		}
+		if parent, ok := m.getData()[dir]; ok {
+			parent.Lock()
+			mem.RemoveFromMemDir(parent, m.getData()[name])
+			parent.Unlock()
+		}
+	}
+	moved := make([]*mem.FileData, 0, len(descendants))
+	for _, name := range descendants {
+		fileData := m.getData()[name]
+		renamed := newname + FilePathSeparator + name[len(prefix):]
+		delete(m.getData(), name)
+		mem.ChangeFileName(fileData, renamed)
+		m.getData()[renamed] = fileData
+		moved = append(moved, fileData)
+	}
+	for _, fileData := range moved {
+		m.registerWithParent(fileData, 0)
+	}
+}
+
 func (m *MemMapFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
 	fileInfo, err := m.Stat(name)
 	return fileInfo, false, err
@@ -343,7 +422,11 @@ func (m *MemMapFs) Chmod(name string, mode os.FileMode) error {
 	prevOtherBits := mem.GetFileInfo(f).Mode() & ^chmodBits
 
 	mode = prevOtherBits | mode
-	return m.setFileMode(name, mode)
+	if err := m.setFileMode(name, mode); err != nil {
+		return err
+	}
+	m.watches.notify(f.Name(), OpChmod)
+	return nil
 }
 
 func (m *MemMapFs) setFileMode(name string, mode os.FileMode) error {
@@ -375,6 +458,7 @@ func (m *MemMapFs) Chown(name string, uid, gid int) error {
 
 	mem.SetUID(f, uid)
 	mem.SetGID(f, gid)
+	m.watches.notify(name, OpChmod)
 
 	return nil
 }
@@ -392,10 +476,127 @@ func (m *MemMapFs) Chtimes(name string, atime time.Time, mtime time.Time) error
 	m.mu.Lock()
 	mem.SetModTime(f, mtime)
 	m.mu.Unlock()
+	m.watches.notify(name, OpChmod)
+
+	return nil
+}
+
+// xattrData looks up name for one of the extended attribute operations.
+func (m *MemMapFs) xattrData(op, name string) (*mem.FileData, error) {
+	m.mu.RLock()
+	f, ok := m.getData()[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: ErrFileNotFound}
+	}
+	return f, nil
+}
+
+func (m *MemMapFs) GetXattr(name, attr string) ([]byte, error) {
+	name = normalizePath(name)
+	f, err := m.xattrData("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := mem.GetXattr(f, attr)
+	if !ok {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoAttr}
+	}
+	return value, nil
+}
 
+func (m *MemMapFs) SetXattr(name, attr string, value []byte) error {
+	name = normalizePath(name)
+	f, err := m.xattrData("setxattr", name)
+	if err != nil {
+		return err
+	}
+	mem.SetXattr(f, attr, value)
+	m.watches.notify(name, OpChmod)
+	return nil
+}
+
+func (m *MemMapFs) ListXattr(name string) ([]string, error) {
+	name = normalizePath(name)
+	f, err := m.xattrData("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	return mem.ListXattr(f), nil
+}
+
+func (m *MemMapFs) RemoveXattr(name, attr string) error {
+	name = normalizePath(name)
+	f, err := m.xattrData("removexattr", name)
+	if err != nil {
+		return err
+	}
+	if !mem.RemoveXattr(f, attr) {
+		return &os.PathError{Op: "removexattr", Path: name, Err: ErrNoAttr}
+	}
+	m.watches.notify(name, OpChmod)
 	return nil
 }
 
+// SetCapacity sets the size in bytes and number of inodes Statfs reports
+// for the filesystem. Zero, the default, means unlimited, which is reported
+// as math.MaxInt64. The capacity is only reported, see QuotaFs for
+// enforcing limits.
+func (m *MemMapFs) SetCapacity(bytes, inodes uint64) {
+	m.mu.Lock()
+	m.capacityBytes, m.capacityInodes = bytes, inodes
+	m.mu.Unlock()
+}
+
+// Statfs reports the configured capacity, the size of all files and the
+// number of files and directories as in use.
+func (m *MemMapFs) Statfs(name string) (*FsStats, error) {
+	name = normalizePath(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.getData()[name]; !ok {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: ErrFileNotFound}
+	}
+	var used uint64
+	for _, f := range m.getData() {
+		if fi := mem.GetFileInfo(f); !fi.IsDir() {
+			used += uint64(fi.Size())
+		}
+	}
+	st := &FsStats{TotalBytes: m.capacityBytes, TotalInodes: m.capacityInodes}
+	if st.TotalBytes == 0 {
+		st.TotalBytes = math.MaxInt64
+	}
+	if st.TotalInodes == 0 {
+		st.TotalInodes = math.MaxInt64
+	}
+	st.FreeBytes = subtractOrZero(st.TotalBytes, used)
+	st.AvailBytes = st.FreeBytes
+	st.FreeInodes = subtractOrZero(st.TotalInodes, uint64(len(m.getData())))
+	return st, nil
+}
+
+func subtractOrZero(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// Watch delivers the events of the named file or directory, which must
+// exist. Events are emitted by the mutating methods of MemMapFs and by
+// writes through its file handles.
+func (m *MemMapFs) Watch(name string, recursive bool) (Watch, error) {
+	name = normalizePath(name)
+	m.mu.RLock()
+	_, ok := m.getData()[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: ErrFileNotFound}
+	}
+	return m.watches.add(name, recursive), nil
+}
+
 func (m *MemMapFs) List() {
 	for _, x := range m.data {
 		y := mem.FileInfo{FileData: x}
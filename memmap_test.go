@@ -1,11 +1,13 @@
 package afero
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -683,3 +685,71 @@ func TestMemFsLstatIfPossible(t *testing.T) {
 		t.Fatalf("Function indicated lstat was called. This should never be true.")
 	}
 }
+
+func TestMemFsRenameDirectory(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/src/sub", 0755)
+	WriteFile(fs, "/src/sub/file", []byte("data"), 0644)
+	if err := fs.Rename("/src", "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/src/sub/file"); !os.IsNotExist(err) {
+		t.Errorf("expected the old path to be gone, got %v", err)
+	}
+	data, err := ReadFile(fs, "/dst/sub/file")
+	if err != nil || string(data) != "data" {
+		t.Errorf("expected the content to move along, got %q, %v", data, err)
+	}
+	names, err := readDirNames(fs, "/dst/sub")
+	if err != nil || len(names) != 1 || names[0] != "file" {
+		t.Errorf("expected the renamed directory to list its content, got %v, %v", names, err)
+	}
+	if err := fs.Remove("/dst/sub/file"); err != nil {
+		t.Fatal(err)
+	}
+	names, err = readDirNames(fs, "/dst/sub")
+	if err != nil || len(names) != 0 {
+		t.Errorf("expected the removed file not to be listed, got %v, %v", names, err)
+	}
+}
+
+func TestMemFsRenameIntoItself(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/a", 0755)
+	if err := fs.Rename("/a", "/a/b"); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("expected EINVAL, got %v", err)
+	}
+	for _, name := range []string{"/a/b", "/a/b/b"} {
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no entry, got %v", name, err)
+		}
+	}
+	if fi, err := fs.Stat("/a"); err != nil || !fi.IsDir() {
+		t.Errorf("expected the directory to stay, got %v", err)
+	}
+}
+
+func TestMemFsRenameOntoDirectory(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/src/sub", 0755)
+	fs.MkdirAll("/empty", 0755)
+	fs.MkdirAll("/full", 0755)
+	WriteFile(fs, "/full/file", nil, 0644)
+
+	if err := fs.Rename("/src", "/full"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("expected ENOTEMPTY, got %v", err)
+	}
+	if _, err := fs.Stat("/src/sub"); err != nil {
+		t.Errorf("expected the directory not to move, got %v", err)
+	}
+
+	if err := fs.Rename("/src", "/empty"); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := readDirNames(fs, "/empty"); err != nil || len(names) != 1 || names[0] != "sub" {
+		t.Errorf("expected the directory to replace the empty one, got %v, %v", names, err)
+	}
+	if names, err := readDirNames(fs, "/"); err != nil || len(names) != 2 {
+		t.Errorf("expected /empty and /full, got %v, %v", names, err)
+	}
+}
@@ -0,0 +1,338 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+var _ Lstater = (*MountFs)(nil)
+
+// The MountFs composes filesystems under one namespace: filesystems are
+// mounted at paths of a root filesystem, as in
+//
+//	fs := NewMountFs(NewMemMapFs())
+//	fs.Mount("/vendor", tarfs.New(tr))
+//	fs.Mount("/tmp", NewMemMapFs())
+//
+// A path is served by the mount with the longest prefix of it, with the
+// path below the mount point, so that "/vendor/lib" is "/lib" in the
+// tarfs. Mount points, and the directories leading to them, show in the
+// listings of their parent directories, whether or not the filesystems
+// below have them. Renames across filesystems fail with EXDEV, and mount
+// points cannot be renamed nor removed.
+type MountFs struct {
+	root Fs
+
+	mu     sync.RWMutex
+	mounts map[string]Fs
+}
+
+func NewMountFs(root Fs) *MountFs {
+	return &MountFs{root: root, mounts: make(map[string]Fs)}
+}
+
+// Mount mounts fs at path, which must not be a mount point already.
+func (m *MountFs) Mount(path string, fs Fs) error {
+	path = normalizePath(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mounts[path]; ok || path == FilePathSeparator {
+		return &os.PathError{Op: "mount", Path: path, Err: syscall.EBUSY}
+	}
+	m.mounts[path] = fs
+	return nil
+}
+
+// Unmount removes the filesystem mounted at path.
+func (m *MountFs) Unmount(path string) error {
+	path = normalizePath(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.mounts[path]; !ok {
+		return &os.PathError{Op: "unmount", Path: path, Err: syscall.EINVAL}
+	}
+	delete(m.mounts, path)
+	return nil
+}
+
+// Mounts returns the mount points, sorted.
+func (m *MountFs) Mounts() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var paths []string
+	for path := range m.mounts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// resolve returns the filesystem serving name, the path of name in it,
+// and the mount point, the root being "/".
+func (m *MountFs) resolve(name string) (Fs, string, string) {
+	name = normalizePath(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for point := name; ; point = filepath.Dir(point) {
+		if fs, ok := m.mounts[point]; ok {
+			return fs, normalizePath(FilePathSeparator + strings.TrimPrefix(name, point)), point
+		}
+		if point == FilePathSeparator || point == filepath.Dir(point) {
+			return m.root, name, FilePathSeparator
+		}
+	}
+}
+
+// below returns the names of the entries of dir leading to mount points,
+// or nil if there are none.
+func (m *MountFs) below(dir string) map[string]bool {
+	dir = normalizePath(dir)
+	prefix := strings.TrimSuffix(dir, FilePathSeparator) + FilePathSeparator
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var names map[string]bool
+	for point := range m.mounts {
+		if !strings.HasPrefix(point, prefix) {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]bool)
+		}
+		names[strings.SplitN(point[len(prefix):], FilePathSeparator, 2)[0]] = true
+	}
+	return names
+}
+
+// isMountPoint tells whether name is a mount point, or leads to one.
+func (m *MountFs) isMountPoint(name string) bool {
+	name = normalizePath(name)
+	m.mu.RLock()
+	_, ok := m.mounts[name]
+	m.mu.RUnlock()
+	return ok || m.below(name) != nil
+}
+
+// mountError reports an error of a mounted filesystem with the path in the
+// MountFs.
+func mountError(err error, name string) error {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		return &os.PathError{Op: perr.Op, Path: name, Err: perr.Err}
+	}
+	return err
+}
+
+// stat returns the info of name, or of the directory leading to mount
+// points it is.
+func (m *MountFs) stat(name string, lstat bool) (os.FileInfo, bool, error) {
+	fs, path, point := m.resolve(name)
+	var fi os.FileInfo
+	var lstated bool
+	var err error
+	if lstater, ok := fs.(Lstater); ok && lstat {
+		fi, lstated, err = lstater.LstatIfPossible(path)
+	} else {
+		fi, err = fs.Stat(path)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && m.below(name) != nil {
+			return &mountDirInfo{name: filepath.Base(normalizePath(name))}, false, nil
+		}
+		return nil, lstated, mountError(err, name)
+	}
+	if normalizePath(name) == point && point != FilePathSeparator {
+		// The root of a mounted filesystem is named by its mount point.
+		fi = &mountFileInfo{FileInfo: fi, name: filepath.Base(point)}
+	}
+	return fi, lstated, nil
+}
+
+func (m *MountFs) Name() string {
+	return "MountFs"
+}
+
+func (m *MountFs) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MountFs) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MountFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs, path, _ := m.resolve(name)
+	f, err := fs.OpenFile(path, flag, perm)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && flag&(os.O_WRONLY|os.O_RDWR) == 0 && m.below(name) != nil {
+			// A directory leading to mount points only.
+			return &MountFile{lockingFile: lockingFile{mem.NewReadOnlyFileHandle(mem.CreateDir(name))}, fs: m, name: name}, nil
+		}
+		return nil, mountError(err, name)
+	}
+	return &MountFile{lockingFile: lockingFile{f}, fs: m, name: name}, nil
+}
+
+func (m *MountFs) Mkdir(name string, perm os.FileMode) error {
+	fs, path, _ := m.resolve(name)
+	return mountError(fs.Mkdir(path, perm), name)
+}
+
+func (m *MountFs) MkdirAll(path string, perm os.FileMode) error {
+	fs, inner, _ := m.resolve(path)
+	return mountError(fs.MkdirAll(inner, perm), path)
+}
+
+func (m *MountFs) Remove(name string) error {
+	if m.isMountPoint(name) {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	fs, path, _ := m.resolve(name)
+	return mountError(fs.Remove(path), name)
+}
+
+// RemoveAll fails with EBUSY if path contains mount points.
+func (m *MountFs) RemoveAll(path string) error {
+	if m.isMountPoint(path) {
+		return &os.PathError{Op: "remove_all", Path: path, Err: syscall.EBUSY}
+	}
+	fs, inner, _ := m.resolve(path)
+	return mountError(fs.RemoveAll(inner), path)
+}
+
+func (m *MountFs) Rename(oldname, newname string) error {
+	if m.isMountPoint(oldname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EBUSY}
+	}
+	oldfs, oldpath, oldpoint := m.resolve(oldname)
+	_, newpath, newpoint := m.resolve(newname)
+	if oldpoint != newpoint {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	if m.isMountPoint(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EBUSY}
+	}
+	err := oldfs.Rename(oldpath, newpath)
+	var lerr *os.LinkError
+	if errors.As(err, &lerr) {
+		return &os.LinkError{Op: lerr.Op, Old: oldname, New: newname, Err: lerr.Err}
+	}
+	return mountError(err, oldname)
+}
+
+func (m *MountFs) Stat(name string) (os.FileInfo, error) {
+	fi, _, err := m.stat(name, false)
+	return fi, err
+}
+
+func (m *MountFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	return m.stat(name, true)
+}
+
+func (m *MountFs) Chmod(name string, mode os.FileMode) error {
+	fs, path, _ := m.resolve(name)
+	return mountError(fs.Chmod(path, mode), name)
+}
+
+func (m *MountFs) Chown(name string, uid, gid int) error {
+	fs, path, _ := m.resolve(name)
+	return mountError(fs.Chown(path, uid, gid), name)
+}
+
+func (m *MountFs) Chtimes(name string, atime, mtime time.Time) error {
+	fs, path, _ := m.resolve(name)
+	return mountError(fs.Chtimes(path, atime, mtime), name)
+}
+
+// mountFileInfo renames the info of the root of a mounted filesystem.
+type mountFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *mountFileInfo) Name() string { return fi.name }
+
+// mountDirInfo is the info of a directory leading to mount points, which
+// the filesystem below does not have.
+type mountDirInfo struct {
+	name string
+}
+
+func (fi *mountDirInfo) Name() string       { return fi.name }
+func (fi *mountDirInfo) Size() int64        { return 0 }
+func (fi *mountDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (fi *mountDirInfo) ModTime() time.Time { return time.Time{} }
+func (fi *mountDirInfo) IsDir() bool        { return true }
+func (fi *mountDirInfo) Sys() interface{}   { return nil }
+
+// MountFile is a file opened through a MountFs.
+type MountFile struct {
+	lockingFile
+	fs   *MountFs
+	name string
+
+	entries []os.FileInfo // of a directory, once read
+	read    bool
+}
+
+func (f *MountFile) Name() string {
+	return f.name
+}
+
+func (f *MountFile) Stat() (os.FileInfo, error) {
+	return f.fs.Stat(f.name)
+}
+
+// Readdir lists the entries of the directory in the filesystem below, and
+// those leading to mount points.
+func (f *MountFile) Readdir(count int) ([]os.FileInfo, error) {
+	below := f.fs.below(f.name)
+	if below == nil {
+		fis, err := f.File.Readdir(count)
+		return fis, mountError(err, f.name)
+	}
+	if !f.read {
+		f.read = true
+		fis, err := f.File.Readdir(-1)
+		if err != nil {
+			return nil, mountError(err, f.name)
+		}
+		for _, fi := range fis {
+			if !below[fi.Name()] {
+				f.entries = append(f.entries, fi)
+			}
+		}
+		for name := range below {
+			fi, err := f.fs.Stat(filepath.Join(f.name, name))
+			if err != nil {
+				return nil, err
+			}
+			f.entries = append(f.entries, fi)
+		}
+		sort.Slice(f.entries, func(i, j int) bool { return f.entries[i].Name() < f.entries[j].Name() })
+	}
+	fis := f.entries
+	if count > 0 {
+		if len(fis) == 0 {
+			return nil, io.EOF
+		}
+		if len(fis) > count {
+			fis = fis[:count]
+		}
+	}
+	f.entries = f.entries[len(fis):]
+	return fis, nil
+}
+
+func (f *MountFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
@@ -0,0 +1,108 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func newTestMountFs(t *testing.T) (*MountFs, Fs, Fs) {
+	t.Helper()
+	root, assets, tmp := &MemMapFs{}, &MemMapFs{}, &MemMapFs{}
+	root.MkdirAll("/etc", 0755)
+	WriteFile(root, "/etc/app.conf", []byte("root"), 0644)
+	WriteFile(assets, "/logo.png", []byte("png"), 0644)
+	fs := NewMountFs(root)
+	if err := fs.Mount("/srv/assets", assets); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mount("/tmp", tmp); err != nil {
+		t.Fatal(err)
+	}
+	return fs, assets, tmp
+}
+
+func TestMountFsRouting(t *testing.T) {
+	fs, assets, tmp := newTestMountFs(t)
+	if data, err := ReadFile(fs, "/srv/assets/logo.png"); err != nil || string(data) != "png" {
+		t.Errorf("expected the mounted file, got %q, %v", data, err)
+	}
+	if err := WriteFile(fs, "/tmp/scratch", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmp.Stat("/scratch"); err != nil {
+		t.Errorf("expected the file in the mounted filesystem, got %v", err)
+	}
+	if data, err := ReadFile(fs, "/etc/app.conf"); err != nil || string(data) != "root" {
+		t.Errorf("expected the root file, got %q, %v", data, err)
+	}
+
+	// The longest prefix wins.
+	nested := &MemMapFs{}
+	WriteFile(nested, "/icon", nil, 0644)
+	fs.Mount("/srv/assets/icons", nested)
+	if _, err := fs.Stat("/srv/assets/icons/icon"); err != nil {
+		t.Errorf("expected the nested mount, got %v", err)
+	}
+	if _, err := assets.Stat("/icons"); !os.IsNotExist(err) {
+		t.Errorf("expected nothing in the outer mount, got %v", err)
+	}
+
+	_, err := fs.Open("/srv/assets/missing")
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr.Path != "/srv/assets/missing" {
+		t.Errorf("expected errors to carry the full path, got %v", err)
+	}
+}
+
+func TestMountFsListings(t *testing.T) {
+	fs, _, _ := newTestMountFs(t)
+	names, err := readDirNames(fs, "/")
+	if err != nil || len(names) != 3 || names[0] != "etc" || names[1] != "srv" || names[2] != "tmp" {
+		t.Errorf("expected the mount points in the root, got %v, %v", names, err)
+	}
+	fi, err := fs.Stat("/srv")
+	if err != nil || !fi.IsDir() {
+		t.Errorf("expected a directory leading to a mount point, got %v, %v", fi, err)
+	}
+	fis, err := ReadDir(fs, "/srv")
+	if err != nil || len(fis) != 1 || fis[0].Name() != "assets" || !fis[0].IsDir() {
+		t.Errorf("expected the mount point, got %v, %v", fis, err)
+	}
+
+	var walked []string
+	Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	if len(walked) != 7 || walked[5] != "/srv/assets/logo.png" {
+		t.Errorf("expected to walk through the mounts, got %v", walked)
+	}
+}
+
+func TestMountFsCrossDevice(t *testing.T) {
+	fs, _, _ := newTestMountFs(t)
+	WriteFile(fs, "/tmp/a", nil, 0644)
+	if err := fs.Rename("/tmp/a", "/etc/a"); !errors.Is(err, syscall.EXDEV) {
+		t.Errorf("expected EXDEV, got %v", err)
+	}
+	if err := fs.Rename("/tmp/a", "/tmp/b"); err != nil {
+		t.Errorf("expected renames within a mount to work, got %v", err)
+	}
+	if err := fs.Rename("/tmp", "/tmp2"); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("expected a mount point not to be renamed, got %v", err)
+	}
+	if err := fs.RemoveAll("/srv"); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("expected a mount point not to be removed, got %v", err)
+	}
+	if err := fs.Unmount("/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/tmp/b"); !os.IsNotExist(err) {
+		t.Errorf("expected the unmounted file to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package afero
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+var _ Lstater = (*ObserveFs)(nil)
+
+// An Observation describes an operation made through an ObserveFs.
+type Observation struct {
+	// Fs is the name of the source filesystem, as returned by Name.
+	Fs string
+	// Op is the name of the method called: Create, Open, OpenFile,
+	// Mkdir, MkdirAll, Remove, RemoveAll, Rename, Stat, Lstat, Chmod,
+	// Chown, Chtimes, and for files Read, ReadAt, Write, WriteAt, Seek,
+	// Readdir, Readdirnames, Stat, Sync, Truncate and Close.
+	Op   string
+	Path string
+	// NewPath is the new name of the file for Rename.
+	NewPath string
+
+	Start    time.Time
+	Duration time.Duration
+	// Bytes is the number of bytes read or written.
+	Bytes int64
+	Err   error
+}
+
+// Failed reports whether the operation failed. Reaching the end of a file
+// is not a failure.
+func (o *Observation) Failed() bool {
+	return o.Err != nil && o.Err != io.EOF
+}
+
+// An ObserveLogger receives an Observation for each operation once it is
+// done, to write it as a structured log record.
+type ObserveLogger interface {
+	Log(o *Observation)
+}
+
+// ObserveMetrics receives the measurements of each operation once it is
+// done, labelled by the name of the filesystem and the operation.
+type ObserveMetrics interface {
+	// Count counts an operation.
+	Count(fs, op string, failed bool)
+	// Latency records the duration of an operation, typically in a
+	// histogram.
+	Latency(fs, op string, d time.Duration)
+	// Bytes adds to the bytes read or written. It is only called for
+	// operations which transferred some.
+	Bytes(fs, op string, n int64)
+}
+
+// An ObserveTracer starts a span when an operation starts. The span is
+// ended with the Observation of the operation once it is done.
+type ObserveTracer interface {
+	StartSpan(ctx context.Context, o *Observation) ObserveSpan
+}
+
+// ObserveSpan is a span started by an ObserveTracer.
+type ObserveSpan interface {
+	End(o *Observation)
+}
+
+// ObserveHooks are the hooks an ObserveFs reports to. Any of them may be
+// nil.
+type ObserveHooks struct {
+	Logger  ObserveLogger
+	Metrics ObserveMetrics
+	Tracer  ObserveTracer
+}
+
+// The ObserveFs reports the operations made on a source filesystem and on
+// the files opened through it to logging, metrics and tracing hooks, so
+// that one can see where time is spent. It does not depend on any backend:
+// the hooks adapt it to the one used.
+//
+// To see each layer of a stack, such as a CacheOnReadFs over an s3fs, wrap
+// each of them in an ObserveFs; the Fs field of the Observations then tells
+// them apart.
+type ObserveFs struct {
+	source Fs
+	name   string
+	hooks  ObserveHooks
+	ctx    context.Context
+}
+
+func NewObserveFs(source Fs, hooks ObserveHooks) *ObserveFs {
+	return &ObserveFs{source: source, name: source.Name(), hooks: hooks, ctx: context.Background()}
+}
+
+// WithContext returns a copy of o whose spans, and the ones of the files
+// opened through it, are started with ctx, for them to be children of the
+// span in ctx.
+func (o *ObserveFs) WithContext(ctx context.Context) *ObserveFs {
+	o2 := *o
+	o2.ctx = ctx
+	return &o2
+}
+
+// observeCall is an operation in progress.
+type observeCall struct {
+	fs   *ObserveFs
+	obs  Observation
+	span ObserveSpan
+}
+
+func (o *ObserveFs) begin(op, name string) *observeCall {
+	c := &observeCall{fs: o, obs: Observation{Fs: o.name, Op: op, Path: name, Start: time.Now()}}
+	if o.hooks.Tracer != nil {
+		c.span = o.hooks.Tracer.StartSpan(o.ctx, &c.obs)
+	}
+	return c
+}
+
+func (c *observeCall) end(n int64, err error) {
+	c.obs.Duration = time.Since(c.obs.Start)
+	c.obs.Bytes = n
+	c.obs.Err = err
+	hooks := c.fs.hooks
+	if c.span != nil {
+		c.span.End(&c.obs)
+	}
+	if hooks.Metrics != nil {
+		hooks.Metrics.Count(c.obs.Fs, c.obs.Op, c.obs.Failed())
+		hooks.Metrics.Latency(c.obs.Fs, c.obs.Op, c.obs.Duration)
+		if n > 0 {
+			hooks.Metrics.Bytes(c.obs.Fs, c.obs.Op, n)
+		}
+	}
+	if hooks.Logger != nil {
+		hooks.Logger.Log(&c.obs)
+	}
+}
+
+func (o *ObserveFs) open(op, name string, open func() (File, error)) (File, error) {
+	c := o.begin(op, name)
+	f, err := open()
+	c.end(0, err)
+	if err != nil {
+		return nil, err
+	}
+	return &ObserveFile{lockingFile: lockingFile{f}, fs: o}, nil
+}
+
+func (o *ObserveFs) Name() string {
+	return "ObserveFs"
+}
+
+func (o *ObserveFs) Create(name string) (File, error) {
+	return o.open("Create", name, func() (File, error) { return o.source.Create(name) })
+}
+
+func (o *ObserveFs) Open(name string) (File, error) {
+	return o.open("Open", name, func() (File, error) { return o.source.Open(name) })
+}
+
+func (o *ObserveFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return o.open("OpenFile", name, func() (File, error) { return o.source.OpenFile(name, flag, perm) })
+}
+
+func (o *ObserveFs) Mkdir(name string, perm os.FileMode) error {
+	c := o.begin("Mkdir", name)
+	err := o.source.Mkdir(name, perm)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) MkdirAll(path string, perm os.FileMode) error {
+	c := o.begin("MkdirAll", path)
+	err := o.source.MkdirAll(path, perm)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) Remove(name string) error {
+	c := o.begin("Remove", name)
+	err := o.source.Remove(name)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) RemoveAll(path string) error {
+	c := o.begin("RemoveAll", path)
+	err := o.source.RemoveAll(path)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) Rename(oldname, newname string) error {
+	c := o.begin("Rename", oldname)
+	c.obs.NewPath = newname
+	err := o.source.Rename(oldname, newname)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) Stat(name string) (os.FileInfo, error) {
+	c := o.begin("Stat", name)
+	fi, err := o.source.Stat(name)
+	c.end(0, err)
+	return fi, err
+}
+
+func (o *ObserveFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	c := o.begin("Lstat", name)
+	var fi os.FileInfo
+	var lstat bool
+	var err error
+	if lstater, ok := o.source.(Lstater); ok {
+		fi, lstat, err = lstater.LstatIfPossible(name)
+	} else {
+		fi, err = o.source.Stat(name)
+	}
+	c.end(0, err)
+	return fi, lstat, err
+}
+
+func (o *ObserveFs) Chmod(name string, mode os.FileMode) error {
+	c := o.begin("Chmod", name)
+	err := o.source.Chmod(name, mode)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) Chown(name string, uid, gid int) error {
+	c := o.begin("Chown", name)
+	err := o.source.Chown(name, uid, gid)
+	c.end(0, err)
+	return err
+}
+
+func (o *ObserveFs) Chtimes(name string, atime, mtime time.Time) error {
+	c := o.begin("Chtimes", name)
+	err := o.source.Chtimes(name, atime, mtime)
+	c.end(0, err)
+	return err
+}
+
+// ObserveFile is a file opened through an ObserveFs.
+type ObserveFile struct {
+	lockingFile
+	fs *ObserveFs
+}
+
+func (f *ObserveFile) transfer(op string, do func() (int, error)) (int, error) {
+	c := f.fs.begin(op, f.Name())
+	n, err := do()
+	c.end(int64(n), err)
+	return n, err
+}
+
+func (f *ObserveFile) call(op string, do func() error) error {
+	c := f.fs.begin(op, f.Name())
+	err := do()
+	c.end(0, err)
+	return err
+}
+
+func (f *ObserveFile) Close() error {
+	return f.call("Close", f.File.Close)
+}
+
+func (f *ObserveFile) Read(p []byte) (int, error) {
+	return f.transfer("Read", func() (int, error) { return f.File.Read(p) })
+}
+
+func (f *ObserveFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.transfer("ReadAt", func() (int, error) { return f.File.ReadAt(p, off) })
+}
+
+func (f *ObserveFile) Write(p []byte) (int, error) {
+	return f.transfer("Write", func() (int, error) { return f.File.Write(p) })
+}
+
+func (f *ObserveFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.transfer("WriteAt", func() (int, error) { return f.File.WriteAt(p, off) })
+}
+
+func (f *ObserveFile) WriteString(s string) (int, error) {
+	return f.transfer("Write", func() (int, error) { return f.File.WriteString(s) })
+}
+
+func (f *ObserveFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.call("Seek", func() error {
+		ret, err = f.File.Seek(offset, whence)
+		return err
+	})
+	return ret, err
+}
+
+func (f *ObserveFile) Readdir(count int) (fis []os.FileInfo, err error) {
+	f.call("Readdir", func() error {
+		fis, err = f.File.Readdir(count)
+		return err
+	})
+	return fis, err
+}
+
+func (f *ObserveFile) Readdirnames(n int) (names []string, err error) {
+	f.call("Readdirnames", func() error {
+		names, err = f.File.Readdirnames(n)
+		return err
+	})
+	return names, err
+}
+
+func (f *ObserveFile) Stat() (fi os.FileInfo, err error) {
+	f.call("Stat", func() error {
+		fi, err = f.File.Stat()
+		return err
+	})
+	return fi, err
+}
+
+func (f *ObserveFile) Sync() error {
+	return f.call("Sync", f.File.Sync)
+}
+
+func (f *ObserveFile) Truncate(size int64) error {
+	return f.call("Truncate", func() error { return f.File.Truncate(size) })
+}
@@ -0,0 +1,150 @@
+package afero
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observeRecorder struct {
+	mu      sync.Mutex
+	logs    []Observation
+	counts  map[string]int
+	failed  map[string]int
+	bytes   map[string]int64
+	latency map[string]int
+	spans   []string
+}
+
+func newObserveRecorder() *observeRecorder {
+	return &observeRecorder{
+		counts:  make(map[string]int),
+		failed:  make(map[string]int),
+		bytes:   make(map[string]int64),
+		latency: make(map[string]int),
+	}
+}
+
+func (r *observeRecorder) Log(o *Observation) {
+	r.mu.Lock()
+	r.logs = append(r.logs, *o)
+	r.mu.Unlock()
+}
+
+func (r *observeRecorder) Count(fs, op string, failed bool) {
+	r.mu.Lock()
+	r.counts[fs+"/"+op]++
+	if failed {
+		r.failed[fs+"/"+op]++
+	}
+	r.mu.Unlock()
+}
+
+func (r *observeRecorder) Latency(fs, op string, d time.Duration) {
+	r.mu.Lock()
+	r.latency[fs+"/"+op]++
+	r.mu.Unlock()
+}
+
+func (r *observeRecorder) Bytes(fs, op string, n int64) {
+	r.mu.Lock()
+	r.bytes[fs+"/"+op] += n
+	r.mu.Unlock()
+}
+
+type observeSpanKey struct{}
+
+type observeSpan struct {
+	r    *observeRecorder
+	name string
+}
+
+func (r *observeRecorder) StartSpan(ctx context.Context, o *Observation) ObserveSpan {
+	parent, _ := ctx.Value(observeSpanKey{}).(string)
+	r.mu.Lock()
+	r.spans = append(r.spans, "start "+parent+">"+o.Op)
+	r.mu.Unlock()
+	return &observeSpan{r: r, name: parent + ">" + o.Op}
+}
+
+func (s *observeSpan) End(o *Observation) {
+	s.r.mu.Lock()
+	s.r.spans = append(s.r.spans, "end "+s.name)
+	s.r.mu.Unlock()
+}
+
+func TestObserveFs(t *testing.T) {
+	r := newObserveRecorder()
+	fs := NewObserveFs(&MemMapFs{}, ObserveHooks{Logger: r, Metrics: r, Tracer: r})
+
+	if err := WriteFile(fs, "/a", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(fs, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/missing"); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	fs.Rename("/a", "/b")
+
+	if r.counts["MemMapFS/OpenFile"] != 1 || r.counts["MemMapFS/Open"] != 1 {
+		t.Errorf("expected one OpenFile and one Open, got %v", r.counts)
+	}
+	if r.failed["MemMapFS/Stat"] != 1 {
+		t.Errorf("expected the failed Stat to be counted, got %v", r.failed)
+	}
+	if r.failed["MemMapFS/Read"] != 0 {
+		t.Errorf("expected io.EOF not to count as a failure, got %v", r.failed)
+	}
+	if r.bytes["MemMapFS/Write"] != 5 || r.bytes["MemMapFS/Read"] != 5 {
+		t.Errorf("expected 5 bytes written and read, got %v", r.bytes)
+	}
+	for op, n := range r.counts {
+		if r.latency[op] != n {
+			t.Errorf("expected a latency for each %s, got %d for %d", op, r.latency[op], n)
+		}
+	}
+
+	var sawEOF, sawRename bool
+	for _, o := range r.logs {
+		if o.Fs != "MemMapFS" || o.Start.IsZero() {
+			t.Errorf("unexpected observation %+v", o)
+		}
+		if o.Op == "Read" && o.Err == io.EOF && o.Path == "/a" {
+			sawEOF = true
+		}
+		if o.Op == "Rename" && o.Path == "/a" && o.NewPath == "/b" {
+			sawRename = true
+		}
+	}
+	if !sawEOF || !sawRename {
+		t.Errorf("expected the EOF and the rename to be logged, got %+v", r.logs)
+	}
+	if len(r.spans) != 2*len(r.logs) {
+		t.Errorf("expected a span for each operation, got %d for %d", len(r.spans), len(r.logs))
+	}
+}
+
+func TestObserveFsContext(t *testing.T) {
+	r := newObserveRecorder()
+	fs := NewObserveFs(&MemMapFs{}, ObserveHooks{Tracer: r})
+	ctx := context.WithValue(context.Background(), observeSpanKey{}, "request")
+	f, err := fs.WithContext(ctx).Create("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	want := []string{"start request>Create", "end request>Create", "start request>Close", "end request>Close"}
+	if len(r.spans) != len(want) {
+		t.Fatalf("expected %v, got %v", want, r.spans)
+	}
+	for i := range want {
+		if r.spans[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, r.spans)
+		}
+	}
+}
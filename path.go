@@ -38,6 +38,34 @@ func readDirNames(fs Fs, dirname string) ([]string, error) {
 	return names, nil
 }
 
+// readdirFiltered reads the entries of the directory f as Readdir does,
+// passing them through filter, which returns the entry to list in place of
+// fi, or false to leave it out. A batch whose entries are all left out is
+// not taken for the end of the directory: reading goes on.
+func readdirFiltered(f File, count int, filter func(fi os.FileInfo) (os.FileInfo, bool)) ([]os.FileInfo, error) {
+	for {
+		fis, err := f.Readdir(count)
+		kept := fis[:0]
+		for _, fi := range fis {
+			if fi, ok := filter(fi); ok {
+				kept = append(kept, fi)
+			}
+		}
+		if len(kept) > 0 || len(fis) == 0 || err != nil || count <= 0 {
+			return kept, err
+		}
+	}
+}
+
+// fileInfoNames returns the names of the entries of a directory.
+func fileInfoNames(fis []os.FileInfo) []string {
+	names := make([]string, len(fis))
+	for i, fi := range fis {
+		names[i] = filepath.Base(fi.Name())
+	}
+	return names
+}
+
 // walk recursively descends path, calling walkFn
 // adapted from https://golang.org/src/path/filepath/path.go
 func walk(fs Fs, path string, info os.FileInfo, walkFn filepath.WalkFunc) error {
@@ -0,0 +1,213 @@
+package afero
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// PollingWatcher implements Watcher for any Fs, including the ones without
+// a native source of change notifications such as the network backends and
+// the union filesystems. It periodically walks the watched tree and
+// compares each snapshot with the previous one by size, modification time,
+// mode and, if Hash is set, content.
+//
+// A rename is reported as the removal of the old name followed by the
+// creation of the new one.
+type PollingWatcher struct {
+	source   Fs
+	interval time.Duration
+
+	// MaxDepth limits how many directory levels below the watched path
+	// are scanned by a recursive watch. Zero means no limit.
+	MaxDepth int
+
+	// Hash, if set, is used to checksum regular files so that changes which
+	// leave size and modification time untouched are detected as well.
+	// Every regular file watched is then read on every poll.
+	Hash func() hash.Hash
+}
+
+func NewPollingWatcher(source Fs, interval time.Duration) *PollingWatcher {
+	return &PollingWatcher{source: source, interval: interval}
+}
+
+// Watch takes an initial snapshot of name, which must exist, and starts
+// polling it for changes. It fails with EINVAL if the interval of the
+// PollingWatcher is not positive.
+func (p *PollingWatcher) Watch(name string, recursive bool) (Watch, error) {
+	if p.interval <= 0 {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: syscall.EINVAL}
+	}
+	depth := 1
+	if recursive {
+		depth = p.MaxDepth
+	}
+	w := &pollWatch{
+		eventQueue: newEventQueue(),
+		watcher:    p,
+		root:       filepath.Clean(name),
+		depth:      depth,
+		done:       make(chan struct{}),
+	}
+	snap, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.poll(snap)
+	return w, nil
+}
+
+type pollEntry struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+	sum     []byte
+}
+
+type pollWatch struct {
+	eventQueue
+	watcher *PollingWatcher
+	root    string
+	depth   int
+	done    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func (w *pollWatch) Close() error {
+	w.once.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+		w.close()
+	})
+	return nil
+}
+
+func (w *pollWatch) poll(snap map[string]pollEntry) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.watcher.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+		next, err := w.scan()
+		if err != nil && !os.IsNotExist(err) {
+			w.fail(err)
+			continue
+		}
+		w.diff(snap, next)
+		snap = next
+	}
+}
+
+// scan walks the watched tree.
+func (w *pollWatch) scan() (map[string]pollEntry, error) {
+	snap := make(map[string]pollEntry)
+	fi, err := lstatIfPossible(w.watcher.source, w.root)
+	if err != nil {
+		return snap, err
+	}
+	w.record(snap, w.root, fi)
+	if fi.IsDir() {
+		w.scanDir(snap, w.root, 1)
+	}
+	return snap, nil
+}
+
+func (w *pollWatch) scanDir(snap map[string]pollEntry, dir string, level int) {
+	names, err := readDirNames(w.watcher.source, dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.fail(err)
+		}
+		return
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		fi, err := lstatIfPossible(w.watcher.source, path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				w.fail(err)
+			}
+			continue
+		}
+		w.record(snap, path, fi)
+		if fi.IsDir() && (w.depth == 0 || level < w.depth) {
+			w.scanDir(snap, path, level+1)
+		}
+	}
+}
+
+func (w *pollWatch) record(snap map[string]pollEntry, path string, fi os.FileInfo) {
+	e := pollEntry{size: fi.Size(), modTime: fi.ModTime(), mode: fi.Mode()}
+	if w.watcher.Hash != nil && fi.Mode().IsRegular() {
+		// Hashed on every poll, as the next one compares with this sum
+		// even when this one found a change already.
+		sum, err := w.checksum(path)
+		if err != nil {
+			w.fail(err)
+		}
+		e.sum = sum
+	}
+	snap[path] = e
+}
+
+func (w *pollWatch) checksum(path string) ([]byte, error) {
+	f, err := w.watcher.source.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := w.watcher.Hash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (w *pollWatch) diff(prev, next map[string]pollEntry) {
+	var names []string
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.send(Event{Name: name, Op: OpRemove})
+	}
+
+	names = names[:0]
+	for name := range next {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		n := next[name]
+		p, ok := prev[name]
+		switch {
+		case !ok:
+			w.send(Event{Name: name, Op: OpCreate})
+		case p.mode.IsDir() != n.mode.IsDir():
+			w.send(Event{Name: name, Op: OpRemove})
+			w.send(Event{Name: name, Op: OpCreate})
+		case !n.mode.IsDir() && (p.size != n.size || !p.modTime.Equal(n.modTime)):
+			w.send(Event{Name: name, Op: OpWrite})
+		case p.sum != nil && n.sum != nil && !bytes.Equal(p.sum, n.sum):
+			w.send(Event{Name: name, Op: OpWrite})
+		case p.mode != n.mode:
+			w.send(Event{Name: name, Op: OpChmod})
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package afero
+
+import (
+	"crypto/sha256"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPollingWatcher(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/drop/existing.txt", []byte("x"), 0644)
+
+	// Changes are made behind the back of the polled read-only view.
+	pw := NewPollingWatcher(NewReadOnlyFs(fs), 10*time.Millisecond)
+	w, err := pw.Watch("/drop", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	WriteFile(fs, "/drop/sub/new.txt", []byte("x"), 0644)
+	expectEvents(t, w,
+		Event{Name: "/drop/sub", Op: OpCreate},
+		Event{Name: "/drop/sub/new.txt", Op: OpCreate},
+	)
+
+	WriteFile(fs, "/drop/existing.txt", []byte("longer"), 0644)
+	expectEvents(t, w, Event{Name: "/drop/existing.txt", Op: OpWrite})
+
+	fs.Chmod("/drop/existing.txt", 0600)
+	expectEvents(t, w, Event{Name: "/drop/existing.txt", Op: OpChmod})
+
+	fs.Rename("/drop/existing.txt", "/drop/renamed.txt")
+	expectEvents(t, w, Event{Name: "/drop/existing.txt", Op: OpRemove})
+
+	if _, err := pw.Watch("/missing", false); err == nil {
+		t.Error("expected an error watching a missing path")
+	}
+	if _, err := NewPollingWatcher(fs, 0).Watch("/drop", false); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("expected EINVAL for a zero interval, got %v", err)
+	}
+}
+
+func TestPollingWatcherDepth(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/root/a/b", 0755)
+
+	pw := NewPollingWatcher(fs, 10*time.Millisecond)
+	pw.MaxDepth = 1
+	w, err := pw.Watch("/root", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	WriteFile(fs, "/root/a/b/too-deep.txt", []byte("x"), 0644)
+	WriteFile(fs, "/root/shallow.txt", []byte("x"), 0644)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Name == "/root/a/b/too-deep.txt" {
+				t.Fatalf("unexpected event %v", ev)
+			}
+			if ev.Name != "/root/shallow.txt" {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("timed out")
+		}
+		break
+	}
+}
+
+func TestPollingWatcherHash(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/file.txt", []byte("aaaa"), 0644)
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs.Chtimes("/file.txt", mtime, mtime)
+
+	pw := NewPollingWatcher(fs, 10*time.Millisecond)
+	pw.Hash = sha256.New
+	w, err := pw.Watch("/file.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Same size and modification time, different content.
+	WriteFile(fs, "/file.txt", []byte("bbbb"), 0644)
+	fs.Chtimes("/file.txt", mtime, mtime)
+	expectEvents(t, w, Event{Name: "/file.txt", Op: OpWrite})
+
+	// Again, right after a change of size.
+	WriteFile(fs, "/file.txt", []byte("ccccc"), 0644)
+	fs.Chtimes("/file.txt", mtime, mtime)
+	expectEvents(t, w, Event{Name: "/file.txt", Op: OpWrite})
+	WriteFile(fs, "/file.txt", []byte("ddddd"), 0644)
+	fs.Chtimes("/file.txt", mtime, mtime)
+	expectEvents(t, w, Event{Name: "/file.txt", Op: OpWrite})
+}
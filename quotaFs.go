@@ -0,0 +1,497 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ Lstater = (*QuotaFs)(nil)
+
+// Quota holds the limits enforced by a QuotaFs. A zero value means no limit.
+type Quota struct {
+	// MaxBytes limits the total size of all files.
+	MaxBytes int64
+	// MaxFiles limits the number of files and directories, the root
+	// directory excluded.
+	MaxFiles int64
+	// MaxFileSize limits the size of any single file.
+	MaxFileSize int64
+}
+
+// QuotaUsage is the usage tracked by a QuotaFs.
+type QuotaUsage struct {
+	Bytes int64
+	Files int64
+}
+
+// The QuotaFs enforces a Quota on the files created and written through it.
+// Operations which would exceed MaxBytes or MaxFiles fail with EDQUOT,
+// writes beyond MaxFileSize with EFBIG, both wrapped in an *os.PathError.
+//
+// Usage is tracked in memory. Files which already exist in the source are
+// accounted for the first time they are accessed; call RebuildUsage to
+// account for the whole existing tree up front. Changes made to the source
+// behind the back of the QuotaFs are not seen.
+//
+// The source is called without holding the lock on the usage: creations
+// reserve their files first, and the usage is updated once the source is
+// done.
+//
+// It is meant to be put on top of a filesystem with absolute names, such
+// as a BasePathFs holding the files of a tenant.
+type QuotaFs struct {
+	source Fs
+	quota  Quota
+
+	mu            sync.Mutex
+	usage         QuotaUsage
+	reserved      int64  // bytes of writes in flight
+	reservedFiles int64  // files of creations in flight
+	changes       uint64 // bumped when entries may be gone from the source
+	entries       map[string]*quotaEntry
+}
+
+type quotaEntry struct {
+	size    int64
+	dir     bool
+	removed bool
+}
+
+func NewQuotaFs(source Fs, quota Quota) *QuotaFs {
+	return &QuotaFs{source: source, quota: quota, entries: make(map[string]*quotaEntry)}
+}
+
+// Usage returns the bytes and files currently accounted for.
+func (q *QuotaFs) Usage() QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage
+}
+
+// RebuildUsage discards the tracked usage and recomputes it by walking the
+// whole source filesystem.
+func (q *QuotaFs) RebuildUsage() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.usage = QuotaUsage{}
+	q.entries = make(map[string]*quotaEntry)
+	q.changes++
+	return Walk(q.source, FilePathSeparator, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path = normalizePath(path); path != FilePathSeparator {
+			q.track(path, info)
+		}
+		return nil
+	})
+}
+
+func (q *QuotaFs) track(name string, info os.FileInfo) *quotaEntry {
+	e := &quotaEntry{dir: info.IsDir()}
+	if info.Mode().IsRegular() {
+		e.size = info.Size()
+	}
+	q.entries[name] = e
+	q.usage.Files++
+	q.usage.Bytes += e.size
+	return e
+}
+
+// lookup returns the entry of name, adopting it from the source if it
+// exists there but is not tracked yet. The source is looked at without
+// q.mu held.
+func (q *QuotaFs) lookup(name string) *quotaEntry {
+	if name == FilePathSeparator {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if e, ok := q.entries[name]; ok {
+			return e
+		}
+		changes := q.changes
+		q.mu.Unlock()
+		fi, err := lstatIfPossible(q.source, name)
+		q.mu.Lock()
+		if q.changes != changes {
+			// Something was removed or renamed meanwhile, fi may be stale.
+			continue
+		}
+		if e, ok := q.entries[name]; ok {
+			return e
+		}
+		if err != nil {
+			return nil
+		}
+		return q.track(name, fi)
+	}
+}
+
+func (q *QuotaFs) forget(name string, e *quotaEntry) {
+	delete(q.entries, name)
+	e.removed = true
+	q.usage.Files--
+	q.usage.Bytes -= e.size
+}
+
+// reserveFiles fails with EDQUOT if n more files do not fit, and otherwise
+// reserves them until releaseFiles is called.
+func (q *QuotaFs) reserveFiles(op, name string, n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quota.MaxFiles > 0 && q.usage.Files+q.reservedFiles+n > q.quota.MaxFiles {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EDQUOT}
+	}
+	q.reservedFiles += n
+	return nil
+}
+
+// releaseFiles releases n reserved files. It must be called with q.mu held,
+// after the created files have been tracked.
+func (q *QuotaFs) releaseFiles(n int64) {
+	q.reservedFiles -= n
+}
+
+// reserve checks that e may grow to end bytes and reserves the growth until
+// the write is committed.
+func (q *QuotaFs) reserve(op, name string, e *quotaEntry, end int64) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quota.MaxFileSize > 0 && end > q.quota.MaxFileSize {
+		return 0, &os.PathError{Op: op, Path: name, Err: syscall.EFBIG}
+	}
+	grow := end - e.size
+	if grow <= 0 {
+		return 0, nil
+	}
+	if q.quota.MaxBytes > 0 && q.usage.Bytes+q.reserved+grow > q.quota.MaxBytes {
+		return 0, &os.PathError{Op: op, Path: name, Err: syscall.EDQUOT}
+	}
+	q.reserved += grow
+	return grow, nil
+}
+
+// commit releases a reservation and accounts for the new size of e.
+func (q *QuotaFs) commit(e *quotaEntry, reserved, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reserved -= reserved
+	if !e.removed {
+		q.usage.Bytes += size - e.size
+		e.size = size
+	}
+}
+
+func (q *QuotaFs) Name() string {
+	return "QuotaFs"
+}
+
+func (q *QuotaFs) Create(name string) (File, error) {
+	return q.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (q *QuotaFs) Open(name string) (File, error) {
+	return q.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (q *QuotaFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = normalizePath(name)
+	if name == FilePathSeparator {
+		return q.source.OpenFile(name, flag, perm)
+	}
+	var reserved int64
+	if flag&os.O_CREATE != 0 && q.lookup(name) == nil {
+		if err := q.reserveFiles("open", name, 1); err != nil {
+			return nil, err
+		}
+		reserved = 1
+	}
+	f, err := q.source.OpenFile(name, flag, perm)
+	var fi os.FileInfo
+	if err == nil {
+		if fi, err = f.Stat(); err != nil {
+			f.Close()
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.releaseFiles(reserved)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := q.entries[name]
+	if !ok {
+		e = q.track(name, fi)
+	} else if fi.Mode().IsRegular() {
+		q.usage.Bytes += fi.Size() - e.size
+		e.size = fi.Size()
+	}
+	return &QuotaFile{lockingFile: lockingFile{f}, fs: q, entry: e, name: name, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (q *QuotaFs) Mkdir(name string, perm os.FileMode) error {
+	name = normalizePath(name)
+	var reserved int64
+	if q.lookup(name) == nil {
+		if err := q.reserveFiles("mkdir", name, 1); err != nil {
+			return err
+		}
+		reserved = 1
+	}
+	err := q.source.Mkdir(name, perm)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.releaseFiles(reserved)
+	if err != nil {
+		return err
+	}
+	if _, ok := q.entries[name]; !ok {
+		q.entries[name] = &quotaEntry{dir: true}
+		q.usage.Files++
+	}
+	return nil
+}
+
+func (q *QuotaFs) MkdirAll(path string, perm os.FileMode) error {
+	path = normalizePath(path)
+	var missing []string
+	for dir := path; dir != FilePathSeparator && q.lookup(dir) == nil; dir = filepath.Dir(dir) {
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if err := q.reserveFiles("mkdir", path, int64(len(missing))); err != nil {
+		return err
+	}
+	err := q.source.MkdirAll(path, perm)
+	// Account for what was created, even if it failed half way.
+	for _, dir := range missing {
+		q.lookup(dir)
+	}
+	q.mu.Lock()
+	q.releaseFiles(int64(len(missing)))
+	q.mu.Unlock()
+	return err
+}
+
+func (q *QuotaFs) Remove(name string) error {
+	name = normalizePath(name)
+	if err := q.source.Remove(name); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changes++
+	if e, ok := q.entries[name]; ok {
+		q.forget(name, e)
+	}
+	return nil
+}
+
+func (q *QuotaFs) RemoveAll(path string) error {
+	path = normalizePath(path)
+	err := q.source.RemoveAll(path)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changes++
+	gone := make(map[string]*quotaEntry)
+	for name, e := range q.entries {
+		if inQuotaSubtree(path, name) {
+			gone[name] = e
+		}
+	}
+	if err != nil {
+		// Forget only what is gone, the removal having failed half way.
+		q.mu.Unlock()
+		for name := range gone {
+			if _, serr := lstatIfPossible(q.source, name); !errors.Is(serr, os.ErrNotExist) {
+				delete(gone, name)
+			}
+		}
+		q.mu.Lock()
+	}
+	for name, e := range gone {
+		if q.entries[name] == e {
+			q.forget(name, e)
+		}
+	}
+	return err
+}
+
+func (q *QuotaFs) Rename(oldname, newname string) error {
+	oldname, newname = normalizePath(oldname), normalizePath(newname)
+	if err := q.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	if oldname == newname {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changes++
+	if target, ok := q.entries[newname]; ok {
+		q.forget(newname, target)
+	}
+	moved := make(map[string]*quotaEntry)
+	for name, e := range q.entries {
+		if inQuotaSubtree(oldname, name) {
+			delete(q.entries, name)
+			moved[newname+strings.TrimPrefix(name, oldname)] = e
+		}
+	}
+	for name, e := range moved {
+		q.entries[name] = e
+	}
+	return nil
+}
+
+// inQuotaSubtree reports whether name is root or below it.
+func inQuotaSubtree(root, name string) bool {
+	if name == root || root == FilePathSeparator {
+		return true
+	}
+	return strings.HasPrefix(name, root+FilePathSeparator)
+}
+
+func (q *QuotaFs) Stat(name string) (os.FileInfo, error) {
+	return q.source.Stat(name)
+}
+
+func (q *QuotaFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lstater, ok := q.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := q.source.Stat(name)
+	return fi, false, err
+}
+
+func (q *QuotaFs) Chmod(name string, mode os.FileMode) error {
+	return q.source.Chmod(name, mode)
+}
+
+func (q *QuotaFs) Chown(name string, uid, gid int) error {
+	return q.source.Chown(name, uid, gid)
+}
+
+func (q *QuotaFs) Chtimes(name string, atime, mtime time.Time) error {
+	return q.source.Chtimes(name, atime, mtime)
+}
+
+// Statfs reports the quota as the capacity of the filesystem. The free
+// space is further capped by the one of the source, if it can tell.
+func (q *QuotaFs) Statfs(name string) (*FsStats, error) {
+	st, err := statfsIfPossible(q.source, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil {
+		st = &FsStats{
+			TotalBytes:  math.MaxInt64,
+			FreeBytes:   math.MaxInt64,
+			AvailBytes:  math.MaxInt64,
+			TotalInodes: math.MaxInt64,
+			FreeInodes:  math.MaxInt64,
+		}
+	}
+	q.mu.Lock()
+	usage := q.usage
+	usage.Bytes += q.reserved
+	usage.Files += q.reservedFiles
+	q.mu.Unlock()
+
+	if q.quota.MaxBytes > 0 {
+		free := subtractOrZero(uint64(q.quota.MaxBytes), uint64(usage.Bytes))
+		st.TotalBytes = uint64(q.quota.MaxBytes)
+		st.FreeBytes = minUint64(st.FreeBytes, free)
+		st.AvailBytes = minUint64(st.AvailBytes, free)
+	}
+	if q.quota.MaxFiles > 0 {
+		free := subtractOrZero(uint64(q.quota.MaxFiles), uint64(usage.Files))
+		st.TotalInodes = uint64(q.quota.MaxFiles)
+		st.FreeInodes = minUint64(st.FreeInodes, free)
+	}
+	return st, nil
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// QuotaFile is a file opened through a QuotaFs. Writes and truncations are
+// checked against the quota before they reach the source file.
+type QuotaFile struct {
+	lockingFile
+	fs     *QuotaFs
+	entry  *quotaEntry
+	name   string
+	append bool
+}
+
+// size returns the size of the file after a change, falling back to the
+// expected one if the source file cannot tell.
+func (f *QuotaFile) size(expected int64) int64 {
+	if fi, err := f.File.Stat(); err == nil {
+		return fi.Size()
+	}
+	return expected
+}
+
+func (f *QuotaFile) write(op string, off int64, p []byte, write func() (int, error)) (int, error) {
+	end := off + int64(len(p))
+	reserved, err := f.fs.reserve(op, f.name, f.entry, end)
+	if err != nil {
+		return 0, err
+	}
+	n, err := write()
+	f.fs.commit(f.entry, reserved, f.size(off+int64(n)))
+	return n, err
+}
+
+func (f *QuotaFile) Write(p []byte) (int, error) {
+	var off int64
+	var err error
+	if f.append {
+		off = f.size(0)
+	} else {
+		off, err = f.File.Seek(0, io.SeekCurrent)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return f.write("write", off, p, func() (int, error) { return f.File.Write(p) })
+}
+
+func (f *QuotaFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write("write", off, p, func() (int, error) { return f.File.WriteAt(p, off) })
+}
+
+func (f *QuotaFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *QuotaFile) Truncate(size int64) error {
+	reserved, err := f.fs.reserve("truncate", f.name, f.entry, size)
+	if err != nil {
+		return err
+	}
+	err = f.File.Truncate(size)
+	f.fs.commit(f.entry, reserved, f.size(size))
+	return err
+}
@@ -0,0 +1,160 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestQuotaFsBytes(t *testing.T) {
+	q := NewQuotaFs(&MemMapFs{}, Quota{MaxBytes: 100, MaxFileSize: 60})
+
+	if err := WriteFile(q, "/a", make([]byte, 60), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(q, "/b", make([]byte, 61), 0644); !errors.Is(err, syscall.EFBIG) {
+		t.Errorf("expected EFBIG, got %v", err)
+	}
+	if err := WriteFile(q, "/b", make([]byte, 50), 0644); !errors.Is(err, syscall.EDQUOT) {
+		t.Errorf("expected EDQUOT, got %v", err)
+	}
+	// Overwriting in place does not use more space.
+	f, _ := q.OpenFile("/a", os.O_RDWR, 0)
+	if _, err := f.WriteAt(make([]byte, 10), 50); err != nil {
+		t.Error(err)
+	}
+	if err := f.Truncate(70); !errors.Is(err, syscall.EFBIG) {
+		t.Errorf("expected EFBIG, got %v", err)
+	}
+	if err := f.Truncate(10); err != nil {
+		t.Error(err)
+	}
+	f.Close()
+	if got := q.Usage(); got != (QuotaUsage{Bytes: 10, Files: 2}) {
+		t.Errorf("unexpected usage %+v", got)
+	}
+
+	if err := WriteFile(q, "/b", make([]byte, 50), 0644); err != nil {
+		t.Error(err)
+	}
+	if err := q.Remove("/b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Usage(); got != (QuotaUsage{Bytes: 10, Files: 1}) {
+		t.Errorf("unexpected usage after remove %+v", got)
+	}
+}
+
+func TestQuotaFsFiles(t *testing.T) {
+	q := NewQuotaFs(&MemMapFs{}, Quota{MaxFiles: 3})
+
+	if err := q.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Create("/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Create("/a/b/d"); !errors.Is(err, syscall.EDQUOT) {
+		t.Errorf("expected EDQUOT, got %v", err)
+	}
+	if err := q.MkdirAll("/x/y", 0755); !errors.Is(err, syscall.EDQUOT) {
+		t.Errorf("expected EDQUOT, got %v", err)
+	}
+	// Reopening an existing file is fine.
+	if _, err := q.Create("/a/b/c"); err != nil {
+		t.Error(err)
+	}
+
+	if err := q.Rename("/a/b", "/a/z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.RemoveAll("/a/z"); err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Usage(); got != (QuotaUsage{Files: 1}) {
+		t.Errorf("unexpected usage %+v", got)
+	}
+	if _, err := q.Create("/a/e"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQuotaFsRebuildUsage(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/tenant/dir/a", make([]byte, 30), 0644)
+	WriteFile(base, "/tenant/b", make([]byte, 20), 0644)
+
+	q := NewQuotaFs(NewBasePathFs(base, "/tenant"), Quota{MaxBytes: 60, MaxFiles: 10})
+	if err := q.RebuildUsage(); err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Usage(); got != (QuotaUsage{Bytes: 50, Files: 3}) {
+		t.Errorf("unexpected usage %+v", got)
+	}
+	if err := WriteFile(q, "/c", make([]byte, 20), 0644); !errors.Is(err, syscall.EDQUOT) {
+		t.Errorf("expected EDQUOT, got %v", err)
+	}
+
+	st, err := q.Statfs("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalBytes != 60 || st.AvailBytes != 10 || st.TotalInodes != 10 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestQuotaFsSlowSource(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	source := NewInterceptFs(&MemMapFs{}, Before(func(c *Call) error {
+		if c.Name == "/slow" && (c.Op == "OpenFile" || c.Op == "Remove") {
+			entered <- struct{}{}
+			<-release
+		}
+		return nil
+	}))
+	q := NewQuotaFs(source, Quota{MaxFiles: 2})
+	if err := q.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A creation in flight holds its file while the source is busy, without
+	// blocking other operations.
+	done := make(chan error)
+	go func() {
+		f, err := q.Create("/slow")
+		if err == nil {
+			f.Close()
+		}
+		done <- err
+	}()
+	<-entered
+	if _, err := q.Create("/other"); !errors.Is(err, syscall.EDQUOT) {
+		t.Errorf("expected EDQUOT while a creation is in flight, got %v", err)
+	}
+	if err := q.Remove("/dir"); err != nil {
+		t.Error(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Usage(); got != (QuotaUsage{Files: 1}) {
+		t.Errorf("unexpected usage %+v", got)
+	}
+
+	release = make(chan struct{})
+	go func() { done <- q.Remove("/slow") }()
+	<-entered
+	if err := q.Mkdir("/dir", 0755); err != nil {
+		t.Error(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Usage(); got != (QuotaUsage{Files: 1}) {
+		t.Errorf("unexpected usage after remove %+v", got)
+	}
+}
@@ -21,15 +21,15 @@ func (r *ReadOnlyFs) ReadDir(name string) ([]os.FileInfo, error) {
 }
 
 func (r *ReadOnlyFs) Chtimes(n string, a, m time.Time) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "chtimes", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Chmod(n string, m os.FileMode) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "chmod", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Chown(n string, uid, gid int) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "chown", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Name() string {
@@ -60,21 +60,54 @@ func (r *ReadOnlyFs) ReadlinkIfPossible(name string) (string, error) {
 	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
 }
 
+// Statfs reports the capacity of the source filesystem, with no space
+// available, as nothing can be written through the filter.
+func (r *ReadOnlyFs) Statfs(name string) (*FsStats, error) {
+	st, err := statfsIfPossible(r.source, name)
+	if err != nil {
+		return nil, err
+	}
+	st.AvailBytes = 0
+	return st, nil
+}
+
+func (r *ReadOnlyFs) GetXattr(name, attr string) ([]byte, error) {
+	if x, ok := r.source.(Xattrer); ok {
+		return x.GetXattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (r *ReadOnlyFs) SetXattr(name, attr string, value []byte) error {
+	return &os.PathError{Op: "setxattr", Path: name, Err: ErrReadOnly}
+}
+
+func (r *ReadOnlyFs) ListXattr(name string) ([]string, error) {
+	if x, ok := r.source.(Xattrer); ok {
+		return x.ListXattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (r *ReadOnlyFs) RemoveXattr(name, attr string) error {
+	return &os.PathError{Op: "removexattr", Path: name, Err: ErrReadOnly}
+}
+
 func (r *ReadOnlyFs) Rename(o, n string) error {
-	return syscall.EPERM
+	return &os.LinkError{Op: "rename", Old: o, New: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) RemoveAll(p string) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "remove_all", Path: p, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Remove(n string) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "remove", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
 	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-		return nil, syscall.EPERM
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrReadOnly}
 	}
 	return r.source.OpenFile(name, flag, perm)
 }
@@ -84,13 +117,20 @@ func (r *ReadOnlyFs) Open(n string) (File, error) {
 }
 
 func (r *ReadOnlyFs) Mkdir(n string, p os.FileMode) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "mkdir", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) MkdirAll(n string, p os.FileMode) error {
-	return syscall.EPERM
+	return &os.PathError{Op: "mkdir", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Create(n string) (File, error) {
-	return nil, syscall.EPERM
+	return nil, &os.PathError{Op: "create", Path: n, Err: ErrReadOnly}
+}
+
+func (r *ReadOnlyFs) Watch(name string, recursive bool) (Watch, error) {
+	if watcher, ok := r.source.(Watcher); ok {
+		return watcher.Watch(name, recursive)
+	}
+	return nil, &os.PathError{Op: "watch", Path: name, Err: ErrNoWatch}
 }
@@ -0,0 +1,833 @@
+package afero
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+var _ Lstater = (*RecordFs)(nil)
+
+// traceData formats up to 64 bytes of data from off, and its length.
+func traceData(data []byte, off int) string {
+	end := off + 64
+	if end > len(data) {
+		end = len(data)
+	}
+	s := fmt.Sprintf("%q", data[off:end])
+	if off > 0 {
+		s = fmt.Sprintf("@%d:", off) + s
+	}
+	if off > 0 || end < len(data) {
+		s += fmt.Sprintf(" (%d bytes)", len(data))
+	}
+	return s
+}
+
+// traceCall is a call recorded in a trace: its arguments, followed by its
+// results in Res. Calls on files carry the handle of the file, numbered
+// from 1 in the order the files were opened.
+type traceCall struct {
+	Op      string      `json:"op"`
+	Handle  int         `json:"handle,omitempty"`
+	Name    string      `json:"name,omitempty"`
+	NewName string      `json:"newname,omitempty"`
+	Flag    int         `json:"flag,omitempty"`
+	Perm    os.FileMode `json:"perm,omitempty"`
+	Off     int64       `json:"off,omitempty"`
+	Whence  int         `json:"whence,omitempty"`
+	Count   int         `json:"count,omitempty"`
+	UID     int         `json:"uid,omitempty"`
+	GID     int         `json:"gid,omitempty"`
+	Atime   int64       `json:"atime,omitempty"`
+	Mtime   int64       `json:"mtime,omitempty"`
+	Data    []byte      `json:"data,omitempty"`
+
+	Res traceResult `json:"res"`
+}
+
+type traceResult struct {
+	Handle int              `json:"handle,omitempty"`
+	Name   string           `json:"name,omitempty"`
+	N      int64            `json:"n,omitempty"`
+	Data   []byte           `json:"data,omitempty"`
+	Names  []string         `json:"names,omitempty"`
+	Infos  []*traceFileInfo `json:"infos,omitempty"`
+	Lstat  bool             `json:"lstat,omitempty"`
+	Err    *traceError      `json:"err,omitempty"`
+}
+
+// fields returns the arguments of the call which are set, in a fixed order.
+func (c *traceCall) fields() [][2]string {
+	var fields [][2]string
+	add := func(key, format string, value interface{}) {
+		fields = append(fields, [2]string{key, fmt.Sprintf(format, value)})
+	}
+	if c.Handle != 0 {
+		add("handle", "%d", c.Handle)
+	}
+	if c.Name != "" {
+		add("name", "%q", c.Name)
+	}
+	if c.NewName != "" {
+		add("newname", "%q", c.NewName)
+	}
+	if c.Flag != 0 {
+		add("flag", "%#x", c.Flag)
+	}
+	if c.Perm != 0 {
+		add("perm", "%v", c.Perm)
+	}
+	if c.Off != 0 {
+		add("off", "%d", c.Off)
+	}
+	if c.Whence != 0 {
+		add("whence", "%d", c.Whence)
+	}
+	if c.Count != 0 {
+		add("count", "%d", c.Count)
+	}
+	if c.UID != 0 {
+		add("uid", "%d", c.UID)
+	}
+	if c.GID != 0 {
+		add("gid", "%d", c.GID)
+	}
+	if c.Atime != 0 {
+		add("atime", "%v", time.Unix(0, c.Atime).UTC())
+	}
+	if c.Mtime != 0 {
+		add("mtime", "%v", time.Unix(0, c.Mtime).UTC())
+	}
+	if len(c.Data) > 0 {
+		add("data", "%s", traceData(c.Data, 0))
+	}
+	return fields
+}
+
+func (c *traceCall) String() string {
+	s := c.Op
+	for _, f := range c.fields() {
+		s += " " + f[0] + "=" + f[1]
+	}
+	return s
+}
+
+type traceFileInfo struct {
+	FName    string      `json:"name"`
+	FSize    int64       `json:"size"`
+	FMode    os.FileMode `json:"mode"`
+	FModTime time.Time   `json:"mtime"`
+}
+
+func newTraceFileInfo(fi os.FileInfo) *traceFileInfo {
+	return &traceFileInfo{FName: fi.Name(), FSize: fi.Size(), FMode: fi.Mode(), FModTime: fi.ModTime()}
+}
+
+func newTraceFileInfos(fis []os.FileInfo) []*traceFileInfo {
+	infos := make([]*traceFileInfo, 0, len(fis))
+	for _, fi := range fis {
+		infos = append(infos, newTraceFileInfo(fi))
+	}
+	return infos
+}
+
+func (fi *traceFileInfo) Name() string       { return fi.FName }
+func (fi *traceFileInfo) Size() int64        { return fi.FSize }
+func (fi *traceFileInfo) Mode() os.FileMode  { return fi.FMode }
+func (fi *traceFileInfo) ModTime() time.Time { return fi.FModTime }
+func (fi *traceFileInfo) IsDir() bool        { return fi.FMode.IsDir() }
+func (fi *traceFileInfo) Sys() interface{}   { return nil }
+
+// traceSentinels are the errors restored as themselves on replay, so that
+// comparing with them still works.
+var traceSentinels = []struct {
+	name string
+	err  error
+}{
+	{"io.EOF", io.EOF},
+	{"io.ErrUnexpectedEOF", io.ErrUnexpectedEOF},
+	{"io.ErrShortWrite", io.ErrShortWrite},
+	{"os.ErrNotExist", os.ErrNotExist},
+	{"os.ErrExist", os.ErrExist},
+	{"os.ErrPermission", os.ErrPermission},
+	{"os.ErrClosed", os.ErrClosed},
+	{"os.ErrInvalid", os.ErrInvalid},
+	{"afero.ErrFileClosed", ErrFileClosed},
+	{"afero.ErrOutOfRange", ErrOutOfRange},
+	{"afero.ErrTooLarge", ErrTooLarge},
+	{"mem.ErrReadOnlyHandle", mem.ErrReadOnlyHandle},
+	{"mem.ErrTooLarge", mem.ErrTooLarge},
+}
+
+// traceKinds are the kinds of errors kept on replay, as with errors.Is.
+var traceKinds = []error{os.ErrNotExist, os.ErrExist, os.ErrPermission, os.ErrClosed, os.ErrInvalid}
+
+// traceError is a recorded error. The *os.PathError or *os.LinkError
+// around it is kept, as well as what it was for errors.Is: a sentinel
+// error, a syscall.Errno or the kind of the error.
+type traceError struct {
+	Op       string `json:"op,omitempty"`
+	Path     string `json:"path,omitempty"`
+	NewPath  string `json:"newpath,omitempty"`
+	Link     bool   `json:"link,omitempty"`
+	Msg      string `json:"msg"`
+	Sentinel string `json:"sentinel,omitempty"`
+	Errno    int    `json:"errno,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+}
+
+func newTraceError(err error) *traceError {
+	if err == nil {
+		return nil
+	}
+	te := &traceError{}
+	cause := err
+	switch e := err.(type) {
+	case *os.PathError:
+		te.Op, te.Path, cause = e.Op, e.Path, e.Err
+	case *os.LinkError:
+		te.Link, te.Op, te.Path, te.NewPath, cause = true, e.Op, e.Old, e.New, e.Err
+	}
+	te.Msg = cause.Error()
+	for _, s := range traceSentinels {
+		if cause == s.err {
+			te.Sentinel = s.name
+			return te
+		}
+	}
+	var errno syscall.Errno
+	if errors.As(cause, &errno) {
+		te.Errno = int(errno)
+	}
+	for _, kind := range traceKinds {
+		if errors.Is(cause, kind) {
+			te.Kind = kind.Error()
+			break
+		}
+	}
+	return te
+}
+
+func (te *traceError) error() error {
+	if te == nil {
+		return nil
+	}
+	var cause error
+	for _, s := range traceSentinels {
+		if te.Sentinel == s.name {
+			cause = s.err
+		}
+	}
+	if cause == nil {
+		if te.Errno != 0 {
+			cause = syscall.Errno(te.Errno)
+		} else {
+			cause = errors.New(te.Msg)
+		}
+		for _, kind := range traceKinds {
+			if te.Kind == kind.Error() && !errors.Is(cause, kind) {
+				cause = WrapError(kind, cause)
+			}
+		}
+	}
+	switch {
+	case te.Link:
+		return &os.LinkError{Op: te.Op, Old: te.Path, New: te.NewPath, Err: cause}
+	case te.Op != "":
+		return &os.PathError{Op: te.Op, Path: te.Path, Err: cause}
+	}
+	return cause
+}
+
+// The RecordFs writes every call made to a source filesystem and to the
+// files opened through it, with its arguments and results, to a trace.
+// A ReplayFs can then serve the same session from the trace alone, for
+// example to run tests written against sftpfs or s3fs offline.
+//
+// The trace is written as one JSON object per call, in the order the calls
+// return. Files opened through a RecordFs cannot be locked, as it could
+// not be replayed.
+type RecordFs struct {
+	source Fs
+
+	mu      sync.Mutex
+	enc     *json.Encoder
+	handles int
+	err     error
+}
+
+func NewRecordFs(source Fs, trace io.Writer) *RecordFs {
+	return &RecordFs{source: source, enc: json.NewEncoder(trace)}
+}
+
+// Err returns the first error met writing the trace, if any.
+func (r *RecordFs) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *RecordFs) record(call *traceCall, err error) {
+	call.Res.Err = newTraceError(err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(call)
+	}
+}
+
+func (r *RecordFs) recordOpen(call *traceCall, f File, err error) (File, error) {
+	if err != nil {
+		r.record(call, err)
+		return nil, err
+	}
+	r.mu.Lock()
+	r.handles++
+	handle := r.handles
+	r.mu.Unlock()
+	call.Res.Handle, call.Res.Name = handle, f.Name()
+	r.record(call, nil)
+	return &RecordFile{File: f, fs: r, handle: handle}, nil
+}
+
+func (r *RecordFs) Name() string {
+	return "RecordFs"
+}
+
+func (r *RecordFs) Create(name string) (File, error) {
+	f, err := r.source.Create(name)
+	return r.recordOpen(&traceCall{Op: "Create", Name: name}, f, err)
+}
+
+func (r *RecordFs) Open(name string) (File, error) {
+	f, err := r.source.Open(name)
+	return r.recordOpen(&traceCall{Op: "Open", Name: name}, f, err)
+}
+
+func (r *RecordFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := r.source.OpenFile(name, flag, perm)
+	return r.recordOpen(&traceCall{Op: "OpenFile", Name: name, Flag: flag, Perm: perm}, f, err)
+}
+
+func (r *RecordFs) Mkdir(name string, perm os.FileMode) error {
+	err := r.source.Mkdir(name, perm)
+	r.record(&traceCall{Op: "Mkdir", Name: name, Perm: perm}, err)
+	return err
+}
+
+func (r *RecordFs) MkdirAll(path string, perm os.FileMode) error {
+	err := r.source.MkdirAll(path, perm)
+	r.record(&traceCall{Op: "MkdirAll", Name: path, Perm: perm}, err)
+	return err
+}
+
+func (r *RecordFs) Remove(name string) error {
+	err := r.source.Remove(name)
+	r.record(&traceCall{Op: "Remove", Name: name}, err)
+	return err
+}
+
+func (r *RecordFs) RemoveAll(path string) error {
+	err := r.source.RemoveAll(path)
+	r.record(&traceCall{Op: "RemoveAll", Name: path}, err)
+	return err
+}
+
+func (r *RecordFs) Rename(oldname, newname string) error {
+	err := r.source.Rename(oldname, newname)
+	r.record(&traceCall{Op: "Rename", Name: oldname, NewName: newname}, err)
+	return err
+}
+
+func (r *RecordFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := r.source.Stat(name)
+	call := &traceCall{Op: "Stat", Name: name}
+	if err == nil {
+		call.Res.Infos = []*traceFileInfo{newTraceFileInfo(fi)}
+	}
+	r.record(call, err)
+	return fi, err
+}
+
+func (r *RecordFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	var fi os.FileInfo
+	var lstat bool
+	var err error
+	if lstater, ok := r.source.(Lstater); ok {
+		fi, lstat, err = lstater.LstatIfPossible(name)
+	} else {
+		fi, err = r.source.Stat(name)
+	}
+	call := &traceCall{Op: "Lstat", Name: name}
+	call.Res.Lstat = lstat
+	if err == nil {
+		call.Res.Infos = []*traceFileInfo{newTraceFileInfo(fi)}
+	}
+	r.record(call, err)
+	return fi, lstat, err
+}
+
+func (r *RecordFs) Chmod(name string, mode os.FileMode) error {
+	err := r.source.Chmod(name, mode)
+	r.record(&traceCall{Op: "Chmod", Name: name, Perm: mode}, err)
+	return err
+}
+
+func (r *RecordFs) Chown(name string, uid, gid int) error {
+	err := r.source.Chown(name, uid, gid)
+	r.record(&traceCall{Op: "Chown", Name: name, UID: uid, GID: gid}, err)
+	return err
+}
+
+func (r *RecordFs) Chtimes(name string, atime, mtime time.Time) error {
+	err := r.source.Chtimes(name, atime, mtime)
+	r.record(&traceCall{Op: "Chtimes", Name: name, Atime: atime.UnixNano(), Mtime: mtime.UnixNano()}, err)
+	return err
+}
+
+// RecordFile is a file opened through a RecordFs.
+type RecordFile struct {
+	File
+	fs     *RecordFs
+	handle int
+}
+
+func (f *RecordFile) Close() error {
+	err := f.File.Close()
+	f.fs.record(&traceCall{Op: "Close", Handle: f.handle}, err)
+	return err
+}
+
+func (f *RecordFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	call := &traceCall{Op: "Read", Handle: f.handle, Count: len(p)}
+	call.Res.Data = append([]byte(nil), p[:n]...)
+	f.fs.record(call, err)
+	return n, err
+}
+
+func (f *RecordFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	call := &traceCall{Op: "ReadAt", Handle: f.handle, Count: len(p), Off: off}
+	call.Res.Data = append([]byte(nil), p[:n]...)
+	f.fs.record(call, err)
+	return n, err
+}
+
+func (f *RecordFile) Seek(offset int64, whence int) (int64, error) {
+	ret, err := f.File.Seek(offset, whence)
+	call := &traceCall{Op: "Seek", Handle: f.handle, Off: offset, Whence: whence}
+	call.Res.N = ret
+	f.fs.record(call, err)
+	return ret, err
+}
+
+func (f *RecordFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	call := &traceCall{Op: "Write", Handle: f.handle, Data: append([]byte{}, p...)}
+	call.Res.N = int64(n)
+	f.fs.record(call, err)
+	return n, err
+}
+
+func (f *RecordFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	call := &traceCall{Op: "WriteAt", Handle: f.handle, Off: off, Data: append([]byte{}, p...)}
+	call.Res.N = int64(n)
+	f.fs.record(call, err)
+	return n, err
+}
+
+func (f *RecordFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *RecordFile) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := f.File.Readdir(count)
+	call := &traceCall{Op: "Readdir", Handle: f.handle, Count: count}
+	call.Res.Infos = newTraceFileInfos(fis)
+	f.fs.record(call, err)
+	return fis, err
+}
+
+func (f *RecordFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	call := &traceCall{Op: "Readdirnames", Handle: f.handle, Count: n}
+	call.Res.Names = names
+	f.fs.record(call, err)
+	return names, err
+}
+
+func (f *RecordFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	call := &traceCall{Op: "Stat", Handle: f.handle}
+	if err == nil {
+		call.Res.Infos = []*traceFileInfo{newTraceFileInfo(fi)}
+	}
+	f.fs.record(call, err)
+	return fi, err
+}
+
+func (f *RecordFile) Sync() error {
+	err := f.File.Sync()
+	f.fs.record(&traceCall{Op: "Sync", Handle: f.handle}, err)
+	return err
+}
+
+func (f *RecordFile) Truncate(size int64) error {
+	err := f.File.Truncate(size)
+	f.fs.record(&traceCall{Op: "Truncate", Handle: f.handle, Off: size}, err)
+	return err
+}
+
+// ReplayError is the error wrapped in an *os.PathError by the calls to a
+// ReplayFs not matching the trace, and by all the calls after them.
+type ReplayError struct {
+	// Index is the position of the call in the trace, from 0.
+	Index int
+
+	want *traceCall // nil at the end of the trace
+	got  *traceCall // nil if calls are missing
+}
+
+// Error describes the divergence as a diff of the expected call (-) and
+// the one made (+), followed by the arguments which differ.
+func (e *ReplayError) Error() string {
+	want, got := "<end of trace>", "<no more calls>"
+	if e.want != nil {
+		want = e.want.String()
+	}
+	if e.got != nil {
+		got = e.got.String()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "replay diverged from the trace at call %d:\n- %s\n+ %s", e.Index, want, got)
+	if e.want != nil && e.got != nil {
+		for _, d := range traceDiff(e.want, e.got) {
+			fmt.Fprintf(&b, "\n  %s: %s != %s", d[0], d[1], d[2])
+		}
+	}
+	return b.String()
+}
+
+// traceDiff returns the arguments differing between two calls, as the name,
+// the expected and the actual value.
+func traceDiff(want, got *traceCall) [][3]string {
+	var diff [][3]string
+	if want.Op != got.Op {
+		diff = append(diff, [3]string{"op", want.Op, got.Op})
+	}
+	wf, gf := want.fields(), got.fields()
+	values := func(fields [][2]string) map[string]string {
+		m := make(map[string]string, len(fields))
+		for _, f := range fields {
+			m[f[0]] = f[1]
+		}
+		return m
+	}
+	wv, gv := values(wf), values(gf)
+	seen := map[string]bool{"data": true}
+	for _, f := range append(wf, gf...) {
+		key := f[0]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		w, ok := wv[key]
+		if !ok {
+			w = "<unset>"
+		}
+		g, ok := gv[key]
+		if !ok {
+			g = "<unset>"
+		}
+		if w != g {
+			diff = append(diff, [3]string{key, w, g})
+		}
+	}
+	if !bytes.Equal(want.Data, got.Data) {
+		// Show both from a little before the first difference.
+		i := 0
+		for i < len(want.Data) && i < len(got.Data) && want.Data[i] == got.Data[i] {
+			i++
+		}
+		if i -= 16; i < 0 {
+			i = 0
+		}
+		diff = append(diff, [3]string{"data", traceData(want.Data, i), traceData(got.Data, i)})
+	}
+	return diff
+}
+
+// The ReplayFs serves the calls recorded by a RecordFs from the trace,
+// without the filesystem they were made on. The calls must be made in the
+// same order and with the same arguments as when recording; the first one
+// which is not fails with a *ReplayError, and so do all the next ones.
+type ReplayFs struct {
+	mu    sync.Mutex
+	calls []*traceCall
+	next  int
+	err   *ReplayError
+}
+
+// NewReplayFs reads a trace written by a RecordFs.
+func NewReplayFs(trace io.Reader) (*ReplayFs, error) {
+	r := &ReplayFs{}
+	dec := json.NewDecoder(trace)
+	for {
+		call := &traceCall{}
+		if err := dec.Decode(call); err == io.EOF {
+			return r, nil
+		} else if err != nil {
+			return nil, err
+		}
+		r.calls = append(r.calls, call)
+	}
+}
+
+// Done returns an error if the replay diverged from the trace or did not
+// make all the calls of the trace.
+func (r *ReplayFs) Done() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	if r.next < len(r.calls) {
+		return &ReplayError{Index: r.next, want: r.calls[r.next]}
+	}
+	return nil
+}
+
+// replay returns the results of a call, or a *os.PathError wrapping a
+// *ReplayError if it does not match the trace.
+func (r *ReplayFs) replay(got *traceCall) (*traceResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		if r.next >= len(r.calls) {
+			r.err = &ReplayError{Index: r.next, got: got}
+		} else if want := r.calls[r.next]; len(traceDiff(want, got)) > 0 {
+			r.err = &ReplayError{Index: r.next, want: want, got: got}
+		}
+	}
+	if r.err != nil {
+		return nil, &os.PathError{Op: methodErrorOp(got.Op), Path: got.Name, Err: r.err}
+	}
+	r.next++
+	return &r.calls[r.next-1].Res, nil
+}
+
+func (r *ReplayFs) replayErr(call *traceCall) error {
+	res, err := r.replay(call)
+	if err != nil {
+		return err
+	}
+	return res.Err.error()
+}
+
+func (r *ReplayFs) replayInfo(call *traceCall) (os.FileInfo, error) {
+	res, err := r.replay(call)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Infos) == 0 {
+		return nil, res.Err.error()
+	}
+	return res.Infos[0], res.Err.error()
+}
+
+func (r *ReplayFs) replayOpen(call *traceCall) (File, error) {
+	res, err := r.replay(call)
+	if err != nil {
+		return nil, err
+	}
+	if res.Err != nil {
+		return nil, res.Err.error()
+	}
+	return &ReplayFile{fs: r, handle: res.Handle, name: res.Name}, nil
+}
+
+func (r *ReplayFs) Name() string {
+	return "ReplayFs"
+}
+
+func (r *ReplayFs) Create(name string) (File, error) {
+	return r.replayOpen(&traceCall{Op: "Create", Name: name})
+}
+
+func (r *ReplayFs) Open(name string) (File, error) {
+	return r.replayOpen(&traceCall{Op: "Open", Name: name})
+}
+
+func (r *ReplayFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return r.replayOpen(&traceCall{Op: "OpenFile", Name: name, Flag: flag, Perm: perm})
+}
+
+func (r *ReplayFs) Mkdir(name string, perm os.FileMode) error {
+	return r.replayErr(&traceCall{Op: "Mkdir", Name: name, Perm: perm})
+}
+
+func (r *ReplayFs) MkdirAll(path string, perm os.FileMode) error {
+	return r.replayErr(&traceCall{Op: "MkdirAll", Name: path, Perm: perm})
+}
+
+func (r *ReplayFs) Remove(name string) error {
+	return r.replayErr(&traceCall{Op: "Remove", Name: name})
+}
+
+func (r *ReplayFs) RemoveAll(path string) error {
+	return r.replayErr(&traceCall{Op: "RemoveAll", Name: path})
+}
+
+func (r *ReplayFs) Rename(oldname, newname string) error {
+	return r.replayErr(&traceCall{Op: "Rename", Name: oldname, NewName: newname})
+}
+
+func (r *ReplayFs) Stat(name string) (os.FileInfo, error) {
+	return r.replayInfo(&traceCall{Op: "Stat", Name: name})
+}
+
+func (r *ReplayFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	res, err := r.replay(&traceCall{Op: "Lstat", Name: name})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res.Infos) == 0 {
+		return nil, res.Lstat, res.Err.error()
+	}
+	return res.Infos[0], res.Lstat, res.Err.error()
+}
+
+func (r *ReplayFs) Chmod(name string, mode os.FileMode) error {
+	return r.replayErr(&traceCall{Op: "Chmod", Name: name, Perm: mode})
+}
+
+func (r *ReplayFs) Chown(name string, uid, gid int) error {
+	return r.replayErr(&traceCall{Op: "Chown", Name: name, UID: uid, GID: gid})
+}
+
+func (r *ReplayFs) Chtimes(name string, atime, mtime time.Time) error {
+	return r.replayErr(&traceCall{Op: "Chtimes", Name: name, Atime: atime.UnixNano(), Mtime: mtime.UnixNano()})
+}
+
+// ReplayFile is a file opened through a ReplayFs.
+type ReplayFile struct {
+	fs     *ReplayFs
+	handle int
+	name   string
+}
+
+func (f *ReplayFile) call(op string) *traceCall {
+	return &traceCall{Op: op, Handle: f.handle}
+}
+
+func (f *ReplayFile) Name() string {
+	return f.name
+}
+
+func (f *ReplayFile) Close() error {
+	return f.fs.replayErr(f.call("Close"))
+}
+
+func (f *ReplayFile) Read(p []byte) (int, error) {
+	call := f.call("Read")
+	call.Count = len(p)
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, res.Data), res.Err.error()
+}
+
+func (f *ReplayFile) ReadAt(p []byte, off int64) (int, error) {
+	call := f.call("ReadAt")
+	call.Count, call.Off = len(p), off
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, res.Data), res.Err.error()
+}
+
+func (f *ReplayFile) Seek(offset int64, whence int) (int64, error) {
+	call := f.call("Seek")
+	call.Off, call.Whence = offset, whence
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return 0, err
+	}
+	return res.N, res.Err.error()
+}
+
+func (f *ReplayFile) Write(p []byte) (int, error) {
+	call := f.call("Write")
+	call.Data = p
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.N), res.Err.error()
+}
+
+func (f *ReplayFile) WriteAt(p []byte, off int64) (int, error) {
+	call := f.call("WriteAt")
+	call.Off, call.Data = off, p
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.N), res.Err.error()
+}
+
+func (f *ReplayFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *ReplayFile) Readdir(count int) ([]os.FileInfo, error) {
+	call := f.call("Readdir")
+	call.Count = count
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return nil, err
+	}
+	fis := make([]os.FileInfo, 0, len(res.Infos))
+	for _, fi := range res.Infos {
+		fis = append(fis, fi)
+	}
+	return fis, res.Err.error()
+}
+
+func (f *ReplayFile) Readdirnames(n int) ([]string, error) {
+	call := f.call("Readdirnames")
+	call.Count = n
+	res, err := f.fs.replay(call)
+	if err != nil {
+		return nil, err
+	}
+	return res.Names, res.Err.error()
+}
+
+func (f *ReplayFile) Stat() (os.FileInfo, error) {
+	return f.fs.replayInfo(f.call("Stat"))
+}
+
+func (f *ReplayFile) Sync() error {
+	return f.fs.replayErr(f.call("Sync"))
+}
+
+func (f *ReplayFile) Truncate(size int64) error {
+	call := f.call("Truncate")
+	call.Off = size
+	return f.fs.replayErr(call)
+}
@@ -0,0 +1,144 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordSession runs the same calls against fs, and returns what they
+// observed.
+func recordSession(t *testing.T, fs Fs) []interface{} {
+	t.Helper()
+	var seen []interface{}
+	see := func(v ...interface{}) { seen = append(seen, v...) }
+
+	see(fs.MkdirAll("/dir/sub", 0755))
+	see(WriteFile(fs, "/dir/a.txt", []byte("hello, world"), 0644))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	see(fs.Chtimes("/dir/a.txt", mtime, mtime))
+
+	f, err := fs.OpenFile("/dir/a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	see(f.Name())
+	buf := make([]byte, 5)
+	n, err := f.Read(buf)
+	see(n, err, string(buf[:n]))
+	see(f.Seek(-5, io.SeekEnd))
+	see(f.WriteAt([]byte("WORLD"), 7))
+	n, err = f.ReadAt(buf, 10)
+	see(n, err == io.EOF, string(buf[:n]))
+	fi, err := f.Stat()
+	see(fi.Name(), fi.Size(), fi.Mode(), fi.ModTime().Equal(mtime), err)
+	see(f.Close())
+	see(f.Close() != nil)
+
+	_, err = fs.Stat("/missing")
+	see(os.IsNotExist(err))
+	_, err = fs.Open("/missing")
+	see(errors.Is(err, os.ErrNotExist))
+	see(fs.Rename("/dir/a.txt", "/dir/sub/b.txt"))
+
+	d, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := d.Readdirnames(-1)
+	see(names, err)
+	see(d.Close())
+	data, err := ReadFile(fs, "/dir/sub/b.txt")
+	see(string(data), err)
+	return seen
+}
+
+func TestRecordReplay(t *testing.T) {
+	var trace bytes.Buffer
+	rec := NewRecordFs(&MemMapFs{}, &trace)
+	recorded := recordSession(t, rec)
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayFs(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := recordSession(t, replay)
+	if err := replay.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replay differs from the recording:\n%v\n%v", recorded, replayed)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	var trace bytes.Buffer
+	rec := NewRecordFs(&MemMapFs{}, &trace)
+	WriteFile(rec, "/a", []byte(strings.Repeat("x", 100)), 0644)
+	rec.Remove("/a")
+
+	replay, err := NewReplayFs(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFile(replay, "/a", []byte(strings.Repeat("x", 90)+"y"+strings.Repeat("x", 9)), 0644)
+	var rerr *ReplayError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected a ReplayError, got %v", err)
+	}
+	msg := rerr.Error()
+	for _, want := range []string{"at call 1:", "- Write handle=1 data=", "+ Write handle=1 data=", "data: @74:\"xxxxxxxxxxxxxxxxxxxxxxxxxx\"", "@74:\"xxxxxxxxxxxxxxxxyxxxxxxxxx\""} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in the divergence report:\n%s", want, msg)
+		}
+	}
+	if err := replay.Remove("/a"); !errors.As(err, &rerr) {
+		t.Errorf("expected the calls after a divergence to fail, got %v", err)
+	}
+	if replay.Done() == nil {
+		t.Error("expected Done to report the divergence")
+	}
+
+	replay, _ = NewReplayFs(bytes.NewReader(trace.Bytes()))
+	WriteFile(replay, "/a", []byte(strings.Repeat("x", 100)), 0644)
+	err = replay.Done()
+	if err == nil || !strings.Contains(err.Error(), "- Remove name=\"/a\"\n+ <no more calls>") {
+		t.Errorf("expected Done to report the missing calls, got %v", err)
+	}
+	replay.Remove("/a")
+	if err := replay.Remove("/a"); err == nil || !strings.Contains(err.Error(), "- <end of trace>") {
+		t.Errorf("expected calls past the trace to fail, got %v", err)
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+	errs := []error{
+		io.EOF,
+		&os.PathError{Op: "open", Path: "/a", Err: os.ErrNotExist},
+		&os.PathError{Op: "write", Path: "/a", Err: ErrReadOnly},
+		&os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: ErrNotSupported},
+		errors.New("something else"),
+	}
+	for _, err := range errs {
+		got := newTraceError(err).error()
+		if got.Error() != err.Error() {
+			t.Errorf("expected %q, got %q", err, got)
+		}
+		for _, kind := range append(traceKinds, io.EOF) {
+			if errors.Is(got, kind) != errors.Is(err, kind) {
+				t.Errorf("%v: expected errors.Is(%v) to be %t", err, kind, errors.Is(err, kind))
+			}
+		}
+	}
+	if newTraceError(io.EOF).error() != io.EOF {
+		t.Error("expected io.EOF to be restored as itself")
+	}
+}
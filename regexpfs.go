@@ -1,6 +1,8 @@
 package afero
 
 import (
+	"context"
+	"io"
 	"os"
 	"regexp"
 	"syscall"
@@ -25,17 +27,17 @@ type RegexpFile struct {
 	re *regexp.Regexp
 }
 
-func (r *RegexpFs) matchesName(name string) error {
+func (r *RegexpFs) matchesName(op, name string) error {
 	if r.re == nil {
 		return nil
 	}
 	if r.re.MatchString(name) {
 		return nil
 	}
-	return syscall.ENOENT
+	return &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
 }
 
-func (r *RegexpFs) dirOrMatches(name string) error {
+func (r *RegexpFs) dirOrMatches(op, name string) error {
 	dir, err := IsDir(r.source, name)
 	if err != nil {
 		return err
@@ -43,25 +45,25 @@ func (r *RegexpFs) dirOrMatches(name string) error {
 	if dir {
 		return nil
 	}
-	return r.matchesName(name)
+	return r.matchesName(op, name)
 }
 
 func (r *RegexpFs) Chtimes(name string, a, m time.Time) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("chtimes", name); err != nil {
 		return err
 	}
 	return r.source.Chtimes(name, a, m)
 }
 
 func (r *RegexpFs) Chmod(name string, mode os.FileMode) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("chmod", name); err != nil {
 		return err
 	}
 	return r.source.Chmod(name, mode)
 }
 
 func (r *RegexpFs) Chown(name string, uid, gid int) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("chown", name); err != nil {
 		return err
 	}
 	return r.source.Chown(name, uid, gid)
@@ -72,7 +74,7 @@ func (r *RegexpFs) Name() string {
 }
 
 func (r *RegexpFs) Stat(name string) (os.FileInfo, error) {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("stat", name); err != nil {
 		return nil, err
 	}
 	return r.source.Stat(name)
@@ -86,11 +88,8 @@ func (r *RegexpFs) Rename(oldname, newname string) error {
 	if dir {
 		return nil
 	}
-	if err := r.matchesName(oldname); err != nil {
-		return err
-	}
-	if err := r.matchesName(newname); err != nil {
-		return err
+	if r.matchesName("rename", oldname) != nil || r.matchesName("rename", newname) != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOENT}
 	}
 	return r.source.Rename(oldname, newname)
 }
@@ -101,7 +100,7 @@ func (r *RegexpFs) RemoveAll(p string) error {
 		return err
 	}
 	if !dir {
-		if err := r.matchesName(p); err != nil {
+		if err := r.matchesName("remove_all", p); err != nil {
 			return err
 		}
 	}
@@ -109,14 +108,14 @@ func (r *RegexpFs) RemoveAll(p string) error {
 }
 
 func (r *RegexpFs) Remove(name string) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("remove", name); err != nil {
 		return err
 	}
 	return r.source.Remove(name)
 }
 
 func (r *RegexpFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("open", name); err != nil {
 		return nil, err
 	}
 	return r.source.OpenFile(name, flag, perm)
@@ -128,7 +127,7 @@ func (r *RegexpFs) Open(name string) (File, error) {
 		return nil, err
 	}
 	if !dir {
-		if err := r.matchesName(name); err != nil {
+		if err := r.matchesName("open", name); err != nil {
 			return nil, err
 		}
 	}
@@ -148,12 +147,93 @@ func (r *RegexpFs) MkdirAll(n string, p os.FileMode) error {
 }
 
 func (r *RegexpFs) Create(name string) (File, error) {
-	if err := r.matchesName(name); err != nil {
+	if err := r.matchesName("create", name); err != nil {
 		return nil, err
 	}
 	return r.source.Create(name)
 }
 
+func (r *RegexpFs) GetXattr(name, attr string) ([]byte, error) {
+	if err := r.dirOrMatches("getxattr", name); err != nil {
+		return nil, err
+	}
+	if x, ok := r.source.(Xattrer); ok {
+		return x.GetXattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (r *RegexpFs) SetXattr(name, attr string, value []byte) error {
+	if err := r.dirOrMatches("setxattr", name); err != nil {
+		return err
+	}
+	if x, ok := r.source.(Xattrer); ok {
+		return x.SetXattr(name, attr, value)
+	}
+	return &os.PathError{Op: "setxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (r *RegexpFs) ListXattr(name string) ([]string, error) {
+	if err := r.dirOrMatches("listxattr", name); err != nil {
+		return nil, err
+	}
+	if x, ok := r.source.(Xattrer); ok {
+		return x.ListXattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrNoXattr}
+}
+
+func (r *RegexpFs) RemoveXattr(name, attr string) error {
+	if err := r.dirOrMatches("removexattr", name); err != nil {
+		return err
+	}
+	if x, ok := r.source.(Xattrer); ok {
+		return x.RemoveXattr(name, attr)
+	}
+	return &os.PathError{Op: "removexattr", Path: name, Err: ErrNoXattr}
+}
+
+func (r *RegexpFs) Statfs(name string) (*FsStats, error) {
+	if err := r.dirOrMatches("statfs", name); err != nil {
+		return nil, err
+	}
+	return statfsIfPossible(r.source, name)
+}
+
+// WriteReaderAtomic replaces name through the source filesystem, as the
+// name of the temporary file does not necessarily match the filter.
+func (r *RegexpFs) WriteReaderAtomic(name string, rd io.Reader, perm os.FileMode) error {
+	if err := r.matchesName("write", name); err != nil {
+		return err
+	}
+	return WriteReaderAtomic(r.source, name, rd, perm)
+}
+
+// Watch delivers only the events of directories and of files matching the
+// regular expression. As a removed entry cannot be checked for being a
+// directory any more, its Remove and Rename events are only delivered if
+// its name matches.
+func (r *RegexpFs) Watch(name string, recursive bool) (Watch, error) {
+	if err := r.dirOrMatches("watch", name); err != nil {
+		return nil, err
+	}
+	watcher, ok := r.source.(Watcher)
+	if !ok {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: ErrNoWatch}
+	}
+	w, err := watcher.Watch(name, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return newFilteredWatch(func(ev Event) (Event, bool) {
+		if r.matchesName("watch", ev.Name) == nil {
+			return ev, true
+		}
+		dir, _ := IsDir(r.source, ev.Name)
+		return ev, dir
+	}, w), nil
+}
+
 func (f *RegexpFile) Close() error {
 	return f.f.Close()
 }
@@ -222,3 +302,15 @@ func (f *RegexpFile) Truncate(s int64) error {
 func (f *RegexpFile) WriteString(s string) (int, error) {
 	return f.f.WriteString(s)
 }
+
+func (f *RegexpFile) Lock(ctx context.Context, exclusive bool) error {
+	return LockFile(ctx, f.f, exclusive)
+}
+
+func (f *RegexpFile) TryLock(exclusive bool) error {
+	return TryLockFile(f.f, exclusive)
+}
+
+func (f *RegexpFile) Unlock() error {
+	return UnlockFile(f.f)
+}
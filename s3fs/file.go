@@ -2,13 +2,15 @@ package s3fs
 
 import (
 	"bytes"
-	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/spf13/afero"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -96,7 +98,7 @@ func (f *S3File) Close() error {
 // array, may return an error if no io.Reader is present.
 func (f *S3File) Read(p []byte) (n int, err error) {
 	if f.s3ObjectOutput == nil {
-		return 0, fmt.Errorf("Cannot read")
+		return 0, &os.PathError{Op: "read", Path: f.key, Err: syscall.EISDIR}
 	}
 	f.m.RLock()
 	defer f.m.RUnlock()
@@ -105,19 +107,19 @@ func (f *S3File) Read(p []byte) (n int, err error) {
 
 // ReadAt unsupported
 func (f *S3File) ReadAt(p []byte, off int64) (n int, err error) {
-	return 0, nil
+	return 0, &os.PathError{Op: "read", Path: f.key, Err: afero.ErrNotSupported}
 }
 
 // Seek unsupported
 func (f *S3File) Seek(offset int64, whence int) (int64, error) {
-	return 0, fmt.Errorf("Not supported")
+	return 0, &os.PathError{Op: "seek", Path: f.key, Err: afero.ErrNotSupported}
 }
 
 // Readdir returns a slice of S3FileInfo limiting the number of results based
 // on count value. Can return error if no underlying *s3.GetObjectOutput is set.
 func (f *S3File) Readdir(count int) ([]os.FileInfo, error) {
 	if f.s3ObjectOutput == nil {
-		return nil, fmt.Errorf("Cannot read directory")
+		return nil, &os.PathError{Op: "readdir", Path: f.key, Err: syscall.ENOTDIR}
 	}
 	var (
 		continuationToken *string
@@ -133,7 +135,7 @@ func (f *S3File) Readdir(count int) ([]os.FileInfo, error) {
 		})
 
 		if err != nil {
-			return nil, err
+			return nil, pathError("readdir", f.key, err)
 		}
 
 		for _, object := range listObjectsV2Output.Contents {
@@ -189,7 +191,7 @@ func (f *S3File) Write(p []byte) (n int, err error) {
 		Body:   aws.ReadSeekCloser(buf),
 	})
 	if err != nil {
-		return
+		return 0, pathError("write", f.key, err)
 	}
 	n = len(p)
 	return
@@ -197,7 +199,7 @@ func (f *S3File) Write(p []byte) (n int, err error) {
 
 // WriteAt unsupported
 func (f *S3File) WriteAt(b []byte, off int64) (n int, err error) {
-	return 0, nil
+	return 0, &os.PathError{Op: "write", Path: f.key, Err: afero.ErrNotSupported}
 }
 
 // WriteString convenient way to write a string using the Write function
@@ -207,5 +209,5 @@ func (f *S3File) WriteString(s string) (ret int, err error) {
 
 // Truncate unsupported
 func (f *S3File) Truncate(size int64) error {
-	return nil
+	return &os.PathError{Op: "truncate", Path: f.key, Err: afero.ErrNotSupported}
 }
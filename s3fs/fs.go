@@ -2,7 +2,8 @@ package s3fs
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/spf13/afero"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -29,6 +31,11 @@ type s3api interface {
 	ListObjectsV2(*s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
 }
 
+var (
+	_ afero.Fs           = (*S3Fs)(nil)
+	_ afero.AtomicWriter = (*S3Fs)(nil)
+)
+
 // S3Fs implements afero.Fs
 type S3Fs struct {
 	s3Api  s3api
@@ -64,7 +71,7 @@ func (s *S3Fs) Create(name string) (afero.File, error) {
 		Body:   aws.ReadSeekCloser(bytes.NewBuffer([]byte{})),
 	})
 	if err != nil {
-		return nil, err
+		return nil, pathError("create", name, err)
 	}
 
 	return s.Open(name)
@@ -77,10 +84,10 @@ func (s *S3Fs) Open(name string) (afero.File, error) {
 		Key:    aws.String(strings.TrimLeft(name, "/")),
 	})
 	if err != nil {
-		return nil, err
+		return nil, pathError("open", name, err)
 	}
 	if aws.BoolValue(getObjectOutput.DeleteMarker) {
-		return nil, fmt.Errorf("File is marked as deleted")
+		return nil, &os.PathError{Op: "open", Path: name, Err: errDeleteMarker}
 	}
 
 	return &S3File{
@@ -111,7 +118,10 @@ func (s *S3Fs) MkdirAll(name string, perm os.FileMode) error {
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(name),
 	})
-	return err
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
 }
 
 // Remove removes a file identified by name, returning an error, if any
@@ -128,12 +138,11 @@ func (s *S3Fs) RemoveAll(name string) error {
 		Prefix: aws.String(strings.TrimLeft(name, "/")),
 	})
 	if err != nil {
-		return err
+		return pathError("remove_all", name, err)
 	}
 	if len(listObject.Contents) == 0 {
-		return fmt.Errorf("No objects")
+		return nil
 	}
-	fmt.Printf("#%v", listObject.Contents)
 	objectIds := make([]*s3.ObjectIdentifier, len(listObject.Contents))
 	for i, object := range listObject.Contents {
 		objectIds[i] = &s3.ObjectIdentifier{Key: object.Key}
@@ -144,7 +153,10 @@ func (s *S3Fs) RemoveAll(name string) error {
 			Objects: objectIds,
 		},
 	})
-	return err
+	if err != nil {
+		return pathError("remove_all", name, err)
+	}
+	return nil
 }
 
 // Rename renames a file. Under the hood what it does is create a copy of the
@@ -158,20 +170,42 @@ func (s *S3Fs) Rename(oldname, newname string) error {
 		Key:        aws.String(newname),
 	})
 	if err != nil {
-		return err
+		return linkError("rename", oldname, newname, err)
 	}
 	_, err = s.s3Api.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(oldname),
 	})
 	if err != nil {
-		return err
+		return linkError("rename", oldname, newname, err)
 	}
 	err = s.s3Api.WaitUntilObjectExists(&s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(newname),
 	})
-	return err
+	if err != nil {
+		return linkError("rename", oldname, newname, err)
+	}
+	return nil
+}
+
+// WriteReaderAtomic uploads the content read from r in a single PUT, which
+// S3 applies atomically, instead of going through Rename, which copies the
+// object and is not atomic. S3 objects have no mode, so perm is ignored.
+func (s *S3Fs) WriteReaderAtomic(name string, r io.Reader, perm os.FileMode) error {
+	data, err := afero.ReadAll(r)
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	_, err = s.s3Api.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(strings.TrimLeft(name, "/")),
+		Body:   aws.ReadSeekCloser(bytes.NewReader(data)),
+	})
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	return nil
 }
 
 // Stat returns a FileInfo describing the named file, or an error, if any
@@ -182,7 +216,7 @@ func (s *S3Fs) Stat(name string) (os.FileInfo, error) {
 		Key:    aws.String(name),
 	})
 	if err != nil {
-		return nil, err
+		return nil, pathError("stat", name, err)
 	}
 	file := &S3File{
 		s3Api:          s.s3Api,
@@ -199,7 +233,7 @@ func (s *S3Fs) Chmod(name string, mode os.FileMode) error {
 }
 
 // Chown unsupported
-func (s *S3Fs) Chown(name string, mode os.FileMode) error {
+func (s *S3Fs) Chown(name string, uid, gid int) error {
 	return nil
 }
 
@@ -207,3 +241,32 @@ func (s *S3Fs) Chown(name string, mode os.FileMode) error {
 func (s *S3Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	return nil
 }
+
+// errDeleteMarker is returned when the latest version of an object is a
+// delete marker, which S3 treats as the object not existing.
+var errDeleteMarker = afero.WrapError(os.ErrNotExist, errors.New("file is marked as deleted"))
+
+// translateError attaches the os sentinel matching the error code of an S3
+// API error, so callers can use errors.Is with os.ErrNotExist and
+// os.ErrPermission. The original awserr.Error is kept in the chain.
+func translateError(err error) error {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NotFound":
+		return afero.WrapError(os.ErrNotExist, err)
+	case "AccessDenied", "Forbidden":
+		return afero.WrapError(os.ErrPermission, err)
+	}
+	return err
+}
+
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: translateError(err)}
+}
+
+func linkError(op, oldname, newname string, err error) error {
+	return &os.LinkError{Op: op, Old: oldname, New: newname, Err: translateError(err)}
+}
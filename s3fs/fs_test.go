@@ -3,14 +3,19 @@ package s3fs
 import (
 	"errors"
 	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 var (
-	errBucketNotFound = errors.New("bucket not found")
-	errKeyNotFound    = errors.New("Key not found")
+	errBucketNotFound = awserr.New(s3.ErrCodeNoSuchBucket, "bucket not found", nil)
+	errKeyNotFound    = awserr.New(s3.ErrCodeNoSuchKey, "Key not found", nil)
 )
 
 type fakeS3Api struct {
@@ -97,3 +102,37 @@ func (f *fakeS3Api) ListObjectsV2(v2input *s3.ListObjectsV2Input) (*s3.ListObjec
 	}
 	return &s3.ListObjectsV2Output{Contents: objects, IsTruncated: aws.Bool(true)}, nil
 }
+
+func TestOpenNotExist(t *testing.T) {
+	fs := New("test-bucket", newFakeS3Api())
+	_, err := fs.Open("/missing")
+	if _, ok := err.(*os.PathError); !ok {
+		t.Fatalf("Open: expected *os.PathError, got %T", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open: expected os.ErrNotExist, got %v", err)
+	}
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != s3.ErrCodeNoSuchBucket {
+		t.Errorf("Open: expected the S3 error to be wrapped, got %v", err)
+	}
+}
+
+func TestWriteReaderAtomic(t *testing.T) {
+	api := newFakeS3Api()
+	fs := New("test-bucket", api)
+	if err := afero.WriteFileAtomic(fs, "/state.json", []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bucket := api.content["test-bucket"]
+	if len(bucket) != 1 {
+		t.Fatalf("expected a single object without temporary copies, got %d", len(bucket))
+	}
+	data, err := afero.ReadAll(bucket["state.json"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{}" {
+		t.Errorf("unexpected content %q", data)
+	}
+}
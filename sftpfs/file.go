@@ -25,7 +25,7 @@ type File struct {
 func FileOpen(s *sftp.Client, name string) (*File, error) {
 	fd, err := s.Open(name)
 	if err != nil {
-		return &File{}, err
+		return nil, pathError("open", name, err)
 	}
 	return &File{fd: fd}, nil
 }
@@ -33,7 +33,7 @@ func FileOpen(s *sftp.Client, name string) (*File, error) {
 func FileCreate(s *sftp.Client, name string) (*File, error) {
 	fd, err := s.Create(name)
 	if err != nil {
-		return &File{}, err
+		return nil, pathError("create", name, err)
 	}
 	return &File{fd: fd}, nil
 }
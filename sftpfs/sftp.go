@@ -14,7 +14,9 @@
 package sftpfs
 
 import (
+	"io"
 	"os"
+	"path"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -36,15 +38,19 @@ func New(client *sftp.Client) afero.Fs {
 func (s Fs) Name() string { return "sftpfs" }
 
 func (s Fs) Create(name string) (afero.File, error) {
-	return FileCreate(s.client, name)
+	f, err := FileCreate(s.client, name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 func (s Fs) Mkdir(name string, perm os.FileMode) error {
 	err := s.client.Mkdir(name)
 	if err != nil {
-		return err
+		return pathError("mkdir", name, err)
 	}
-	return s.client.Chmod(name, perm)
+	return pathError("mkdir", name, s.client.Chmod(name, perm))
 }
 
 func (s Fs) MkdirAll(path string, perm os.FileMode) error {
@@ -91,7 +97,11 @@ func (s Fs) MkdirAll(path string, perm os.FileMode) error {
 }
 
 func (s Fs) Open(name string) (afero.File, error) {
-	return FileOpen(s.client, name)
+	f, err := FileOpen(s.client, name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 // OpenFile calls the OpenFile method on the SSHFS connection. The mode argument
@@ -99,13 +109,13 @@ func (s Fs) Open(name string) (afero.File, error) {
 func (s Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
 	sshfsFile, err := s.client.OpenFile(name, flag)
 	if err != nil {
-		return nil, err
+		return nil, pathError("open", name, err)
 	}
 	return &File{fd: sshfsFile}, nil
 }
 
 func (s Fs) Remove(name string) error {
-	return s.client.Remove(name)
+	return pathError("remove", name, s.client.Remove(name))
 }
 
 func (s Fs) RemoveAll(path string) error {
@@ -115,25 +125,113 @@ func (s Fs) RemoveAll(path string) error {
 }
 
 func (s Fs) Rename(oldname, newname string) error {
-	return s.client.Rename(oldname, newname)
+	if err := s.client.Rename(oldname, newname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: translateError(err)}
+	}
+	return nil
+}
+
+// WriteReaderAtomic writes to a temporary file and moves it over name with
+// the posix-rename@openssh.com extension, as a plain SFTP rename fails if
+// the target exists. Servers without the extension get afero.ErrNotAtomic.
+func (s Fs) WriteReaderAtomic(name string, r io.Reader, perm os.FileMode) (err error) {
+	if fi, err := s.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	f, err := afero.TempFile(s, path.Dir(name), "."+path.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			s.Remove(tmp)
+		}
+	}()
+
+	_, err = io.Copy(f, r)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	if err = s.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	if err = s.client.PosixRename(tmp, name); err != nil {
+		if serr, ok := err.(*sftp.StatusError); ok && serr.Code == sshFxOpUnsupported {
+			return &os.PathError{Op: "rename", Path: name, Err: afero.ErrNotAtomic}
+		}
+		return &os.LinkError{Op: "rename", Old: tmp, New: name, Err: translateError(err)}
+	}
+	return nil
 }
 
 func (s Fs) Stat(name string) (os.FileInfo, error) {
-	return s.client.Stat(name)
+	fi, err := s.client.Stat(name)
+	return fi, pathError("stat", name, err)
 }
 
 func (s Fs) Lstat(p string) (os.FileInfo, error) {
-	return s.client.Lstat(p)
+	fi, err := s.client.Lstat(p)
+	return fi, pathError("lstat", p, err)
 }
 
 func (s Fs) Chmod(name string, mode os.FileMode) error {
-	return s.client.Chmod(name, mode)
+	return pathError("chmod", name, s.client.Chmod(name, mode))
 }
 
 func (s Fs) Chown(name string, uid, gid int) error {
-	return s.client.Chown(name, uid, gid)
+	return pathError("chown", name, s.client.Chown(name, uid, gid))
 }
 
 func (s Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	return s.client.Chtimes(name, atime, mtime)
+	return pathError("chtimes", name, s.client.Chtimes(name, atime, mtime))
+}
+
+// Status codes of the SFTP protocol which map onto os error sentinels.
+// The sftp package only translates SSH_FX_NO_SUCH_FILE by itself.
+const (
+	sshFxPermissionDenied  = 3
+	sshFxBadMessage        = 5
+	sshFxOpUnsupported     = 8
+	sshFxNoSuchPath        = 10
+	sshFxFileAlreadyExists = 11
+	sshFxWriteProtect      = 12
+	sshFxInvalidFilename   = 20
+)
+
+// translateError attaches the os sentinel matching the status code of an
+// *sftp.StatusError. The original error is kept in the chain.
+func translateError(err error) error {
+	serr, ok := err.(*sftp.StatusError)
+	if !ok {
+		return err
+	}
+	switch serr.Code {
+	case sshFxNoSuchPath:
+		return afero.WrapError(os.ErrNotExist, err)
+	case sshFxFileAlreadyExists:
+		return afero.WrapError(os.ErrExist, err)
+	case sshFxPermissionDenied, sshFxWriteProtect:
+		return afero.WrapError(os.ErrPermission, err)
+	case sshFxInvalidFilename, sshFxBadMessage, sshFxOpUnsupported:
+		return afero.WrapError(os.ErrInvalid, err)
+	}
+	return err
+}
+
+// pathError wraps err in an *os.PathError unless it is nil or already is
+// one.
+func pathError(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*os.PathError); ok {
+		return err
+	}
+	return &os.PathError{Op: op, Path: name, Err: translateError(err)}
 }
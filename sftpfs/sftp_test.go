@@ -24,10 +24,12 @@ import (
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -94,7 +96,8 @@ func (ctx *SftpFsContext) Disconnect() error {
 }
 
 // TODO for such a weird reason rootpath is "." when writing "file1" with afero sftp backend
-func RunSftpServer(rootpath string) {
+// RunSftpServer serves with the host key id_rsa of keyDir.
+func RunSftpServer(rootpath, keyDir string) {
 	var (
 		readOnly      bool
 		debugLevelStr string
@@ -124,7 +127,7 @@ func RunSftpServer(rootpath string) {
 		},
 	}
 
-	privateBytes, err := ioutil.ReadFile("./test/id_rsa")
+	privateBytes, err := ioutil.ReadFile(filepath.Join(keyDir, "id_rsa"))
 	if err != nil {
 		log.Fatal("Failed to load private key", err)
 	}
@@ -235,10 +238,18 @@ func MakeSSHKeyPair(bits int, pubKeyPath, privateKeyPath string) error {
 }
 
 func TestSftpCreate(t *testing.T) {
-	os.Mkdir("./test", 0777)
-	MakeSSHKeyPair(1024, "./test/id_rsa.pub", "./test/id_rsa")
+	// The keys and the files written go to a temporary directory, not to
+	// leave anything in the tree.
+	dir, err := ioutil.TempDir("", "sftpfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := MakeSSHKeyPair(1024, filepath.Join(dir, "id_rsa.pub"), filepath.Join(dir, "id_rsa")); err != nil {
+		t.Fatal(err)
+	}
 
-	go RunSftpServer("./test/")
+	go RunSftpServer(dir, dir)
 	time.Sleep(5 * time.Second)
 
 	ctx, err := SftpConnect("test", "test", "localhost:2022")
@@ -249,12 +260,12 @@ func TestSftpCreate(t *testing.T) {
 
 	var fs = New(ctx.sftpc)
 
-	fs.MkdirAll("test/dir1/dir2/dir3", os.FileMode(0777))
-	fs.Mkdir("test/foo", os.FileMode(0000))
-	fs.Chmod("test/foo", os.FileMode(0700))
-	fs.Mkdir("test/bar", os.FileMode(0777))
+	fs.MkdirAll(filepath.Join(dir, "dir1/dir2/dir3"), os.FileMode(0777))
+	fs.Mkdir(filepath.Join(dir, "foo"), os.FileMode(0000))
+	fs.Chmod(filepath.Join(dir, "foo"), os.FileMode(0700))
+	fs.Mkdir(filepath.Join(dir, "bar"), os.FileMode(0777))
 
-	file, err := fs.Create("file1")
+	file, err := fs.Create(filepath.Join(dir, "file1"))
 	if err != nil {
 		t.Error(err)
 	}
@@ -263,7 +274,7 @@ func TestSftpCreate(t *testing.T) {
 	file.Write([]byte("hello "))
 	file.WriteString("world!\n")
 
-	f1, err := fs.Open("file1")
+	f1, err := fs.Open(filepath.Join(dir, "file1"))
 	if err != nil {
 		log.Fatalf("open: %v", err)
 	}
@@ -274,6 +285,16 @@ func TestSftpCreate(t *testing.T) {
 	_, _ = f1.Read(b)
 	fmt.Println(string(b))
 
+	atomic := filepath.Join(dir, "atomic.txt")
+	for _, data := range []string{"old", "new"} {
+		if err := afero.WriteFileAtomic(fs, atomic, []byte(data), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := afero.ReadFile(fs, atomic); err != nil || string(data) != "new" {
+		t.Errorf("WriteFileAtomic: got %q, %v", data, err)
+	}
+
 	fmt.Println("done")
 	// TODO check here if "hello\tworld\n" is in buffer b
 }
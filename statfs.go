@@ -0,0 +1,59 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FsStats describes the capacity of the filesystem a file resides on, as
+// reported by statfs(2). Sizes are in bytes.
+type FsStats struct {
+	TotalBytes uint64
+	FreeBytes  uint64
+	// AvailBytes is the part of FreeBytes usable by the caller, which
+	// excludes space reserved for the superuser or denied by a quota.
+	AvailBytes uint64
+
+	TotalInodes uint64
+	FreeInodes  uint64
+}
+
+// Statfser is an optional interface in Afero. It is only implemented by the
+// filesystems saying so.
+// Statfs reports the capacity and usage of the filesystem the named file
+// resides on.
+type Statfser interface {
+	Statfs(name string) (*FsStats, error)
+}
+
+// ErrNoStatfs is the error that will be wrapped in an *os.PathError if a
+// file system cannot report its capacity either directly or through its
+// delegated filesystem.
+var ErrNoStatfs = WrapError(os.ErrInvalid, errors.New("statfs not supported"))
+
+// statfsIfPossible calls Statfs on fs if it implements Statfser.
+func statfsIfPossible(fs Fs, name string) (*FsStats, error) {
+	if s, ok := fs.(Statfser); ok {
+		return s.Statfs(name)
+	}
+	return nil, &os.PathError{Op: "statfs", Path: name, Err: ErrNoStatfs}
+}
+
+// statfsExisting calls Statfs on fs for name or, if it does not exist there,
+// for its closest existing ancestor, which resides on the same filesystem
+// as name would once created. It is used by the union filesystems, where a
+// file visible in the base may not exist in the layer.
+func statfsExisting(fs Fs, name string) (*FsStats, error) {
+	for {
+		st, err := statfsIfPossible(fs, name)
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			return st, err
+		}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return nil, err
+		}
+		name = parent
+	}
+}
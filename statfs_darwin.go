@@ -0,0 +1,23 @@
+package afero
+
+import (
+	"os"
+	"syscall"
+)
+
+var _ Statfser = (*OsFs)(nil)
+
+func (OsFs) Statfs(name string) (*FsStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(name, &st); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: err}
+	}
+	bsize := uint64(st.Bsize)
+	return &FsStats{
+		TotalBytes:  st.Blocks * bsize,
+		FreeBytes:   st.Bfree * bsize,
+		AvailBytes:  st.Bavail * bsize,
+		TotalInodes: st.Files,
+		FreeInodes:  st.Ffree,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package afero
+
+import (
+	"os"
+	"syscall"
+)
+
+var _ Statfser = (*OsFs)(nil)
+
+func (OsFs) Statfs(name string) (*FsStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(name, &st); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: err}
+	}
+	// The block counts are in units of the fragment size.
+	bsize := uint64(st.Frsize)
+	if bsize == 0 {
+		bsize = uint64(st.Bsize)
+	}
+	return &FsStats{
+		TotalBytes:  uint64(st.Blocks) * bsize,
+		FreeBytes:   uint64(st.Bfree) * bsize,
+		AvailBytes:  uint64(st.Bavail) * bsize,
+		TotalInodes: uint64(st.Files),
+		FreeInodes:  uint64(st.Ffree),
+	}, nil
+}
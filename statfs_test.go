@@ -0,0 +1,83 @@
+package afero
+
+import (
+	"errors"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestMemMapFsStatfs(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/dir/a", make([]byte, 100), 0644)
+	WriteFile(fs, "/dir/b", make([]byte, 50), 0644)
+
+	st, err := fs.Statfs("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalBytes != math.MaxInt64 || st.FreeBytes != math.MaxInt64-150 {
+		t.Errorf("unexpected unlimited stats %+v", st)
+	}
+
+	fs.SetCapacity(1000, 10)
+	st, err = fs.Statfs("/dir/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root, /dir and the two files.
+	want := FsStats{TotalBytes: 1000, FreeBytes: 850, AvailBytes: 850, TotalInodes: 10, FreeInodes: 6}
+	if *st != want {
+		t.Errorf("expected %+v, got %+v", want, *st)
+	}
+
+	if _, err := fs.Statfs("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestStatfsWrappers(t *testing.T) {
+	base := &MemMapFs{}
+	base.SetCapacity(1000, 100)
+	WriteFile(base, "/base/file.txt", make([]byte, 100), 0644)
+
+	st, err := NewBasePathFs(base, "/base").(Statfser).Statfs("/file.txt")
+	if err != nil || st.FreeBytes != 900 {
+		t.Errorf("BasePathFs: got %+v, %v", st, err)
+	}
+	st, err = NewReadOnlyFs(base).(Statfser).Statfs("/base")
+	if err != nil || st.FreeBytes != 900 || st.AvailBytes != 0 {
+		t.Errorf("ReadOnlyFs: got %+v, %v", st, err)
+	}
+
+	layer := &MemMapFs{}
+	layer.SetCapacity(500, 100)
+	st, err = NewCopyOnWriteFs(base, layer).(Statfser).Statfs("/base/file.txt")
+	if err != nil || st.TotalBytes != 500 {
+		t.Errorf("CopyOnWriteFs: expected the layer stats, got %+v, %v", st, err)
+	}
+	if _, err := NewCopyOnWriteFs(base, layer).(Statfser).Statfs("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("CopyOnWriteFs: expected not exist error, got %v", err)
+	}
+	st, err = NewCacheOnReadFs(base, layer, 0).(Statfser).Statfs("/base/file.txt")
+	if err != nil || st.TotalBytes != 1000 || st.FreeBytes != 500 {
+		t.Errorf("CacheOnReadFs: got %+v, %v", st, err)
+	}
+}
+
+func TestOsFsStatfs(t *testing.T) {
+	s, ok := Fs(&OsFs{}).(Statfser)
+	if !ok {
+		t.Skip("OsFs does not support statfs on this platform")
+	}
+	st, err := s.Statfs(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalBytes == 0 || st.FreeBytes > st.TotalBytes || st.AvailBytes > st.FreeBytes {
+		t.Errorf("inconsistent stats %+v", st)
+	}
+	if _, err := s.Statfs("/does/not/exist"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
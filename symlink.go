@@ -15,6 +15,7 @@ package afero
 
 import (
 	"errors"
+	"os"
 )
 
 // Symlinker is an optional interface in Afero. It is only implemented by the
@@ -41,7 +42,7 @@ type Linker interface {
 // ErrNoSymlink is the error that will be wrapped in an os.LinkError if a file system
 // does not support Symlink's either directly or through its delegated filesystem.
 // As expressed by support for the Linker interface.
-var ErrNoSymlink = errors.New("symlink not supported")
+var ErrNoSymlink = WrapError(os.ErrInvalid, errors.New("symlink not supported"))
 
 // LinkReader is an optional interface in Afero. It is only implemented by the
 // filesystems saying so.
@@ -52,4 +53,4 @@ type LinkReader interface {
 // ErrNoReadlink is the error that will be wrapped in an os.Path if a file system
 // does not support the readlink operation either directly or through its delegated filesystem.
 // As expressed by support for the LinkReader interface.
-var ErrNoReadlink = errors.New("readlink not supported")
+var ErrNoReadlink = WrapError(os.ErrInvalid, errors.New("readlink not supported"))
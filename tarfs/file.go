@@ -20,11 +20,10 @@ type File struct {
 
 func (f *File) Close() error {
 	if f.closed {
-		return afero.ErrFileClosed
+		return &os.PathError{Op: "close", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 
 	f.closed = true
-	f.h = nil
 	f.data = nil
 	f.fs = nil
 
@@ -33,11 +32,11 @@ func (f *File) Close() error {
 
 func (f *File) Read(p []byte) (n int, err error) {
 	if f.closed {
-		return 0, afero.ErrFileClosed
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 
 	if f.h.Typeflag == tar.TypeDir {
-		return 0, syscall.EISDIR
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: syscall.EISDIR}
 	}
 
 	return f.data.Read(p)
@@ -45,11 +44,11 @@ func (f *File) Read(p []byte) (n int, err error) {
 
 func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 	if f.closed {
-		return 0, afero.ErrFileClosed
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 
 	if f.h.Typeflag == tar.TypeDir {
-		return 0, syscall.EISDIR
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: syscall.EISDIR}
 	}
 
 	return f.data.ReadAt(p, off)
@@ -57,19 +56,23 @@ func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	if f.closed {
-		return 0, afero.ErrFileClosed
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 
 	if f.h.Typeflag == tar.TypeDir {
-		return 0, syscall.EISDIR
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: syscall.EISDIR}
 	}
 
 	return f.data.Seek(offset, whence)
 }
 
-func (f *File) Write(p []byte) (n int, err error) { return 0, syscall.EROFS }
+func (f *File) Write(p []byte) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: afero.ErrReadOnly}
+}
 
-func (f *File) WriteAt(p []byte, off int64) (n int, err error) { return 0, syscall.EROFS }
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: afero.ErrReadOnly}
+}
 
 func (f *File) Name() string {
 	return filepath.Join(splitpath(f.h.Name))
@@ -92,11 +95,11 @@ func (f *File) getDirectoryNames() ([]string, error) {
 
 func (f *File) Readdir(count int) ([]os.FileInfo, error) {
 	if f.closed {
-		return nil, afero.ErrFileClosed
+		return nil, &os.PathError{Op: "readdir", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 
 	if !f.h.FileInfo().IsDir() {
-		return nil, syscall.ENOTDIR
+		return nil, &os.PathError{Op: "readdir", Path: f.Name(), Err: syscall.ENOTDIR}
 	}
 
 	names, err := f.getDirectoryNames()
@@ -139,6 +142,10 @@ func (f *File) Stat() (os.FileInfo, error) { return f.h.FileInfo(), nil }
 
 func (f *File) Sync() error { return nil }
 
-func (f *File) Truncate(size int64) error { return syscall.EROFS }
+func (f *File) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.Name(), Err: afero.ErrReadOnly}
+}
 
-func (f *File) WriteString(s string) (ret int, err error) { return 0, syscall.EROFS }
+func (f *File) WriteString(s string) (ret int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: afero.ErrReadOnly}
+}
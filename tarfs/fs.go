@@ -98,25 +98,37 @@ func (fs *Fs) Open(name string) (afero.File, error) {
 
 func (fs *Fs) Name() string { return "tarfs" }
 
-func (fs *Fs) Create(name string) (afero.File, error) { return nil, syscall.EROFS }
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Mkdir(name string, perm os.FileMode) error { return syscall.EROFS }
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) MkdirAll(path string, perm os.FileMode) error { return syscall.EROFS }
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: afero.ErrReadOnly}
+}
 
 func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
 	if flag != os.O_RDONLY {
-		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+		return nil, &os.PathError{Op: "open", Path: name, Err: afero.ErrReadOnly}
 	}
 
 	return fs.Open(name)
 }
 
-func (fs *Fs) Remove(name string) error { return syscall.EROFS }
+func (fs *Fs) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) RemoveAll(path string) error { return syscall.EROFS }
+func (fs *Fs) RemoveAll(path string) error {
+	return &os.PathError{Op: "remove_all", Path: path, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Rename(oldname string, newname string) error { return syscall.EROFS }
+func (fs *Fs) Rename(oldname string, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: afero.ErrReadOnly}
+}
 
 func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 	d, f := splitpath(name)
@@ -132,8 +144,14 @@ func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 	return file.h.FileInfo(), nil
 }
 
-func (fs *Fs) Chmod(name string, mode os.FileMode) error { return syscall.EROFS }
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Chown(name string, uid, gid int) error { return syscall.EROFS }
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error { return syscall.EROFS }
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: afero.ErrReadOnly}
+}
@@ -3,6 +3,7 @@ package tarfs
 
 import (
 	"archive/tar"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -108,7 +109,7 @@ func TestRead(t *testing.T) {
 		buf := make([]byte, 8)
 		n, err := file.Read(buf)
 		if err != nil {
-			if f.isdir && (err != syscall.EISDIR) {
+			if f.isdir && !errors.Is(err, syscall.EISDIR) {
 				t.Errorf("%v got error %v, expected EISDIR", f.name, err)
 			} else if !f.isdir {
 				t.Errorf("%v: %v", f.name, err)
@@ -136,7 +137,7 @@ func TestReadAt(t *testing.T) {
 		buf := make([]byte, 8)
 		n, err := file.ReadAt(buf, 4092)
 		if err != nil {
-			if f.isdir && (err != syscall.EISDIR) {
+			if f.isdir && !errors.Is(err, syscall.EISDIR) {
 				t.Errorf("%v got error %v, expected EISDIR", f.name, err)
 			} else if !f.isdir {
 				t.Errorf("%v: %v", f.name, err)
@@ -177,7 +178,7 @@ func TestSeek(t *testing.T) {
 		for _, s := range tests {
 			n, err := file.Seek(s.offin, s.whence)
 			if err != nil {
-				if f.isdir && err == syscall.EISDIR {
+				if f.isdir && errors.Is(err, syscall.EISDIR) {
 					continue
 				}
 
@@ -267,8 +268,8 @@ func TestOpenFile(t *testing.T) {
 		file.Close()
 
 		file, err = afs.OpenFile(f.name, os.O_CREATE, 0600)
-		if !errors.Is(err, syscall.EPERM) {
-			t.Errorf("%v: open for write: got %v, expected %v", f.name, err, syscall.EPERM)
+		if !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%v: open for write: got %v, expected %v", f.name, err, os.ErrPermission)
 		}
 
 	}
@@ -340,7 +341,7 @@ func TestReaddir(t *testing.T) {
 	}
 
 	_, err = dir.Readdir(-1)
-	if err != syscall.ENOTDIR {
+	if !errors.Is(err, syscall.ENOTDIR) {
 		t.Fatal("Expected error")
 	}
 }
@@ -377,7 +378,7 @@ func TestReaddirnames(t *testing.T) {
 	}
 
 	_, err = dir.Readdir(-1)
-	if err != syscall.ENOTDIR {
+	if !errors.Is(err, syscall.ENOTDIR) {
 		t.Fatal("Expected error")
 	}
 }
@@ -404,3 +405,41 @@ func TestGlob(t *testing.T) {
 		}
 	}
 }
+
+func TestXattr(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name:     "tagged",
+		Mode:     0644,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+		PAXRecords: map[string]string{
+			"SCHILY.xattr.user.mime_type": "text/plain",
+			"SCHILY.xattr.user.origin":    "upstream",
+		},
+	})
+	tw.Close()
+	fs := New(tar.NewReader(&buf))
+
+	attrs, err := fs.ListXattr("/tagged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(attrs, []string{"user.mime_type", "user.origin"}) {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	value, err := fs.GetXattr("/tagged", "user.mime_type")
+	if err != nil || string(value) != "text/plain" {
+		t.Errorf("GetXattr: got %q, %v", value, err)
+	}
+	if _, err := fs.GetXattr("/tagged", "user.missing"); !errors.Is(err, afero.ErrNoAttr) {
+		t.Errorf("expected ErrNoAttr, got %v", err)
+	}
+	if _, err := fs.ListXattr("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	if err := fs.SetXattr("/tagged", "user.origin", nil); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
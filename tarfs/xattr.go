@@ -0,0 +1,63 @@
+package tarfs
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+var _ afero.Xattrer = (*Fs)(nil)
+
+// paxXattrPrefix is the prefix of the PAX records holding extended
+// attributes, as written by GNU tar and the archive/tar package.
+const paxXattrPrefix = "SCHILY.xattr."
+
+func (fs *Fs) lookup(op, name string) (*File, error) {
+	d, f := splitpath(name)
+	file, ok := fs.files[d][f]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+	}
+	return file, nil
+}
+
+// GetXattr returns the extended attribute attr of name, as stored in the
+// PAX records of the archive.
+func (fs *Fs) GetXattr(name, attr string) ([]byte, error) {
+	file, err := fs.lookup("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := file.h.PAXRecords[paxXattrPrefix+attr]
+	if !ok {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: afero.ErrNoAttr}
+	}
+	return []byte(value), nil
+}
+
+func (fs *Fs) SetXattr(name, attr string, value []byte) error {
+	return &os.PathError{Op: "setxattr", Path: name, Err: afero.ErrReadOnly}
+}
+
+// ListXattr returns the names of the extended attributes of name, sorted.
+func (fs *Fs) ListXattr(name string) ([]string, error) {
+	file, err := fs.lookup("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	var attrs []string
+	for key := range file.h.PAXRecords {
+		if strings.HasPrefix(key, paxXattrPrefix) {
+			attrs = append(attrs, strings.TrimPrefix(key, paxXattrPrefix))
+		}
+	}
+	sort.Strings(attrs)
+	return attrs, nil
+}
+
+func (fs *Fs) RemoveXattr(name, attr string) error {
+	return &os.PathError{Op: "removexattr", Path: name, Err: afero.ErrReadOnly}
+}
@@ -0,0 +1,364 @@
+package afero
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+var _ Lstater = (*ThrottleFs)(nil)
+
+// A RateLimiter is a token bucket limiting how fast something may happen,
+// such as bytes read or operations performed. One limiter can be shared by
+// several ThrottleFs, so that they share a single budget.
+// A nil *RateLimiter does not limit anything.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	tokens  float64
+	last    time.Time
+	changed chan struct{} // closed when the limit is changed
+}
+
+// NewRateLimiter returns a limiter allowing rate tokens per second, with
+// bursts of up to burst tokens. A rate of zero or less disables limiting.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := &RateLimiter{last: time.Now()}
+	l.SetLimit(rate, burst)
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// SetLimit changes the rate and burst of the limiter. Callers waiting for
+// tokens pick up the new limit immediately.
+func (l *RateLimiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate, l.burst = rate, burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// Limit returns the current rate and burst of the limiter.
+func (l *RateLimiter) Limit() (rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate, l.burst
+}
+
+// Wait blocks until n tokens are available, or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	for n > 0 {
+		took, err := l.take(ctx, n)
+		if err != nil {
+			return err
+		}
+		n -= took
+	}
+	return nil
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// take waits for and takes up to n tokens, at most one burst, and returns
+// how many it took.
+func (l *RateLimiter) take(ctx context.Context, n int) (int, error) {
+	if l == nil || n <= 0 {
+		return n, nil
+	}
+	for {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return n, nil
+		}
+		if n > l.burst {
+			n = l.burst
+		}
+		l.refill(time.Now())
+		if l.tokens >= float64(n) {
+			l.tokens -= float64(n)
+			l.mu.Unlock()
+			return n, nil
+		}
+		delay := time.Duration((float64(n) - l.tokens) / l.rate * float64(time.Second))
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// give returns unused tokens.
+func (l *RateLimiter) give(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.tokens += float64(n)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.mu.Unlock()
+}
+
+// The ThrottleFs limits the rate at which a source filesystem is used:
+// bytes per second read from and written to its files, and metadata
+// operations per second, such as Open, Stat, Readdir or Remove. Each
+// limiter may be nil for no limit, and may be shared with other ThrottleFs.
+//
+// Reads return at most one burst worth of bytes at a time, while writes
+// are split into bursts and wait for each of them.
+type ThrottleFs struct {
+	source Fs
+	read   *RateLimiter
+	write  *RateLimiter
+	ops    *RateLimiter
+	ctx    context.Context
+}
+
+func NewThrottleFs(source Fs, read, write, ops *RateLimiter) *ThrottleFs {
+	return &ThrottleFs{source: source, read: read, write: write, ops: ops, ctx: context.Background()}
+}
+
+// WithContext returns a copy of t whose operations, and the ones of the
+// files opened through it, give up waiting for the limiters once ctx is
+// done. They then fail with ctx.Err() wrapped in an *os.PathError.
+func (t *ThrottleFs) WithContext(ctx context.Context) *ThrottleFs {
+	t2 := *t
+	t2.ctx = ctx
+	return &t2
+}
+
+func (t *ThrottleFs) op(op, name string) error {
+	if err := t.ops.Wait(t.ctx, 1); err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+func (t *ThrottleFs) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &ThrottleFile{lockingFile: lockingFile{f}, fs: t}, nil
+}
+
+func (t *ThrottleFs) Name() string {
+	return "ThrottleFs"
+}
+
+func (t *ThrottleFs) Create(name string) (File, error) {
+	if err := t.op("create", name); err != nil {
+		return nil, err
+	}
+	return t.wrap(t.source.Create(name))
+}
+
+func (t *ThrottleFs) Open(name string) (File, error) {
+	if err := t.op("open", name); err != nil {
+		return nil, err
+	}
+	return t.wrap(t.source.Open(name))
+}
+
+func (t *ThrottleFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := t.op("open", name); err != nil {
+		return nil, err
+	}
+	return t.wrap(t.source.OpenFile(name, flag, perm))
+}
+
+func (t *ThrottleFs) Mkdir(name string, perm os.FileMode) error {
+	if err := t.op("mkdir", name); err != nil {
+		return err
+	}
+	return t.source.Mkdir(name, perm)
+}
+
+func (t *ThrottleFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := t.op("mkdir", path); err != nil {
+		return err
+	}
+	return t.source.MkdirAll(path, perm)
+}
+
+func (t *ThrottleFs) Remove(name string) error {
+	if err := t.op("remove", name); err != nil {
+		return err
+	}
+	return t.source.Remove(name)
+}
+
+func (t *ThrottleFs) RemoveAll(path string) error {
+	if err := t.op("remove_all", path); err != nil {
+		return err
+	}
+	return t.source.RemoveAll(path)
+}
+
+func (t *ThrottleFs) Rename(oldname, newname string) error {
+	if err := t.ops.Wait(t.ctx, 1); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return t.source.Rename(oldname, newname)
+}
+
+func (t *ThrottleFs) Stat(name string) (os.FileInfo, error) {
+	if err := t.op("stat", name); err != nil {
+		return nil, err
+	}
+	return t.source.Stat(name)
+}
+
+func (t *ThrottleFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := t.op("lstat", name); err != nil {
+		return nil, false, err
+	}
+	if lstater, ok := t.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := t.source.Stat(name)
+	return fi, false, err
+}
+
+func (t *ThrottleFs) Chmod(name string, mode os.FileMode) error {
+	if err := t.op("chmod", name); err != nil {
+		return err
+	}
+	return t.source.Chmod(name, mode)
+}
+
+func (t *ThrottleFs) Chown(name string, uid, gid int) error {
+	if err := t.op("chown", name); err != nil {
+		return err
+	}
+	return t.source.Chown(name, uid, gid)
+}
+
+func (t *ThrottleFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := t.op("chtimes", name); err != nil {
+		return err
+	}
+	return t.source.Chtimes(name, atime, mtime)
+}
+
+// ThrottleFile is a file opened through a ThrottleFs.
+type ThrottleFile struct {
+	lockingFile
+	fs *ThrottleFs
+}
+
+func (f *ThrottleFile) Read(p []byte) (int, error) {
+	allowed, err := f.fs.read.take(f.fs.ctx, len(p))
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: err}
+	}
+	n, err := f.File.Read(p[:allowed])
+	f.fs.read.give(allowed - n)
+	return n, err
+}
+
+func (f *ThrottleFile) ReadAt(p []byte, off int64) (int, error) {
+	// ReadAt must fill p unless it fails, so wait for all of it.
+	for read := 0; read < len(p); {
+		allowed, err := f.fs.read.take(f.fs.ctx, len(p)-read)
+		if err != nil {
+			return read, &os.PathError{Op: "read", Path: f.Name(), Err: err}
+		}
+		n, err := f.File.ReadAt(p[read:read+allowed], off+int64(read))
+		f.fs.read.give(allowed - n)
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return len(p), nil
+}
+
+func (f *ThrottleFile) Write(p []byte) (int, error) {
+	var written int
+	for written < len(p) {
+		allowed, err := f.fs.write.take(f.fs.ctx, len(p)-written)
+		if err != nil {
+			return written, &os.PathError{Op: "write", Path: f.Name(), Err: err}
+		}
+		n, err := f.File.Write(p[written : written+allowed])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (f *ThrottleFile) WriteAt(p []byte, off int64) (int, error) {
+	var written int
+	for written < len(p) {
+		allowed, err := f.fs.write.take(f.fs.ctx, len(p)-written)
+		if err != nil {
+			return written, &os.PathError{Op: "write", Path: f.Name(), Err: err}
+		}
+		n, err := f.File.WriteAt(p[written:written+allowed], off+int64(written))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (f *ThrottleFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *ThrottleFile) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.fs.op("readdir", f.Name()); err != nil {
+		return nil, err
+	}
+	return f.File.Readdir(count)
+}
+
+func (f *ThrottleFile) Readdirnames(n int) ([]string, error) {
+	if err := f.fs.op("readdir", f.Name()); err != nil {
+		return nil, err
+	}
+	return f.File.Readdirnames(n)
+}
+
+func (f *ThrottleFile) Stat() (os.FileInfo, error) {
+	if err := f.fs.op("stat", f.Name()); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
@@ -0,0 +1,85 @@
+package afero
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestThrottleFsBytes(t *testing.T) {
+	mfs := &MemMapFs{}
+	fs := NewThrottleFs(mfs, NewRateLimiter(1000, 100), NewRateLimiter(1000, 100), nil)
+
+	start := time.Now()
+	if err := WriteFile(fs, "/file", make([]byte, 300), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The first burst is free, the remaining 200 bytes take 200ms.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("write was not throttled: %v", elapsed)
+	}
+
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 300)
+	n, err := f.Read(buf)
+	if err != nil || n != 100 {
+		t.Errorf("expected a single burst to be read, got %d, %v", n, err)
+	}
+	start = time.Now()
+	if _, err := io.ReadFull(f, buf[n:]); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("read was not throttled: %v", elapsed)
+	}
+}
+
+func TestThrottleFsOps(t *testing.T) {
+	mfs := &MemMapFs{}
+	mfs.Mkdir("/dir", 0755)
+	shared := NewRateLimiter(20, 1)
+	a := NewThrottleFs(mfs, nil, nil, shared)
+	b := NewThrottleFs(mfs, nil, nil, shared)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		a.Stat("/dir")
+		b.Stat("/dir")
+	}
+	// Six operations on a shared budget of 20 per second.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("operations were not throttled: %v", elapsed)
+	}
+
+	// The first operation uses up the burst, the next ones have to wait.
+	slow := NewRateLimiter(0.1, 1)
+	c := NewThrottleFs(mfs, nil, nil, slow)
+	c.Stat("/dir")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.WithContext(ctx).Stat("/dir"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Stat("/dir")
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	slow.SetLimit(0, 1)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lifting the limit did not release the waiting operation")
+	}
+}
@@ -0,0 +1,399 @@
+package afero
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ Lstater = (*TrashFs)(nil)
+
+// ErrNotInTrash is the error that will be wrapped in an *os.PathError when
+// there is no entry of the given id in the trash.
+var ErrNotInTrash = WrapError(os.ErrNotExist, errors.New("not in trash"))
+
+// errTrashInfo is the error of an entry whose info file cannot be parsed.
+var errTrashInfo = errors.New("invalid trash info")
+
+// TrashOptions are the options of a TrashFs.
+type TrashOptions struct {
+	// Dir is the directory of the source holding the trash, "/.trash" if
+	// empty. It is hidden from the TrashFs, and must be on the same
+	// filesystem as the files removed, as they are renamed into it.
+	Dir string
+
+	// MaxAge is how long entries are kept in the trash. Zero means
+	// forever.
+	MaxAge time.Duration
+}
+
+// A TrashEntry is a file or directory removed into the trash.
+type TrashEntry struct {
+	ID      string
+	Path    string // where it was removed from
+	Deleted time.Time
+	IsDir   bool
+}
+
+// trashInfo is the content of the info file of an entry.
+type trashInfo struct {
+	Path    string
+	Deleted time.Time
+}
+
+// The TrashFs moves the files and directories removed from a source
+// filesystem into a trash, from where they can be restored, or purged for
+// good.
+//
+// The trash is a directory of the source, hidden from the TrashFs, see
+// TrashOptions. Entries removed are renamed into its "files" directory,
+// and the path they were removed from and the time are recorded in its
+// "info" directory. Entries older than the MaxAge option expire whenever
+// something is removed, or when Expire is called.
+type TrashFs struct {
+	source Fs
+	dir    string
+	maxAge time.Duration
+
+	mu   sync.Mutex
+	last int64 // of the last entry
+}
+
+func NewTrashFs(source Fs, opts TrashOptions) *TrashFs {
+	if opts.Dir == "" {
+		opts.Dir = "/.trash"
+	}
+	return &TrashFs{source: source, dir: normalizePath(opts.Dir), maxAge: opts.MaxAge}
+}
+
+// hidden tells whether name is in the trash.
+func (t *TrashFs) hidden(name string) bool {
+	name = normalizePath(name)
+	return name == t.dir || strings.HasPrefix(name, t.dir+string(filepath.Separator))
+}
+
+func (t *TrashFs) hiddenError(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func (t *TrashFs) filePath(id string) string {
+	return filepath.Join(t.dir, "files", id)
+}
+
+func (t *TrashFs) infoPath(id string) string {
+	return filepath.Join(t.dir, "info", id+".json")
+}
+
+// trash moves name into the trash.
+func (t *TrashFs) trash(name string) error {
+	t.mu.Lock()
+	nsec := time.Now().UnixNano()
+	if nsec <= t.last {
+		nsec = t.last + 1
+	}
+	t.last = nsec
+	t.mu.Unlock()
+	id := fmt.Sprintf("%020d", nsec)
+
+	if err := t.source.MkdirAll(filepath.Join(t.dir, "files"), 0700); err != nil {
+		return err
+	}
+	if err := t.source.MkdirAll(filepath.Join(t.dir, "info"), 0700); err != nil {
+		return err
+	}
+	info, err := json.Marshal(trashInfo{Path: normalizePath(name), Deleted: time.Unix(0, nsec)})
+	if err != nil {
+		return err
+	}
+	// The info goes first, so that an entry is never lost in the trash.
+	if err := WriteFile(t.source, t.infoPath(id), info, 0600); err != nil {
+		return err
+	}
+	if err := t.source.Rename(name, t.filePath(id)); err != nil {
+		t.source.Remove(t.infoPath(id))
+		return err
+	}
+	// The entry is in the trash: failing to expire others does not fail
+	// the removal.
+	t.Expire()
+	return nil
+}
+
+// Trash returns the entries of the trash, oldest first. Those whose info
+// file cannot be parsed are left out.
+func (t *TrashFs) Trash() ([]TrashEntry, error) {
+	fis, err := ReadDir(t.source, filepath.Join(t.dir, "info"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []TrashEntry
+	for _, fi := range fis {
+		id := strings.TrimSuffix(fi.Name(), ".json")
+		entry, err := t.entry(id)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errTrashInfo) {
+			// Purged, never moved, or with its info file left partly
+			// written.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func (t *TrashFs) entry(id string) (TrashEntry, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return TrashEntry{}, &os.PathError{Op: "trash", Path: id, Err: ErrNotInTrash}
+	}
+	data, err := ReadFile(t.source, t.infoPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = &os.PathError{Op: "trash", Path: id, Err: ErrNotInTrash}
+		}
+		return TrashEntry{}, err
+	}
+	var info trashInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return TrashEntry{}, &os.PathError{Op: "trash", Path: id, Err: errTrashInfo}
+	}
+	fi, err := lstatIfPossible(t.source, t.filePath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = &os.PathError{Op: "trash", Path: id, Err: ErrNotInTrash}
+		}
+		return TrashEntry{}, err
+	}
+	return TrashEntry{ID: id, Path: info.Path, Deleted: info.Deleted, IsDir: fi.IsDir()}, nil
+}
+
+// Restore moves the entry id of the trash back where it was removed from,
+// creating the missing parent directories. It fails if something took its
+// place since.
+func (t *TrashFs) Restore(id string) error {
+	entry, err := t.entry(id)
+	if err != nil {
+		return err
+	}
+	if _, err := lstatIfPossible(t.source, entry.Path); err == nil {
+		return &os.PathError{Op: "restore", Path: entry.Path, Err: os.ErrExist}
+	}
+	if err := t.source.MkdirAll(filepath.Dir(entry.Path), 0777); err != nil {
+		return err
+	}
+	if err := t.source.Rename(t.filePath(id), entry.Path); err != nil {
+		return err
+	}
+	return t.source.Remove(t.infoPath(id))
+}
+
+// Purge removes the entry id of the trash for good.
+func (t *TrashFs) Purge(id string) error {
+	if _, err := t.entry(id); err != nil {
+		return err
+	}
+	if err := t.source.RemoveAll(t.filePath(id)); err != nil {
+		return err
+	}
+	return t.source.Remove(t.infoPath(id))
+}
+
+// Expire purges the entries older than the MaxAge option.
+func (t *TrashFs) Expire() error {
+	if t.maxAge <= 0 {
+		return nil
+	}
+	entries, err := t.Trash()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if time.Since(entry.Deleted) <= t.maxAge {
+			break
+		}
+		if err := t.Purge(entry.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TrashFs) Name() string {
+	return "TrashFs"
+}
+
+func (t *TrashFs) Create(name string) (File, error) {
+	return t.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (t *TrashFs) Open(name string) (File, error) {
+	return t.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (t *TrashFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if t.hidden(name) {
+		return nil, t.hiddenError("open", name)
+	}
+	f, err := t.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &TrashFile{lockingFile: lockingFile{f}, fs: t, name: name}, nil
+}
+
+func (t *TrashFs) Mkdir(name string, perm os.FileMode) error {
+	if t.hidden(name) {
+		return t.hiddenError("mkdir", name)
+	}
+	return t.source.Mkdir(name, perm)
+}
+
+func (t *TrashFs) MkdirAll(path string, perm os.FileMode) error {
+	if t.hidden(path) {
+		return t.hiddenError("mkdir", path)
+	}
+	return t.source.MkdirAll(path, perm)
+}
+
+// Remove moves name into the trash. As with os.Remove, a directory must
+// be empty.
+func (t *TrashFs) Remove(name string) error {
+	if t.hidden(name) {
+		return t.hiddenError("remove", name)
+	}
+	fi, err := lstatIfPossible(t.source, name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: underlyingError(err)}
+	}
+	if fi.IsDir() {
+		dir, err := t.source.Open(name)
+		if err != nil {
+			return err
+		}
+		names, _ := dir.Readdirnames(1)
+		dir.Close()
+		if len(names) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	return t.trash(name)
+}
+
+// RemoveAll moves path, with everything it contains, into the trash. Of a
+// directory containing the trash, everything else is moved.
+func (t *TrashFs) RemoveAll(path string) error {
+	if t.hidden(path) {
+		// As if it did not exist.
+		return nil
+	}
+	fi, err := lstatIfPossible(t.source, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() || !t.contains(path) {
+		return t.trash(path)
+	}
+	dir, err := t.source.Open(path)
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name := filepath.Join(path, name); !t.hidden(name) {
+			if err := t.RemoveAll(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contains tells whether the trash is below the directory dir.
+func (t *TrashFs) contains(dir string) bool {
+	dir = strings.TrimSuffix(normalizePath(dir), string(filepath.Separator))
+	return strings.HasPrefix(t.dir, dir+string(filepath.Separator))
+}
+
+func (t *TrashFs) Rename(oldname, newname string) error {
+	if t.hidden(oldname) || t.hidden(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	return t.source.Rename(oldname, newname)
+}
+
+func (t *TrashFs) Stat(name string) (os.FileInfo, error) {
+	if t.hidden(name) {
+		return nil, t.hiddenError("stat", name)
+	}
+	return t.source.Stat(name)
+}
+
+func (t *TrashFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if t.hidden(name) {
+		return nil, false, t.hiddenError("lstat", name)
+	}
+	if lstater, ok := t.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := t.source.Stat(name)
+	return fi, false, err
+}
+
+func (t *TrashFs) Chmod(name string, mode os.FileMode) error {
+	if t.hidden(name) {
+		return t.hiddenError("chmod", name)
+	}
+	return t.source.Chmod(name, mode)
+}
+
+func (t *TrashFs) Chown(name string, uid, gid int) error {
+	if t.hidden(name) {
+		return t.hiddenError("chown", name)
+	}
+	return t.source.Chown(name, uid, gid)
+}
+
+func (t *TrashFs) Chtimes(name string, atime, mtime time.Time) error {
+	if t.hidden(name) {
+		return t.hiddenError("chtimes", name)
+	}
+	return t.source.Chtimes(name, atime, mtime)
+}
+
+// TrashFile is a file opened through a TrashFs.
+type TrashFile struct {
+	lockingFile
+	fs   *TrashFs
+	name string
+}
+
+// Readdir hides the trash.
+func (f *TrashFile) Readdir(count int) ([]os.FileInfo, error) {
+	return readdirFiltered(f.File, count, func(fi os.FileInfo) (os.FileInfo, bool) {
+		return fi, !f.fs.hidden(filepath.Join(f.name, fi.Name()))
+	})
+}
+
+func (f *TrashFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
@@ -0,0 +1,132 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTrashFsRestore(t *testing.T) {
+	fs := NewTrashFs(&MemMapFs{}, TrashOptions{})
+	fs.MkdirAll("/home/user/docs", 0755)
+	WriteFile(fs, "/home/user/docs/thesis", []byte("years of work"), 0644)
+	WriteFile(fs, "/home/user/notes", []byte("notes"), 0644)
+
+	if err := fs.RemoveAll("/home/user/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/home/user/notes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/home/user/docs/thesis"); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be removed, got %v", err)
+	}
+	entries, err := fs.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/home/user/docs" || !entries[0].IsDir ||
+		entries[1].Path != "/home/user/notes" || entries[1].IsDir {
+		t.Fatalf("expected both entries in the trash, got %v", entries)
+	}
+
+	fs.RemoveAll("/home")
+	if err := fs.Restore(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/home/user/docs/thesis"); err != nil || string(data) != "years of work" {
+		t.Errorf("expected the directory back, got %q, %v", data, err)
+	}
+
+	WriteFile(fs, "/home/user/notes", []byte("new notes"), 0644)
+	if err := fs.Restore(entries[1].ID); !os.IsExist(err) {
+		t.Errorf("expected restoring over a new file to fail, got %v", err)
+	}
+	if err := fs.Purge(entries[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Restore(entries[1].ID); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("expected ErrNotInTrash, got %v", err)
+	}
+}
+
+func TestTrashFsRemove(t *testing.T) {
+	fs := NewTrashFs(&MemMapFs{}, TrashOptions{})
+	fs.MkdirAll("/dir", 0755)
+	WriteFile(fs, "/dir/f", nil, 0644)
+	if err := fs.Remove("/dir"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("expected removing a directory not empty to fail, got %v", err)
+	}
+	if err := fs.Remove("/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected removing a missing file to fail, got %v", err)
+	}
+	if err := fs.RemoveAll("/missing"); err != nil {
+		t.Errorf("expected RemoveAll of a missing path to succeed, got %v", err)
+	}
+
+	if err := fs.RemoveAll("/"); err != nil {
+		t.Fatal(err)
+	}
+	names, err := readDirNames(fs, "/")
+	if err != nil || len(names) != 0 {
+		t.Errorf("expected everything but the hidden trash removed, got %v, %v", names, err)
+	}
+	if entries, _ := fs.Trash(); len(entries) != 1 || entries[0].Path != "/dir" {
+		t.Errorf("expected the directory in the trash, got %v", entries)
+	}
+}
+
+func TestTrashFsExpiry(t *testing.T) {
+	fs := NewTrashFs(&MemMapFs{}, TrashOptions{MaxAge: time.Hour})
+	WriteFile(fs, "/a", nil, 0644)
+	WriteFile(fs, "/b", nil, 0644)
+	fs.Remove("/a")
+	fs.Remove("/b")
+	if entries, _ := fs.Trash(); len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	fs.maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if err := fs.Expire(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := fs.Trash(); len(entries) != 0 {
+		t.Errorf("expected the entries to expire, got %v", entries)
+	}
+
+	// An info file left partly written is skipped.
+	fs.maxAge = time.Hour
+	WriteFile(fs.source, "/.trash/info/00000000000000000001.json", []byte(`{"Path":`), 0600)
+	WriteFile(fs, "/c", nil, 0644)
+	if err := fs.Remove("/c"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := fs.Trash(); err != nil || len(entries) != 1 || entries[0].Path != "/c" {
+		t.Errorf("expected the entry of /c, got %v, %v", entries, err)
+	}
+}
+
+func TestTrashFsBasePath(t *testing.T) {
+	base := &MemMapFs{}
+	base.MkdirAll("/users/alice", 0755)
+	fs := NewTrashFs(NewBasePathFs(base, "/users/alice"), TrashOptions{})
+	WriteFile(fs, "/data", []byte("x"), 0644)
+	if err := fs.Remove("/data"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := fs.Trash()
+	if len(entries) != 1 {
+		t.Fatalf("expected an entry, got %v", entries)
+	}
+	if _, err := base.Stat("/users/alice/.trash/files/" + entries[0].ID); err != nil {
+		t.Errorf("expected the trash inside the jail, got %v", err)
+	}
+	if err := fs.Restore(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Stat("/users/alice/data"); err != nil {
+		t.Error(err)
+	}
+}
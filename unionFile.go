@@ -1,6 +1,7 @@
 package afero
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -41,6 +42,36 @@ func (f *UnionFile) Close() error {
 	return BADFD
 }
 
+// lockTarget returns the file the locks of f are placed on: the layer if
+// present, as that is where the writes go, else the base.
+func (f *UnionFile) lockTarget() File {
+	if f.Layer != nil {
+		return f.Layer
+	}
+	return f.Base
+}
+
+func (f *UnionFile) Lock(ctx context.Context, exclusive bool) error {
+	if t := f.lockTarget(); t != nil {
+		return LockFile(ctx, t, exclusive)
+	}
+	return BADFD
+}
+
+func (f *UnionFile) TryLock(exclusive bool) error {
+	if t := f.lockTarget(); t != nil {
+		return TryLockFile(t, exclusive)
+	}
+	return BADFD
+}
+
+func (f *UnionFile) Unlock() error {
+	if t := f.lockTarget(); t != nil {
+		return UnlockFile(t)
+	}
+	return BADFD
+}
+
 func (f *UnionFile) Read(s []byte) (int, error) {
 	if f.Layer != nil {
 		n, err := f.Layer.Read(s)
@@ -304,7 +335,7 @@ func copyToLayer(base Fs, layer Fs, name string) error {
 	if err != nil || bfi.Size() != n {
 		layer.Remove(name)
 		lfh.Close()
-		return syscall.EIO
+		return &os.PathError{Op: "copy", Path: name, Err: syscall.EIO}
 	}
 
 	err = lfh.Close()
@@ -313,5 +344,9 @@ func copyToLayer(base Fs, layer Fs, name string) error {
 		lfh.Close()
 		return err
 	}
+	if err := copyXattrs(base, layer, name); err != nil {
+		layer.Remove(name)
+		return err
+	}
 	return layer.Chtimes(name, bfi.ModTime(), bfi.ModTime())
 }
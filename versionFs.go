@@ -0,0 +1,462 @@
+package afero
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Lstater = (*VersionFs)(nil)
+
+// ErrNoRevision is the error that will be wrapped in an *os.PathError when
+// a file has no revision of the given id.
+var ErrNoRevision = WrapError(os.ErrNotExist, errors.New("no such revision"))
+
+// VersionOptions are the options of a VersionFs.
+type VersionOptions struct {
+	// Dir is the directory of the source where revisions are kept,
+	// "/.versions" if empty. It is hidden from the VersionFs. Revisions
+	// are kept there by the full path of their file, so over an OsFs it
+	// should rather be set next to the files versioned.
+	Dir string
+
+	// MaxRevisions is the number of revisions kept per file, and MaxAge
+	// how long they are kept. Zero means no limit.
+	MaxRevisions int
+	MaxAge       time.Duration
+}
+
+// A Revision is a previous content of a file.
+type Revision struct {
+	ID   string
+	Time time.Time // when the content was replaced
+	Size int64
+}
+
+// The VersionFs keeps the previous contents of the files of a source
+// filesystem as revisions, so that changes can be undone: a revision is
+// saved before a file is truncated, written to for the first time through
+// a handle, removed, or replaced by a rename.
+//
+// Revisions are kept by path, in a directory of the source hidden from the
+// VersionFs, see VersionOptions. A file renamed leaves its revisions under
+// its old name.
+type VersionFs struct {
+	source Fs
+	dir    string
+	opts   VersionOptions
+
+	mu   sync.Mutex
+	last int64 // of the last revision saved
+}
+
+func NewVersionFs(source Fs, opts VersionOptions) *VersionFs {
+	if opts.Dir == "" {
+		opts.Dir = "/.versions"
+	}
+	return &VersionFs{source: source, dir: normalizePath(opts.Dir), opts: opts}
+}
+
+// hidden tells whether name is in the directory of the revisions.
+func (v *VersionFs) hidden(name string) bool {
+	name = normalizePath(name)
+	return name == v.dir || strings.HasPrefix(name, v.dir+string(filepath.Separator))
+}
+
+func (v *VersionFs) hiddenError(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+// revisionDir returns the directory of the revisions of name.
+func (v *VersionFs) revisionDir(name string) string {
+	return filepath.Join(v.dir, normalizePath(name))
+}
+
+// save keeps the current content of name as a revision, if it is a
+// regular file.
+func (v *VersionFs) save(name string) error {
+	fi, err := v.source.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	v.mu.Lock()
+	id := time.Now().UnixNano()
+	if id <= v.last {
+		id = v.last + 1
+	}
+	v.last = id
+	v.mu.Unlock()
+
+	dir := v.revisionDir(name)
+	if err := v.source.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	src, err := v.source.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := v.source.OpenFile(filepath.Join(dir, revisionID(id)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return v.prune(name)
+}
+
+// revisionID formats the time a revision was saved as its id, so that ids
+// sort chronologically.
+func revisionID(nsec int64) string {
+	return fmt.Sprintf("%020d", nsec)
+}
+
+// Revisions returns the revisions of name, oldest first.
+func (v *VersionFs) Revisions(name string) ([]Revision, error) {
+	if v.hidden(name) {
+		return nil, v.hiddenError("revisions", name)
+	}
+	fis, err := ReadDir(v.source, v.revisionDir(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revs []Revision
+	for _, fi := range fis {
+		nsec, err := strconv.ParseInt(fi.Name(), 10, 64)
+		if err != nil || !fi.Mode().IsRegular() {
+			// The directory of the revisions of a file below name.
+			continue
+		}
+		revs = append(revs, Revision{ID: fi.Name(), Time: time.Unix(0, nsec), Size: fi.Size()})
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].ID < revs[j].ID })
+	return revs, nil
+}
+
+// OpenRevision opens the revision id of name for reading.
+func (v *VersionFs) OpenRevision(name, id string) (File, error) {
+	if v.hidden(name) {
+		return nil, v.hiddenError("open", name)
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrNoRevision}
+	}
+	f, err := v.source.Open(filepath.Join(v.revisionDir(name), id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrNoRevision}
+	}
+	return f, err
+}
+
+// Restore replaces the content of name with its revision id. The content
+// replaced is saved as a revision, so that a restore can be undone too.
+func (v *VersionFs) Restore(name, id string) error {
+	rev, err := v.OpenRevision(name, id)
+	if err != nil {
+		return err
+	}
+	defer rev.Close()
+	fi, err := rev.Stat()
+	if err != nil {
+		return err
+	}
+	f, err := v.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rev); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune removes the revisions of name beyond the retention limits.
+func (v *VersionFs) prune(name string) error {
+	if v.opts.MaxRevisions <= 0 && v.opts.MaxAge <= 0 {
+		return nil
+	}
+	revs, err := v.Revisions(name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, rev := range revs {
+		tooMany := v.opts.MaxRevisions > 0 && len(revs)-i > v.opts.MaxRevisions
+		tooOld := v.opts.MaxAge > 0 && now.Sub(rev.Time) > v.opts.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := v.source.Remove(filepath.Join(v.revisionDir(name), rev.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes the revisions of all files beyond the retention limits.
+// Revisions of a file are otherwise only pruned when a new one is saved.
+func (v *VersionFs) Prune() error {
+	var names []string
+	err := Walk(v.source, v.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != v.dir {
+			names = append(names, strings.TrimPrefix(path, v.dir))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, name := range names {
+		if err := v.prune(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *VersionFs) Name() string {
+	return "VersionFs"
+}
+
+func (v *VersionFs) Create(name string) (File, error) {
+	return v.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (v *VersionFs) Open(name string) (File, error) {
+	return v.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (v *VersionFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if v.hidden(name) {
+		return nil, v.hiddenError("open", name)
+	}
+	saved := false
+	if flag&os.O_TRUNC != 0 {
+		if err := v.save(name); err != nil {
+			return nil, err
+		}
+		saved = true
+	} else if flag&os.O_CREATE != 0 {
+		// A file created has no previous content.
+		_, err := v.source.Stat(name)
+		saved = errors.Is(err, os.ErrNotExist)
+	}
+	f, err := v.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionFile{lockingFile: lockingFile{f}, fs: v, name: name, saved: saved}, nil
+}
+
+func (v *VersionFs) Mkdir(name string, perm os.FileMode) error {
+	if v.hidden(name) {
+		return v.hiddenError("mkdir", name)
+	}
+	return v.source.Mkdir(name, perm)
+}
+
+func (v *VersionFs) MkdirAll(path string, perm os.FileMode) error {
+	if v.hidden(path) {
+		return v.hiddenError("mkdir", path)
+	}
+	return v.source.MkdirAll(path, perm)
+}
+
+func (v *VersionFs) Remove(name string) error {
+	if v.hidden(name) {
+		return v.hiddenError("remove", name)
+	}
+	if err := v.save(name); err != nil {
+		return err
+	}
+	return v.source.Remove(name)
+}
+
+// RemoveAll saves a revision of every file below path. Of a directory
+// containing the revisions, everything else is removed.
+func (v *VersionFs) RemoveAll(path string) error {
+	if v.hidden(path) {
+		return v.hiddenError("remove_all", path)
+	}
+	err := Walk(v, path, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			return v.save(name)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return v.removeAll(path)
+}
+
+// removeAll removes path from the source, but for the revisions.
+func (v *VersionFs) removeAll(path string) error {
+	if !v.contains(path) {
+		return v.source.RemoveAll(path)
+	}
+	names, err := readDirNames(v.source, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		if name := filepath.Join(path, name); !v.hidden(name) {
+			if err := v.removeAll(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contains tells whether the revisions are below the directory dir.
+func (v *VersionFs) contains(dir string) bool {
+	dir = strings.TrimSuffix(normalizePath(dir), string(filepath.Separator))
+	return strings.HasPrefix(v.dir, dir+string(filepath.Separator))
+}
+
+// Rename saves a revision of the file newname replaces, if any.
+func (v *VersionFs) Rename(oldname, newname string) error {
+	if v.hidden(oldname) || v.hidden(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if err := v.save(newname); err != nil {
+		return err
+	}
+	return v.source.Rename(oldname, newname)
+}
+
+func (v *VersionFs) Stat(name string) (os.FileInfo, error) {
+	if v.hidden(name) {
+		return nil, v.hiddenError("stat", name)
+	}
+	return v.source.Stat(name)
+}
+
+func (v *VersionFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if v.hidden(name) {
+		return nil, false, v.hiddenError("lstat", name)
+	}
+	if lstater, ok := v.source.(Lstater); ok {
+		return lstater.LstatIfPossible(name)
+	}
+	fi, err := v.source.Stat(name)
+	return fi, false, err
+}
+
+func (v *VersionFs) Chmod(name string, mode os.FileMode) error {
+	if v.hidden(name) {
+		return v.hiddenError("chmod", name)
+	}
+	return v.source.Chmod(name, mode)
+}
+
+func (v *VersionFs) Chown(name string, uid, gid int) error {
+	if v.hidden(name) {
+		return v.hiddenError("chown", name)
+	}
+	return v.source.Chown(name, uid, gid)
+}
+
+func (v *VersionFs) Chtimes(name string, atime, mtime time.Time) error {
+	if v.hidden(name) {
+		return v.hiddenError("chtimes", name)
+	}
+	return v.source.Chtimes(name, atime, mtime)
+}
+
+// VersionFile is a file opened through a VersionFs.
+type VersionFile struct {
+	lockingFile
+	fs   *VersionFs
+	name string
+
+	mu    sync.Mutex
+	saved bool // whether the content it replaces was saved
+}
+
+// modify saves the content of the file before it is first modified.
+func (f *VersionFile) modify() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.saved {
+		return nil
+	}
+	if err := f.fs.save(f.name); err != nil {
+		return err
+	}
+	f.saved = true
+	return nil
+}
+
+func (f *VersionFile) Write(p []byte) (int, error) {
+	if err := f.modify(); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *VersionFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.modify(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *VersionFile) WriteString(s string) (int, error) {
+	if err := f.modify(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteString(s)
+}
+
+func (f *VersionFile) Truncate(size int64) error {
+	if err := f.modify(); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+// Readdir hides the directory of the revisions.
+func (f *VersionFile) Readdir(count int) ([]os.FileInfo, error) {
+	return readdirFiltered(f.File, count, func(fi os.FileInfo) (os.FileInfo, bool) {
+		return fi, !f.fs.hidden(filepath.Join(f.name, fi.Name()))
+	})
+}
+
+func (f *VersionFile) Readdirnames(n int) ([]string, error) {
+	fis, err := f.Readdir(n)
+	return fileInfoNames(fis), err
+}
@@ -0,0 +1,135 @@
+package afero
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVersionFsRevisions(t *testing.T) {
+	fs := NewVersionFs(&MemMapFs{}, VersionOptions{})
+	WriteFile(fs, "/config", []byte("v1"), 0644)
+	WriteFile(fs, "/config", []byte("v2"), 0644)
+	f, _ := fs.OpenFile("/config", os.O_WRONLY, 0)
+	f.WriteString("v3")
+	f.WriteString("!")
+	f.Close()
+
+	revs, err := fs.Revisions("/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[0].Size != 2 || !revs[0].Time.Before(revs[1].Time) {
+		t.Fatalf("expected one revision per change, got %v", revs)
+	}
+	for i, want := range []string{"v1", "v2"} {
+		rf, err := fs.OpenRevision("/config", revs[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rf)
+		rf.Close()
+		if string(data) != want {
+			t.Errorf("revision %d: expected %q, got %q", i, want, data)
+		}
+	}
+	if _, err := fs.OpenRevision("/config", "42"); !errors.Is(err, ErrNoRevision) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNoRevision, got %v", err)
+	}
+
+	if err := fs.Restore("/config", revs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile(fs, "/config"); string(data) != "v1" {
+		t.Errorf("expected the restored content, got %q", data)
+	}
+	revs, _ = fs.Revisions("/config")
+	if len(revs) != 3 || revs[2].Size != 3 {
+		t.Errorf("expected the restore to save the content replaced, got %v", revs)
+	}
+}
+
+func TestVersionFsRemove(t *testing.T) {
+	fs := NewVersionFs(&MemMapFs{}, VersionOptions{})
+	fs.MkdirAll("/dir/sub", 0755)
+	WriteFile(fs, "/dir/a", []byte("a"), 0644)
+	WriteFile(fs, "/dir/sub/b", []byte("b"), 0644)
+	WriteFile(fs, "/c", []byte("c"), 0644)
+	WriteFile(fs, "/d", []byte("d"), 0644)
+
+	if err := fs.RemoveAll("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/c", "/d"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/dir/a", "/dir/sub/b", "/d"} {
+		if revs, err := fs.Revisions(name); err != nil || len(revs) != 1 {
+			t.Errorf("%s: expected a revision, got %v, %v", name, revs, err)
+		}
+	}
+	if revs, _ := fs.Revisions("/c"); len(revs) != 0 {
+		t.Errorf("expected a rename not to save its source, got %v", revs)
+	}
+
+	names, err := ReadDir(fs, "/")
+	if err != nil || len(names) != 1 || names[0].Name() != "d" {
+		t.Errorf("expected the revisions to be hidden, got %v, %v", names, err)
+	}
+	if _, err := fs.Stat("/.versions"); !os.IsNotExist(err) {
+		t.Errorf("expected the revisions to be hidden, got %v", err)
+	}
+}
+
+func TestVersionFsRemoveAllContaining(t *testing.T) {
+	for _, dir := range []string{"", "/data/.versions"} {
+		fs := NewVersionFs(&MemMapFs{}, VersionOptions{Dir: dir})
+		fs.MkdirAll("/data/sub", 0755)
+		WriteFile(fs, "/data/a", []byte("a"), 0644)
+		WriteFile(fs, "/data/sub/b", []byte("b"), 0644)
+
+		for _, path := range []string{"/data", "/"} {
+			if err := fs.RemoveAll(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, name := range []string{"/data/a", "/data/sub/b"} {
+			if revs, err := fs.Revisions(name); err != nil || len(revs) != 1 {
+				t.Errorf("%q: %s: expected the revision to be kept, got %v, %v", dir, name, revs, err)
+			}
+		}
+		// The directory of the revisions is kept, but empty.
+		if names, err := readDirNames(fs, filepath.Dir(fs.dir)); err != nil || len(names) != 0 {
+			t.Errorf("%q: expected everything else to be removed, got %v, %v", dir, names, err)
+		}
+	}
+}
+
+func TestVersionFsRetention(t *testing.T) {
+	fs := NewVersionFs(&MemMapFs{}, VersionOptions{MaxRevisions: 2})
+	for _, content := range []string{"1", "2", "3", "4"} {
+		WriteFile(fs, "/f", []byte(content), 0644)
+	}
+	revs, _ := fs.Revisions("/f")
+	if len(revs) != 2 {
+		t.Fatalf("expected 2 revisions, got %v", revs)
+	}
+	rf, _ := fs.OpenRevision("/f", revs[0].ID)
+	data, _ := ioutil.ReadAll(rf)
+	rf.Close()
+	if string(data) != "2" {
+		t.Errorf("expected the oldest revisions to go first, got %q", data)
+	}
+
+	fs.opts.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if err := fs.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if revs, _ := fs.Revisions("/f"); len(revs) != 0 {
+		t.Errorf("expected the old revisions to expire, got %v", revs)
+	}
+}
@@ -0,0 +1,297 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Op describes a set of file operations reported by a Watcher.
+type Op uint32
+
+const (
+	OpCreate Op = 1 << iota
+	OpWrite
+	OpRemove
+	OpRename
+	OpChmod
+)
+
+func (op Op) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{OpCreate, "CREATE"},
+		{OpWrite, "WRITE"},
+		{OpRemove, "REMOVE"},
+		{OpRename, "RENAME"},
+		{OpChmod, "CHMOD"},
+	} {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a single change notification delivered by a Watch.
+// Name is the path of the affected file or directory, as seen through the
+// filesystem the watch was registered with.
+type Event struct {
+	Name string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Name
+}
+
+// Watcher is an optional interface in Afero. It is only implemented by the
+// filesystems saying so.
+// Watch registers a watch for the named file or directory. For a directory
+// the events of its direct children are delivered as well, and with
+// recursive set the events of the whole subtree.
+type Watcher interface {
+	Watch(name string, recursive bool) (Watch, error)
+}
+
+// A Watch delivers the events for a path registered with a Watcher until
+// it is closed. Close closes both channels.
+type Watch interface {
+	Events() <-chan Event
+	Errors() <-chan error
+	Close() error
+}
+
+// ErrNoWatch is the error that will be wrapped in an *os.PathError if a file
+// system does not support change notifications either directly or through its
+// delegated filesystem.
+var ErrNoWatch = WrapError(os.ErrInvalid, errors.New("watch not supported"))
+
+// ErrEventOverflow is delivered on the Errors channel of a Watch when events
+// had to be dropped because the consumer did not keep up.
+var ErrEventOverflow = errors.New("watch event queue overflow")
+
+// eventQueueSize is the number of events buffered for each watch before
+// further events are dropped and ErrEventOverflow is reported.
+const eventQueueSize = 128
+
+// inWatchScope reports whether an event for name is delivered by a watch on
+// root.
+func inWatchScope(root string, recursive bool, name string) bool {
+	if name == root || filepath.Dir(name) == root {
+		return true
+	}
+	if !recursive {
+		return false
+	}
+	if !strings.HasSuffix(root, FilePathSeparator) {
+		root += FilePathSeparator
+	}
+	return strings.HasPrefix(name, root)
+}
+
+// eventQueue holds the channels of a watch. Sending never blocks: if the
+// consumer falls behind, events are dropped and ErrEventOverflow is
+// reported instead.
+type eventQueue struct {
+	events chan Event
+	errors chan error
+}
+
+func newEventQueue() eventQueue {
+	return eventQueue{
+		events: make(chan Event, eventQueueSize),
+		errors: make(chan error, 1),
+	}
+}
+
+func (q eventQueue) Events() <-chan Event { return q.events }
+func (q eventQueue) Errors() <-chan error { return q.errors }
+
+func (q eventQueue) send(ev Event) {
+	select {
+	case q.events <- ev:
+	default:
+		q.fail(ErrEventOverflow)
+	}
+}
+
+func (q eventQueue) fail(err error) {
+	select {
+	case q.errors <- err:
+	default:
+	}
+}
+
+func (q eventQueue) close() {
+	close(q.events)
+	close(q.errors)
+}
+
+// watchSet dispatches events to the watches of a filesystem which produces
+// the events itself, such as MemMapFs. The zero value is ready to use.
+type watchSet struct {
+	mu      sync.Mutex
+	watches map[*setWatch]struct{}
+}
+
+type setWatch struct {
+	eventQueue
+	root      string
+	recursive bool
+	set       *watchSet
+}
+
+func (s *watchSet) add(root string, recursive bool) *setWatch {
+	w := &setWatch{eventQueue: newEventQueue(), root: root, recursive: recursive, set: s}
+	s.mu.Lock()
+	if s.watches == nil {
+		s.watches = make(map[*setWatch]struct{})
+	}
+	s.watches[w] = struct{}{}
+	s.mu.Unlock()
+	return w
+}
+
+func (s *watchSet) notify(name string, op Op) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watches {
+		if inWatchScope(w.root, w.recursive, name) {
+			w.send(Event{Name: name, Op: op})
+		}
+	}
+}
+
+func (w *setWatch) Close() error {
+	w.set.mu.Lock()
+	defer w.set.mu.Unlock()
+	if _, ok := w.set.watches[w]; ok {
+		delete(w.set.watches, w)
+		w.close()
+	}
+	return nil
+}
+
+// filteredWatch forwards the events of one or more watches, passing each
+// event through filter. It is used by the wrapping filesystems to translate
+// and hide paths. As with eventQueue, errors never hold up events: those
+// arriving while one is waiting to be read are dropped.
+type filteredWatch struct {
+	sources []Watch
+	events  chan Event
+	errors  chan error
+	done    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func newFilteredWatch(filter func(Event) (Event, bool), sources ...Watch) *filteredWatch {
+	w := &filteredWatch{
+		sources: sources,
+		events:  make(chan Event),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	w.wg.Add(len(sources))
+	for _, source := range sources {
+		go w.forward(source, filter)
+	}
+	go func() {
+		w.wg.Wait()
+		close(w.events)
+		close(w.errors)
+	}()
+	return w
+}
+
+func (w *filteredWatch) forward(source Watch, filter func(Event) (Event, bool)) {
+	defer w.wg.Done()
+	events, errs := source.Events(), source.Errors()
+	for events != nil || errs != nil {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if ev, ok = filter(ev); !ok {
+				continue
+			}
+			select {
+			case w.events <- ev:
+			case <-w.done:
+				return
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			select {
+			case w.errors <- err:
+			default:
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *filteredWatch) Events() <-chan Event { return w.events }
+func (w *filteredWatch) Errors() <-chan error { return w.errors }
+
+func (w *filteredWatch) Close() (err error) {
+	w.once.Do(func() {
+		close(w.done)
+		for _, source := range w.sources {
+			if cerr := source.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// watchExisting watches name on fs, or its closest existing ancestor when
+// name does not exist (yet), so that entries created under name later on
+// are not missed. The events are narrowed down to what a watch on name
+// would deliver.
+func watchExisting(fs Fs, name string, recursive bool) (Watch, error) {
+	watcher, ok := fs.(Watcher)
+	if !ok {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: ErrNoWatch}
+	}
+	name = filepath.Clean(name)
+	dir := name
+	for {
+		if _, err := fs.Stat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, &os.PathError{Op: "watch", Path: name, Err: ErrFileNotFound}
+		}
+		dir = parent
+	}
+	if dir == name {
+		return watcher.Watch(name, recursive)
+	}
+	w, err := watcher.Watch(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	return newFilteredWatch(func(ev Event) (Event, bool) {
+		return ev, inWatchScope(name, recursive, ev.Name)
+	}, w), nil
+}
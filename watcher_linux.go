@@ -0,0 +1,148 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var _ Watcher = (*OsFs)(nil)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MODIFY |
+	syscall.IN_ATTRIB | syscall.IN_DELETE | syscall.IN_DELETE_SELF |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVE_SELF
+
+// Watch delivers the events of the named file or directory using inotify.
+// With recursive set, watches are added for every directory of the subtree,
+// including the ones created after the watch was registered.
+func (OsFs) Watch(name string, recursive bool) (Watch, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, &os.PathError{Op: "watch", Path: name, Err: os.NewSyscallError("inotify_init1", err)}
+	}
+	w := &inotifyWatch{
+		eventQueue: newEventQueue(),
+		fd:         fd,
+		file:       os.NewFile(uintptr(fd), "inotify"),
+		root:       filepath.Clean(name),
+		recursive:  recursive && fi.IsDir(),
+		paths:      make(map[int32]string),
+	}
+	if w.recursive {
+		err = filepath.Walk(w.root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return w.add(path)
+			}
+			return nil
+		})
+	} else {
+		err = w.add(w.root)
+	}
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+type inotifyWatch struct {
+	eventQueue
+	fd        int
+	file      *os.File
+	root      string
+	recursive bool
+
+	mu    sync.Mutex
+	paths map[int32]string // watch descriptor to path
+}
+
+func (w *inotifyWatch) add(path string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "watch", Path: path, Err: os.NewSyscallError("inotify_add_watch", err)}
+	}
+	w.mu.Lock()
+	w.paths[int32(wd)] = path
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *inotifyWatch) Close() error {
+	return w.file.Close()
+}
+
+func (w *inotifyWatch) readEvents() {
+	defer w.close()
+	var buf [syscall.SizeofInotifyEvent * 4096]byte
+	for {
+		n, err := w.file.Read(buf[:])
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.fail(err)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+			w.handle(raw.Wd, raw.Mask, strings.TrimRight(string(nameBytes), "\x00"))
+		}
+	}
+}
+
+func (w *inotifyWatch) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.fail(ErrEventOverflow)
+		return
+	}
+	w.mu.Lock()
+	path, ok := w.paths[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.paths, wd)
+	}
+	w.mu.Unlock()
+	if !ok || mask&syscall.IN_IGNORED != 0 {
+		return
+	}
+	if name != "" {
+		path = filepath.Join(path, name)
+	} else if mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 && path != w.root {
+		// The parent directory reports the same change for its child.
+		return
+	}
+
+	var op Op
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		op = OpCreate
+		if w.recursive && mask&syscall.IN_ISDIR != 0 {
+			if err := w.add(path); err != nil {
+				w.fail(err)
+			}
+		}
+	case mask&syscall.IN_MODIFY != 0:
+		op = OpWrite
+	case mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0:
+		op = OpRemove
+	case mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0:
+		op = OpRename
+	case mask&syscall.IN_ATTRIB != 0:
+		op = OpChmod
+	default:
+		return
+	}
+	w.send(Event{Name: path, Op: op})
+}
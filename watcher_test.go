@@ -0,0 +1,247 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// expectEvents reads events from w until it has seen all of want in order,
+// skipping unrelated ones, and fails the test after a timeout.
+func expectEvents(t *testing.T, w Watch, want ...Event) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for len(want) > 0 {
+		select {
+		case got := <-w.Events():
+			if got == want[0] {
+				want = want[1:]
+			}
+		case err := <-w.Errors():
+			t.Fatalf("unexpected watch error: %v", err)
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v", want[0])
+		}
+	}
+}
+
+func expectNoEvents(t *testing.T, w Watch) {
+	t.Helper()
+	select {
+	case ev := <-w.Events():
+		t.Errorf("unexpected event %v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemMapFsWatch(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/dir/sub", 0755)
+
+	w, err := fs.Watch("/dir", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	f, err := fs.Create("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	fs.Chmod("/dir/file.txt", 0600)
+	fs.Rename("/dir/file.txt", "/dir/moved.txt")
+	fs.Remove("/dir/moved.txt")
+
+	expectEvents(t, w,
+		Event{Name: "/dir/file.txt", Op: OpCreate},
+		Event{Name: "/dir/file.txt", Op: OpWrite},
+		Event{Name: "/dir/file.txt", Op: OpChmod},
+		Event{Name: "/dir/file.txt", Op: OpRename},
+		Event{Name: "/dir/moved.txt", Op: OpCreate},
+		Event{Name: "/dir/moved.txt", Op: OpRemove},
+	)
+
+	// Not recursive: changes below /dir/sub are not delivered.
+	WriteFile(fs, "/dir/sub/deep.txt", []byte("x"), 0644)
+	expectNoEvents(t, w)
+
+	if _, err := fs.Watch("/missing", false); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestMemMapFsWatchRecursive(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/dir", 0755)
+
+	w, err := fs.Watch("/dir", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WriteFile(fs, "/dir/a/b/deep.txt", []byte("x"), 0644)
+	expectEvents(t, w,
+		Event{Name: "/dir/a", Op: OpCreate},
+		Event{Name: "/dir/a/b", Op: OpCreate},
+		Event{Name: "/dir/a/b/deep.txt", Op: OpCreate},
+		Event{Name: "/dir/a/b/deep.txt", Op: OpWrite},
+	)
+
+	w.Close()
+	for range w.Events() {
+		// drain the events queued before Close
+	}
+	if _, ok := <-w.Errors(); ok {
+		t.Error("expected the errors channel to be closed")
+	}
+}
+
+func TestBasePathFsWatch(t *testing.T) {
+	mfs := &MemMapFs{}
+	mfs.MkdirAll("/base/dir", 0755)
+	bfs := NewBasePathFs(mfs, "/base")
+
+	w, err := bfs.(Watcher).Watch("/dir", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	WriteFile(bfs, "/dir/file.txt", []byte("x"), 0644)
+	expectEvents(t, w, Event{Name: "/dir/file.txt", Op: OpCreate})
+}
+
+func TestRegexpFsWatch(t *testing.T) {
+	mfs := &MemMapFs{}
+	mfs.MkdirAll("/dir", 0755)
+	rfs := NewRegexpFs(mfs, regexp.MustCompile(`\.txt$`))
+
+	w, err := rfs.(Watcher).Watch("/dir", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	WriteFile(mfs, "/dir/hidden.go", []byte("x"), 0644)
+	mfs.Mkdir("/dir/sub", 0755)
+	WriteFile(mfs, "/dir/sub/shown.txt", []byte("x"), 0644)
+
+	timeout := time.After(5 * time.Second)
+	var got []Event
+	for len(got) < 3 {
+		select {
+		case ev := <-w.Events():
+			if ev.Name == "/dir/hidden.go" {
+				t.Fatalf("unexpected event %v", ev)
+			}
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatalf("timed out, got %v", got)
+		}
+	}
+	if got[0] != (Event{Name: "/dir/sub", Op: OpCreate}) {
+		t.Errorf("expected the directory to be reported, got %v", got[0])
+	}
+}
+
+func TestFilteredWatchErrors(t *testing.T) {
+	var set watchSet
+	source := set.add("/", true)
+	w := newFilteredWatch(func(ev Event) (Event, bool) { return ev, true }, source)
+	defer w.Close()
+
+	// Errors nobody reads do not hold up the events.
+	for i := 0; i < 3; i++ {
+		source.fail(ErrEventOverflow)
+		time.Sleep(10 * time.Millisecond)
+	}
+	set.notify("/file", OpCreate)
+	select {
+	case ev := <-w.Events():
+		if ev != (Event{Name: "/file", Op: OpCreate}) {
+			t.Errorf("unexpected event %v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+	if err := <-w.Errors(); err != ErrEventOverflow {
+		t.Errorf("expected the first error to be kept, got %v", err)
+	}
+}
+
+func TestCopyOnWriteFsWatch(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/dir/base.txt", []byte("x"), 0644)
+	layer := &MemMapFs{}
+	ufs := NewCopyOnWriteFs(base, layer)
+
+	w, err := ufs.(Watcher).Watch("/dir", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// The directory only exists in the base, the write goes to the overlay.
+	WriteFile(ufs, "/dir/new.txt", []byte("x"), 0644)
+	expectEvents(t, w, Event{Name: "/dir/new.txt", Op: OpCreate})
+
+	base.Chmod("/dir/base.txt", 0600)
+	expectEvents(t, w, Event{Name: "/dir/base.txt", Op: OpChmod})
+
+	// Once copied up, the base file is hidden.
+	ufs.Chtimes("/dir/base.txt", time.Now(), time.Now())
+	base.Remove("/dir/base.txt")
+	WriteFile(ufs, "/dir/marker.txt", []byte("x"), 0644)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Op == OpRemove {
+				t.Fatalf("unexpected event %v", ev)
+			}
+			if ev.Name != "/dir/marker.txt" {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("timed out")
+		}
+		break
+	}
+}
+
+func TestOsFsWatch(t *testing.T) {
+	osfs := &OsFs{}
+	watcher, ok := Fs(osfs).(Watcher)
+	if !ok {
+		t.Skip("OsFs does not support watching on this platform")
+	}
+	dir, err := TempDir(osfs, "", "afero-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osfs.RemoveAll(dir)
+
+	w, err := watcher.Watch(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	sub := filepath.Join(dir, "sub")
+	if err := osfs.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, w, Event{Name: sub, Op: OpCreate})
+
+	name := filepath.Join(sub, "file.txt")
+	if err := WriteFile(osfs, name, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, w, Event{Name: name, Op: OpCreate}, Event{Name: name, Op: OpWrite})
+
+	osfs.Remove(name)
+	expectEvents(t, w, Event{Name: name, Op: OpRemove})
+}
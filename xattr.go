@@ -0,0 +1,66 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"sort"
+)
+
+// Xattrer is an optional interface in Afero. It is only implemented by the
+// filesystems saying so.
+// It gives access to the extended attributes of files, with the semantics
+// of getxattr(2), setxattr(2), listxattr(2) and removexattr(2). Attribute
+// names include their namespace, as in "user.mime_type". ListXattr returns
+// them sorted.
+type Xattrer interface {
+	GetXattr(name, attr string) ([]byte, error)
+	SetXattr(name, attr string, value []byte) error
+	ListXattr(name string) ([]string, error)
+	RemoveXattr(name, attr string) error
+}
+
+// ErrNoXattr is the error that will be wrapped in an *os.PathError if a file
+// system does not support extended attributes either directly or through its
+// delegated filesystem.
+var ErrNoXattr = WrapError(os.ErrInvalid, errors.New("xattr not supported"))
+
+// ErrNoAttr is wrapped in an *os.PathError when the requested extended
+// attribute is not set on the file.
+var ErrNoAttr = errors.New("attribute not found")
+
+// copyXattrs copies the extended attributes of name from src to dst. It
+// does nothing if either of them does not support extended attributes.
+func copyXattrs(src, dst Fs, name string) error {
+	sx, ok := src.(Xattrer)
+	if !ok {
+		return nil
+	}
+	dx, ok := dst.(Xattrer)
+	if !ok {
+		return nil
+	}
+	attrs, err := sx.ListXattr(name)
+	if err != nil {
+		if errors.Is(err, ErrNoXattr) {
+			return nil
+		}
+		return err
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		value, err := sx.GetXattr(name, attr)
+		if err != nil {
+			if errors.Is(err, ErrNoAttr) {
+				continue
+			}
+			return err
+		}
+		if err := dx.SetXattr(name, attr, value); err != nil {
+			if errors.Is(err, ErrNoXattr) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
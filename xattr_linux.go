@@ -0,0 +1,83 @@
+package afero
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"syscall"
+)
+
+var _ Xattrer = (*OsFs)(nil)
+
+func (OsFs) GetXattr(name, attr string) ([]byte, error) {
+	var buf []byte
+	for {
+		size, err := syscall.Getxattr(name, attr, buf)
+		if err == syscall.ERANGE {
+			// The attribute grew since its size was queried.
+			buf = nil
+			continue
+		}
+		if err != nil {
+			return nil, xattrError("getxattr", name, err)
+		}
+		if buf != nil {
+			return buf[:size], nil
+		}
+		buf = make([]byte, size)
+		if size == 0 {
+			return buf, nil
+		}
+	}
+}
+
+func (OsFs) SetXattr(name, attr string, value []byte) error {
+	if err := syscall.Setxattr(name, attr, value, 0); err != nil {
+		return xattrError("setxattr", name, err)
+	}
+	return nil
+}
+
+func (OsFs) ListXattr(name string) ([]string, error) {
+	var buf []byte
+	for {
+		size, err := syscall.Listxattr(name, buf)
+		if err == syscall.ERANGE {
+			buf = nil
+			continue
+		}
+		if err != nil {
+			return nil, xattrError("listxattr", name, err)
+		}
+		if buf == nil && size > 0 {
+			buf = make([]byte, size)
+			continue
+		}
+		var attrs []string
+		for _, attr := range bytes.Split(buf[:size], []byte{0}) {
+			if len(attr) > 0 {
+				attrs = append(attrs, string(attr))
+			}
+		}
+		sort.Strings(attrs)
+		return attrs, nil
+	}
+}
+
+func (OsFs) RemoveXattr(name, attr string) error {
+	if err := syscall.Removexattr(name, attr); err != nil {
+		return xattrError("removexattr", name, err)
+	}
+	return nil
+}
+
+// xattrError attaches ErrNoAttr and ErrNoXattr to the matching errnos.
+func xattrError(op, name string, err error) error {
+	switch err {
+	case syscall.ENODATA:
+		err = WrapError(ErrNoAttr, err)
+	case syscall.ENOTSUP:
+		err = WrapError(ErrNoXattr, err)
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
@@ -0,0 +1,106 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func checkXattr(t *testing.T, fs Fs, name string) {
+	t.Helper()
+	x, ok := fs.(Xattrer)
+	if !ok {
+		t.Fatalf("%T does not implement Xattrer", fs)
+	}
+	if err := x.SetXattr(name, "user.b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.SetXattr(name, "user.a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	value, err := x.GetXattr(name, "user.a")
+	if err != nil || string(value) != "1" {
+		t.Errorf("GetXattr: got %q, %v", value, err)
+	}
+	attrs, err := x.ListXattr(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(attrs, []string{"user.a", "user.b"}) {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	if err := x.RemoveXattr(name, "user.b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.GetXattr(name, "user.b"); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("expected ErrNoAttr, got %v", err)
+	}
+	if err := x.RemoveXattr(name, "user.b"); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("expected ErrNoAttr, got %v", err)
+	}
+	if _, err := x.ListXattr(name + ".missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestXattr(t *testing.T) {
+	mfs := &MemMapFs{}
+	WriteFile(mfs, "/base/file.txt", []byte("x"), 0644)
+	checkXattr(t, mfs, "/base/file.txt")
+	checkXattr(t, NewBasePathFs(mfs, "/base"), "/file.txt")
+	checkXattr(t, NewRegexpFs(mfs, regexp.MustCompile(`\.txt$`)), "/base/file.txt")
+
+	rofs := NewReadOnlyFs(mfs).(Xattrer)
+	if _, err := rofs.GetXattr("/base/file.txt", "user.a"); err != nil {
+		t.Error(err)
+	}
+	if err := rofs.SetXattr("/base/file.txt", "user.a", nil); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
+
+func TestCopyOnWriteFsXattr(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/file.txt", []byte("x"), 0644)
+	base.SetXattr("/file.txt", "user.origin", []byte("base"))
+	ufs := NewCopyOnWriteFs(base, &MemMapFs{}).(Xattrer)
+
+	value, err := ufs.GetXattr("/file.txt", "user.origin")
+	if err != nil || string(value) != "base" {
+		t.Errorf("GetXattr: got %q, %v", value, err)
+	}
+	// Copying the file up keeps its attributes.
+	if err := ufs.SetXattr("/file.txt", "user.tag", []byte("layer")); err != nil {
+		t.Fatal(err)
+	}
+	attrs, _ := ufs.ListXattr("/file.txt")
+	if !reflect.DeepEqual(attrs, []string{"user.origin", "user.tag"}) {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	if attrs, _ := base.ListXattr("/file.txt"); len(attrs) != 1 {
+		t.Errorf("base was modified: %v", attrs)
+	}
+}
+
+func TestOsFsXattr(t *testing.T) {
+	osfs := &OsFs{}
+	if _, ok := Fs(osfs).(Xattrer); !ok {
+		t.Skip("OsFs does not support extended attributes on this platform")
+	}
+	dir, err := TempDir(osfs, "", "afero-xattr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osfs.RemoveAll(dir)
+	name := filepath.Join(dir, "file.txt")
+	WriteFile(osfs, name, []byte("x"), 0644)
+
+	if err := Fs(osfs).(Xattrer).SetXattr(name, "user.probe", nil); errors.Is(err, ErrNoXattr) {
+		t.Skip("the temporary directory does not support extended attributes")
+	}
+	Fs(osfs).(Xattrer).RemoveXattr(name, "user.probe")
+	checkXattr(t, osfs, name)
+}
@@ -42,7 +42,6 @@ func (f *File) fillBuffer(offset int64) (err error) {
 }
 
 func (f *File) Close() (err error) {
-	f.zipfile = nil
 	f.closed = true
 	f.buf = nil
 	if f.reader != nil {
@@ -54,10 +53,10 @@ func (f *File) Close() (err error) {
 
 func (f *File) Read(p []byte) (n int, err error) {
 	if f.isdir {
-		return 0, syscall.EISDIR
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: syscall.EISDIR}
 	}
 	if f.closed {
-		return 0, afero.ErrFileClosed
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 	err = f.fillBuffer(f.offset + int64(len(p)))
 	n = copy(p, f.buf[f.offset:])
@@ -67,10 +66,10 @@ func (f *File) Read(p []byte) (n int, err error) {
 
 func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 	if f.isdir {
-		return 0, syscall.EISDIR
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: syscall.EISDIR}
 	}
 	if f.closed {
-		return 0, afero.ErrFileClosed
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 	err = f.fillBuffer(off + int64(len(p)))
 	n = copy(p, f.buf[int(off):])
@@ -79,10 +78,10 @@ func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	if f.isdir {
-		return 0, syscall.EISDIR
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: syscall.EISDIR}
 	}
 	if f.closed {
-		return 0, afero.ErrFileClosed
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: afero.ErrFileClosed}
 	}
 	switch whence {
 	case os.SEEK_SET:
@@ -91,18 +90,22 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 	case os.SEEK_END:
 		offset += int64(f.zipfile.UncompressedSize64)
 	default:
-		return 0, syscall.EINVAL
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: syscall.EINVAL}
 	}
 	if offset < 0 || offset > int64(f.zipfile.UncompressedSize64) {
-		return 0, afero.ErrOutOfRange
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: afero.WrapError(os.ErrInvalid, afero.ErrOutOfRange)}
 	}
 	f.offset = offset
 	return offset, nil
 }
 
-func (f *File) Write(p []byte) (n int, err error) { return 0, syscall.EPERM }
+func (f *File) Write(p []byte) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: afero.ErrReadOnly}
+}
 
-func (f *File) WriteAt(p []byte, off int64) (n int, err error) { return 0, syscall.EPERM }
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: afero.ErrReadOnly}
+}
 
 func (f *File) Name() string {
 	if f.zipfile == nil {
@@ -113,7 +116,7 @@ func (f *File) Name() string {
 
 func (f *File) getDirEntries() (map[string]*zip.File, error) {
 	if !f.isdir {
-		return nil, syscall.ENOTDIR
+		return nil, &os.PathError{Op: "readdir", Path: f.Name(), Err: syscall.ENOTDIR}
 	}
 	name := f.Name()
 	entries, ok := f.fs.files[name]
@@ -160,6 +163,10 @@ func (f *File) Stat() (os.FileInfo, error) {
 
 func (f *File) Sync() error { return nil }
 
-func (f *File) Truncate(size int64) error { return syscall.EPERM }
+func (f *File) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.Name(), Err: afero.ErrReadOnly}
+}
 
-func (f *File) WriteString(s string) (ret int, err error) { return 0, syscall.EPERM }
+func (f *File) WriteString(s string) (ret int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: afero.ErrReadOnly}
+}
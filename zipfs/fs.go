@@ -46,11 +46,17 @@ func New(r *zip.Reader) afero.Fs {
 	return fs
 }
 
-func (fs *Fs) Create(name string) (afero.File, error) { return nil, syscall.EPERM }
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Mkdir(name string, perm os.FileMode) error { return syscall.EPERM }
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) MkdirAll(path string, perm os.FileMode) error { return syscall.EPERM }
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: afero.ErrReadOnly}
+}
 
 func (fs *Fs) Open(name string) (afero.File, error) {
 	d, f := splitpath(name)
@@ -58,27 +64,33 @@ func (fs *Fs) Open(name string) (afero.File, error) {
 		return &File{fs: fs, isdir: true}, nil
 	}
 	if _, ok := fs.files[d]; !ok {
-		return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
 	}
 	file, ok := fs.files[d][f]
 	if !ok {
-		return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
 	}
 	return &File{fs: fs, zipfile: file, isdir: file.FileInfo().IsDir()}, nil
 }
 
 func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
 	if flag != os.O_RDONLY {
-		return nil, syscall.EPERM
+		return nil, &os.PathError{Op: "open", Path: name, Err: afero.ErrReadOnly}
 	}
 	return fs.Open(name)
 }
 
-func (fs *Fs) Remove(name string) error { return syscall.EPERM }
+func (fs *Fs) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) RemoveAll(path string) error { return syscall.EPERM }
+func (fs *Fs) RemoveAll(path string) error {
+	return &os.PathError{Op: "remove_all", Path: path, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Rename(oldname, newname string) error { return syscall.EPERM }
+func (fs *Fs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: afero.ErrReadOnly}
+}
 
 type pseudoRoot struct{}
 
@@ -106,8 +118,14 @@ func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 
 func (fs *Fs) Name() string { return "zipfs" }
 
-func (fs *Fs) Chmod(name string, mode os.FileMode) error { return syscall.EPERM }
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Chown(name string, uid, gid int) error { return syscall.EPERM }
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: afero.ErrReadOnly}
+}
 
-func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error { return syscall.EPERM }
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: afero.ErrReadOnly}
+}